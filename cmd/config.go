@@ -3,6 +3,7 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/auth"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -155,7 +156,11 @@ var (
 		Short: "set your chain seed or phrase",
 		Run: func(cmd *cobra.Command, args []string) {
 			if args[0] != "" {
-				cm := config.NewConfigManager()
+				cm, err := newConfigManager(true)
+				if err != nil {
+					fmt.Println(err)
+					return
+				}
 				c, err := cm.GetConfig()
 				if err != nil {
 					fmt.Println(err)
@@ -174,6 +179,98 @@ var (
 	}
 )
 
+// api token config
+var (
+	tokenRole string
+
+	tokenCmd = &cobra.Command{
+		Use:   "token",
+		Short: "create,list,remove management api tokens",
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	// token sub command
+	createTokenCmd = &cobra.Command{
+		Use:   "create",
+		Short: "create api token, the token is only shown once",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, t := range c.Auth.Tokens {
+				if t.Name == args[0] {
+					fmt.Println("the token name is already exists")
+					return
+				}
+			}
+			token, apiToken, err := auth.GenerateToken(args[0], config.Role(tokenRole))
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c.Auth.Tokens = append(c.Auth.Tokens, apiToken)
+			err = cm.Save(c)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+			fmt.Printf("api token %s (%s): %s\n", apiToken.Name, apiToken.Role, token)
+		},
+	}
+	lsTokenCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "list api tokens",
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if len(c.Auth.Tokens) == 0 {
+				fmt.Println("api token is empty")
+			}
+			for _, t := range c.Auth.Tokens {
+				fmt.Printf("%s\t%s\n", t.Name, t.Role)
+			}
+		},
+	}
+	rmTokenCmd = &cobra.Command{
+		Use:   "rm",
+		Short: "remove api token",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			var res []config.ApiToken
+			for _, t := range c.Auth.Tokens {
+				if t.Name != args[0] {
+					res = append(res, t)
+				}
+			}
+			if len(res) == len(c.Auth.Tokens) {
+				fmt.Println("the token you want delete is not exists")
+				return
+			}
+			c.Auth.Tokens = res
+			err = cm.Save(c)
+			if err != nil {
+				logrus.Error(err)
+				return
+			}
+		},
+	}
+)
+
 var showCmd = &cobra.Command{
 
 	Use:   "show",
@@ -214,7 +311,7 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 
 	// bootstrap add config
-	configCmd.AddCommand(bootstrapCmd, linkApiCmd, chainSeedCmd, showCmd)
+	configCmd.AddCommand(bootstrapCmd, linkApiCmd, chainSeedCmd, tokenCmd, showCmd)
 
 	// bootstrap
 	bootstrapCmd.AddCommand(addBootCmd, rmBootstrapCmd, clearBootstrapCmd)
@@ -223,6 +320,9 @@ func init() {
 	linkApiCmd.AddCommand(setLinkApiCmd)
 	//  chainSeedCmd
 	chainSeedCmd.AddCommand(setChainSeedCmd)
+	// api token
+	tokenCmd.AddCommand(createTokenCmd, lsTokenCmd, rmTokenCmd)
+	createTokenCmd.Flags().StringVar(&tokenRole, "role", string(config.RoleAdmin), "token role, read or admin")
 
 	// Here you will define your flags and configuration settings.
 
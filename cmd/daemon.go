@@ -20,12 +20,19 @@ import (
 	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
 	"github.com/hamster-shared/hamster-provider/core"
 	context2 "github.com/hamster-shared/hamster-provider/core/context"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
 	chain2 "github.com/hamster-shared/hamster-provider/core/modules/chain"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
 	"github.com/hamster-shared/hamster-provider/core/modules/event"
+	"github.com/hamster-shared/hamster-provider/core/modules/expiry"
+	"github.com/hamster-shared/hamster-provider/core/modules/expose"
 	"github.com/hamster-shared/hamster-provider/core/modules/listener"
 	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
 	"github.com/hamster-shared/hamster-provider/core/modules/pk"
+	"github.com/hamster-shared/hamster-provider/core/modules/ports"
+	"github.com/hamster-shared/hamster-provider/core/modules/snapshot"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	vm2 "github.com/hamster-shared/hamster-provider/core/modules/vm"
 	"github.com/sirupsen/logrus"
@@ -57,8 +64,14 @@ to quickly create a Cobra application.`,
 }
 
 func NewContext() context2.CoreContext {
-	cm := config.NewConfigManager()
-	pkManager := pk.NewManager(cm)
+	cm, err := newConfigManager(false)
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(1)
+	}
+	if !cm.HasSecretStore() {
+		logrus.Warn("secrets are stored in plaintext config, run `hamster-provider key migrate` to encrypt them")
+	}
 	cfg, err := cm.GetConfig()
 	if err != nil {
 		logrus.Error(err)
@@ -70,24 +83,63 @@ func NewContext() context2.CoreContext {
 		return context2.CoreContext{}
 	}
 	var vmManager vm2.Manager
-	// set vm template
-	template := vm2.Template{
-		Cpu:    cfg.Vm.Cpu,
-		Memory: cfg.Vm.Mem,
-		System: cfg.Vm.System,
-		Image:  cfg.Vm.Image,
+	// set vm template, the default template of the catalog
+	catalog := template.NewCatalog(cm)
+	defaultTemplate, err := catalog.Resolve("", 0, 0, 0)
+	if err != nil {
+		logrus.Error(err)
+		return context2.CoreContext{}
+	}
+	imageCache := cache.NewImageCache(filepath.Join(config.DefaultConfigDir(), "cache"), int64(cfg.Vm.CacheSize)<<30)
+	// the access ports of the containers are leased from the configured range
+	portAllocator, err := ports.NewAllocator(filepath.Join(config.DefaultConfigDir(), "ports.json"), cfg.Vm.PortRange)
+	if err != nil {
+		logrus.Error(err)
+		return context2.CoreContext{}
 	}
 	if "docker" == cfg.Vm.Type {
-		vmManager, err = vm2.NewDockerManager(template)
+		var dockerManager *vm2.DockerManager
+		dockerManager, err = vm2.NewDockerManager(defaultTemplate, imageCache)
+		if err == nil {
+			dockerManager.SetRegistries(registryAuths(cfg.Registries))
+			dockerManager.SetPorts(portAllocator)
+		}
+		vmManager = dockerManager
+	} else if "podman" == cfg.Vm.Type {
+		var podmanManager *vm2.DockerManager
+		podmanManager, err = vm2.NewPodmanManager(defaultTemplate, imageCache, cfg.Vm.Socket)
+		if err == nil {
+			podmanManager.SetRegistries(registryAuths(cfg.Registries))
+			podmanManager.SetPorts(portAllocator)
+		}
+		vmManager = podmanManager
+	} else if "firecracker" == cfg.Vm.Type {
+		vmManager, err = vm2.NewFirecrackerManager(defaultTemplate, imageCache, vm2.FirecrackerOptions{
+			Binary: cfg.Vm.Firecracker.Binary,
+			Kernel: cfg.Vm.Firecracker.Kernel,
+			Subnet: cfg.Vm.Firecracker.Subnet,
+			Init:   cfg.Vm.Firecracker.Init,
+		})
+	} else if "kvm" == cfg.Vm.Type {
+		vmManager, err = vm2.NewVirtManager(defaultTemplate, imageCache)
 	} else {
-		//vmManager, err = vm2.NewVirtManager(template)
-		os.Exit(1)
+		err = fmt.Errorf("unsupported virtualization type %s", cfg.Vm.Type)
 	}
 	if err != nil {
 		logrus.Error(err)
 		return context2.CoreContext{}
 	}
 
+	// the existing instances keep the templates they were created from
+	catalog.Restore(vmManager)
+
+	// pull the images of the catalog in the background, the first orders do not wait for them
+	if preparer, ok := vmManager.(vm2.ImagePreparer); ok {
+		go catalog.Prewarm(preparer)
+	}
+
+	pkManager := pk.NewManager(cm, vmManager)
+
 	substrateApi, err := gsrpc.NewSubstrateAPI(cfg.ChainApi)
 	if err != nil {
 		logrus.Error(err)
@@ -99,6 +151,9 @@ func NewContext() context2.CoreContext {
 		return context2.CoreContext{}
 	}
 	timeService := utils.NewTimerService()
+	expiryWorkflow := expiry.NewWorkflow(cm, vmManager, p2pClient, filepath.Join(config.DefaultConfigDir(), "exports"))
+	destructionPipeline := destruction.NewPipeline(vmManager, p2pClient, pkManager, filepath.Join(config.DefaultConfigDir(), "receipts"))
+	services := expose.NewManager(vmManager, p2pClient, filepath.Join(config.DefaultConfigDir(), "services.json"))
 
 	ec := event.EventContext{
 		P2pClient:    p2pClient,
@@ -106,6 +161,11 @@ func NewContext() context2.CoreContext {
 		Cm:           cm,
 		ReportClient: reportClient,
 		TimerService: timeService,
+		PkManager:    pkManager,
+		Catalog:      catalog,
+		Expiry:       expiryWorkflow,
+		Destruction:  destructionPipeline,
+		Services:     services,
 	}
 
 	eventService := event.NewEventService(ec)
@@ -115,6 +175,12 @@ func NewContext() context2.CoreContext {
 		VmManager:     vmManager,
 		Cm:            cm,
 		PkManager:     pkManager,
+		Snapshots:     snapshot.NewManager(cm, vmManager),
+		Expiry:        expiryWorkflow,
+		Destruction:   destructionPipeline,
+		Services:      services,
+		Catalog:       catalog,
+		ImageCache:    imageCache,
 		ReportClient:  reportClient,
 		SubstrateApi:  substrateApi,
 		TimerService:  timeService,
@@ -123,6 +189,21 @@ func NewContext() context2.CoreContext {
 	}
 	return context
 }
+
+// registryAuths the credentials of the private registries the docker images are pulled from
+func registryAuths(registries []config.RegistryOption) []vm2.RegistryAuth {
+	var auths []vm2.RegistryAuth
+	for _, r := range registries {
+		auths = append(auths, vm2.RegistryAuth{
+			Server:        r.Server,
+			Username:      r.Username,
+			Password:      r.Password,
+			IdentityToken: r.IdentityToken,
+		})
+	}
+	return auths
+}
+
 func saveGatewayNodes(ctx context2.CoreContext) {
 	cfg, err := ctx.Cm.GetConfig()
 	if err != nil {
@@ -155,7 +236,7 @@ func saveGatewayNodes(ctx context2.CoreContext) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		err = config.NewConfigManagerWithPath(path).Save(cfg)
+		err = ctx.Cm.Save(cfg)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -17,7 +17,10 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/cosmos/go-bip39"
+	"github.com/hamster-shared/hamster-provider/core/modules/auth"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/keystore"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"os"
@@ -34,9 +37,28 @@ var initCmd = &cobra.Command{
 
 		path := config.DefaultConfigPath()
 
+		// the chain seed and the p2p private key are kept in the encrypted keystore
+		ksPath := keystore.DefaultPath(filepath.Dir(path))
+		if keystore.Exists(ksPath) {
+			log.Errorf("keystore %s already exists, remove it first or use `hamster-provider key import`", ksPath)
+			return
+		}
+		passphrase, err := keystore.ReadPassphrase(passphraseFile, true)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
 		cfg := getDefaultConfig()
 
-		err := os.MkdirAll(filepath.Dir(path), os.ModeDir)
+		// admin api token, only the hash is saved
+		token, apiToken, err := auth.GenerateToken("admin", config.RoleAdmin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Auth.Tokens = append(cfg.Auth.Tokens, apiToken)
+
+		err = os.MkdirAll(filepath.Dir(path), os.ModeDir)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -46,13 +68,22 @@ var initCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
+		ks, err := keystore.Create(ksPath, passphrase)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
 		// init config
 		log.Info("init context")
-		err = config.NewConfigManagerWithPath(path).Save(&cfg)
+		cm := config.NewConfigManagerWithPath(path)
+		cm.SetSecretStore(ks)
+		err = cm.Save(&cfg)
 		if err != nil {
 			log.Error(err)
 			return
 		}
+		fmt.Printf("\nadmin api token, keep it safe, it will not be shown again: %s\n", token)
 
 	},
 }
@@ -79,6 +110,12 @@ func getDefaultConfig() config.Config {
 		os.Exit(0)
 	}
 
+	seed, err := newMnemonic()
+	if err != nil {
+		log.Error("create chain seed error")
+		os.Exit(0)
+	}
+
 	return config.Config{
 		ApiPort:      10771,
 		Identity:     identity,
@@ -86,11 +123,24 @@ func getDefaultConfig() config.Config {
 		LinkApi:      CONFIG_DEFAULT_LINK_API,
 		ChainApi:     CONFIG_DEFAULT_CHAIN_API,
 		Vm:           getDockerDefaultConfig(),
-		SeedOrPhrase: "betray extend distance category chimney globe employ scrap armor success kiss forum",
+		SeedOrPhrase: seed,
 		ChainRegInfo: config.ChainRegInfo{},
 		ConfigFlag:   config.NONE,
 		Bootstraps:   []string{},
+		Auth: config.AuthOption{
+			Mode:   config.AuthToken,
+			Tokens: []config.ApiToken{},
+		},
+	}
+}
+
+// newMnemonic generate a random 12 words mnemonic for the chain account
+func newMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(128)
+	if err != nil {
+		return "", err
 	}
+	return bip39.NewMnemonic(entropy)
 }
 
 func getKvmDefaultConfig() config.VmOption {
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/keystore"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var passphraseFile string
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "manage the chain seed and the p2p private key in the encrypted keystore",
+}
+
+var (
+	importKeyCmd = &cobra.Command{
+		Use:       "import [seed|p2p] [file]",
+		Short:     "import the chain seed or the base64 p2p private key, read from the file or stdin",
+		Args:      cobra.RangeArgs(1, 2),
+		ValidArgs: []string{config.SecretSeed, config.SecretPrivKey},
+		Run: func(cmd *cobra.Command, args []string) {
+			secret, err := readKeyArg(args)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			cm, err := newConfigManager(true)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			switch args[0] {
+			case config.SecretSeed:
+				if _, err = signature.KeyringPairFromSecret(secret, c.Signer.Prefix()); err != nil {
+					fmt.Println("invalid seed:", err)
+					return
+				}
+				c.SeedOrPhrase = secret
+			case config.SecretPrivKey:
+				peerId, err := peerIdOfPrivKey(secret)
+				if err != nil {
+					fmt.Println("invalid p2p private key:", err)
+					return
+				}
+				c.Identity.PrivKey = secret
+				c.Identity.PeerID = peerId
+			default:
+				fmt.Println("unknown key:", args[0])
+				return
+			}
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("%s imported\n", args[0])
+		},
+	}
+
+	exportKeyCmd = &cobra.Command{
+		Use:       "export [seed|p2p]",
+		Short:     "print the chain seed or the base64 p2p private key",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{config.SecretSeed, config.SecretPrivKey},
+		Run: func(cmd *cobra.Command, args []string) {
+			cm, err := newConfigManager(false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			switch args[0] {
+			case config.SecretSeed:
+				fmt.Println(c.SeedOrPhrase)
+			case config.SecretPrivKey:
+				fmt.Println(c.Identity.PrivKey)
+			default:
+				fmt.Println("unknown key:", args[0])
+			}
+		},
+	}
+
+	migrateKeyCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "move the plaintext secrets of the config file into the keystore",
+		Run: func(cmd *cobra.Command, args []string) {
+			c, err := config.NewConfigManager().GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			cm, err := newConfigManager(true)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("secrets moved to", keystore.DefaultPath(config.DefaultConfigDir()))
+		},
+	}
+)
+
+// newConfigManager the config manager which keeps the secrets in the keystore, if the keystore
+// does not exist it is created when create is true, otherwise the plaintext config is used
+func newConfigManager(create bool) (*config.ConfigManager, error) {
+	cm := config.NewConfigManager()
+	path := keystore.DefaultPath(config.DefaultConfigDir())
+	if !keystore.Exists(path) && !create {
+		return cm, nil
+	}
+	passphrase, err := keystore.ReadPassphrase(passphraseFile, !keystore.Exists(path))
+	if err != nil {
+		return nil, err
+	}
+	var ks *keystore.Keystore
+	if keystore.Exists(path) {
+		ks, err = keystore.Open(path, passphrase)
+	} else {
+		ks, err = keystore.Create(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cm.SetSecretStore(ks)
+	return cm, nil
+}
+
+func readKeyArg(args []string) (string, error) {
+	if len(args) > 1 {
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return keystore.ReadSecret(fmt.Sprintf("%s: ", args[0]))
+}
+
+func peerIdOfPrivKey(privKey string) (string, error) {
+	skbytes, err := base64.StdEncoding.DecodeString(privKey)
+	if err != nil {
+		return "", err
+	}
+	priv, err := crypto.UnmarshalPrivateKey(skbytes)
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return id.Pretty(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(importKeyCmd, exportKeyCmd, migrateKeyCmd)
+	rootCmd.PersistentFlags().StringVar(&passphraseFile, "passphrase-file", "", "file containing the keystore passphrase")
+}
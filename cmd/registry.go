@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/keystore"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var (
+	registryUsername     string
+	registryPasswordFile string
+	registryToken        bool
+)
+
+// registryCmd represents the registry command
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "manage the credentials of the private docker registries, used by the daemon after a restart",
+}
+
+var (
+	lsRegistryCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "list the registries with credentials",
+		Run: func(cmd *cobra.Command, args []string) {
+			c, err := config.NewConfigManager().GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, r := range c.Registries {
+				fmt.Printf("%s\t%s\n", r.Server, r.Username)
+			}
+		},
+	}
+	loginRegistryCmd = &cobra.Command{
+		Use:   "login [server]",
+		Short: "save the credentials of the registry, the password is read from the file or the terminal",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			secret, err := readRegistrySecret()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			cm, err := newConfigManager(false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			registry := config.RegistryOption{Server: args[0], Username: registryUsername}
+			if registryToken {
+				registry.IdentityToken = secret
+			} else {
+				registry.Password = secret
+			}
+			c.Registries = append(removeRegistry(c.Registries, args[0]), registry)
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("registry saved:", args[0])
+		},
+	}
+	logoutRegistryCmd = &cobra.Command{
+		Use:   "logout [server]",
+		Short: "remove the credentials of the registry",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cm, err := newConfigManager(false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			registries := removeRegistry(c.Registries, args[0])
+			if len(registries) == len(c.Registries) {
+				fmt.Println("registry not found:", args[0])
+				return
+			}
+			c.Registries = registries
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("registry removed:", args[0])
+		},
+	}
+)
+
+func readRegistrySecret() (string, error) {
+	if registryPasswordFile != "" {
+		data, err := os.ReadFile(registryPasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return keystore.ReadSecret("password: ")
+}
+
+func removeRegistry(registries []config.RegistryOption, server string) []config.RegistryOption {
+	var left []config.RegistryOption
+	for _, r := range registries {
+		if r.Server != server {
+			left = append(left, r)
+		}
+	}
+	return left
+}
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+	registryCmd.AddCommand(lsRegistryCmd, loginRegistryCmd, logoutRegistryCmd)
+	loginRegistryCmd.Flags().StringVarP(&registryUsername, "username", "u", "", "user name of the registry")
+	loginRegistryCmd.Flags().StringVar(&registryPasswordFile, "password-file", "", "file containing the password or the token")
+	loginRegistryCmd.Flags().BoolVar(&registryToken, "identity-token", false, "the secret is an oauth identity token instead of a password")
+}
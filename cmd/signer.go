@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/chain"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/spf13/cobra"
+	"net/http"
+)
+
+var (
+	signerUrl     string
+	signerToken   string
+	signerAddress string
+	signerPrefix  int
+	signerListen  string
+	coldUrl       string
+	coldToken     string
+)
+
+// signerCmd represents the signer command
+var signerCmd = &cobra.Command{
+	Use:   "signer",
+	Short: "choose how the chain transactions are signed",
+}
+
+var (
+	setSignerCmd = &cobra.Command{
+		Use:       "set [keystore|remote|watch]",
+		Short:     "sign with the local keystore, a remote signer, or run watch only",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{string(config.SignerKeystore), string(config.SignerRemote), string(config.SignerWatchOnly)},
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			option := config.SignerOption{
+				Type:       config.SignerType(args[0]),
+				Ss58Prefix: c.Signer.Ss58Prefix,
+			}
+			if cmd.Flags().Changed("prefix") {
+				if signerPrefix < 0 || signerPrefix > 63 {
+					fmt.Println("ss58 prefix must be between 0 and 63")
+					return
+				}
+				prefix := uint8(signerPrefix)
+				option.Ss58Prefix = &prefix
+			}
+			switch option.Type {
+			case config.SignerKeystore:
+			case config.SignerRemote:
+				if signerUrl == "" {
+					fmt.Println("--url is required by the remote signer")
+					return
+				}
+				option.RemoteUrl = signerUrl
+				option.RemoteToken = signerToken
+			case config.SignerWatchOnly:
+				if _, _, err = chain.DecodeSs58Address(signerAddress); err != nil {
+					fmt.Println(err)
+					return
+				}
+				option.Address = signerAddress
+			default:
+				fmt.Println("unknown signer:", args[0])
+				return
+			}
+			c.Signer = option
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("signer set to", option.Type)
+		},
+	}
+
+	addressSignerCmd = &cobra.Command{
+		Use:   "address",
+		Short: "print the address of the signing account",
+		Run: func(cmd *cobra.Command, args []string) {
+			cm, err := newConfigManager(false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			signer, err := chain.NewSigner(cm)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			address, err := signer.Address()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(address)
+		},
+	}
+
+	proxySignerCmd = &cobra.Command{
+		Use:   "proxy",
+		Short: "sign the routine calls as the proxy of the staking account",
+	}
+
+	setProxySignerCmd = &cobra.Command{
+		Use:   "set [staking address]",
+		Short: "act as the proxy of the staking account, funds moving calls use the cold signer or wait for approval",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, _, err := chain.DecodeSs58Address(args[0]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c.Proxy = config.ProxyOption{Real: args[0]}
+			if coldUrl != "" {
+				c.Proxy.ColdSigner = config.SignerOption{
+					Type:        config.SignerRemote,
+					RemoteUrl:   coldUrl,
+					RemoteToken: coldToken,
+				}
+			}
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("proxy of", args[0])
+		},
+	}
+
+	rmProxySignerCmd = &cobra.Command{
+		Use:   "rm",
+		Short: "sign all the calls with the signer account itself",
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			c.Proxy = config.ProxyOption{}
+			if err = cm.Save(c); err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+
+	serveSignerCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "serve the remote signer api with the local keystore",
+		Run: func(cmd *cobra.Command, args []string) {
+			cm, err := newConfigManager(false)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			signer := chain.NewKeystoreSigner(cm)
+			handler, err := chain.NewSignerHandler(signer, signerToken)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			address, err := signer.Address()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("signing as %s on %s\n", address, signerListen)
+			if err = http.ListenAndServe(signerListen, handler); err != nil {
+				fmt.Println(err)
+			}
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(signerCmd)
+	signerCmd.AddCommand(setSignerCmd, addressSignerCmd, proxySignerCmd, serveSignerCmd)
+	proxySignerCmd.AddCommand(setProxySignerCmd, rmProxySignerCmd)
+	setSignerCmd.Flags().StringVar(&signerUrl, "url", "", "remote signer address")
+	setSignerCmd.Flags().StringVar(&signerToken, "token", "", "remote signer bearer token")
+	setSignerCmd.Flags().StringVar(&signerAddress, "address", "", "ss58 address of the watched account")
+	setSignerCmd.Flags().IntVar(&signerPrefix, "prefix", int(config.DefaultSs58Prefix), "ss58 address prefix of the chain")
+	setProxySignerCmd.Flags().StringVar(&coldUrl, "cold-url", "", "remote signer of the staking account, signs the funds moving calls")
+	setProxySignerCmd.Flags().StringVar(&coldToken, "cold-token", "", "bearer token of the cold signer")
+	serveSignerCmd.Flags().StringVar(&signerListen, "listen", "127.0.0.1:10772", "listen address, keep it on a trusted network")
+	serveSignerCmd.Flags().StringVar(&signerToken, "token", "", "bearer token required from the clients")
+}
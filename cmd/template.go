@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
+	"github.com/spf13/cobra"
+)
+
+var templateOption config.TemplateOption
+
+// templateCmd represents the template command
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "manage the template catalog offered to the tenants",
+}
+
+var (
+	lsTemplateCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "list the templates, the default template is marked with *",
+		Run: func(cmd *cobra.Command, args []string) {
+			cm := config.NewConfigManager()
+			c, err := cm.GetConfig()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			templates, err := template.NewCatalog(cm).List()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			for _, t := range templates {
+				mark := " "
+				if t.Name == c.Vm.Template || len(c.Templates) == 0 {
+					mark = "*"
+				}
+				tier := ""
+				if template.Hardened(t, c.Vm.Type) {
+					tier = "\thardened"
+				}
+				fmt.Printf("%s %s\t%s\t%s\tcpu %s\tmem %s\tdisk %s\tport %d%s\n", mark, t.Name, t.System, t.Image,
+					limit(t.MinCpu, t.MaxCpu), limit(t.MinMem, t.MaxMem), limit(t.MinDisk, t.MaxDisk), t.AccessPort, tier)
+			}
+		},
+	}
+	addTemplateCmd = &cobra.Command{
+		Use:   "add [name]",
+		Short: "add or replace a template",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			templateOption.Name = args[0]
+			if err := template.NewCatalog(config.NewConfigManager()).Save(templateOption); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("template saved:", args[0])
+		},
+	}
+	rmTemplateCmd = &cobra.Command{
+		Use:   "rm [name]",
+		Short: "remove a template",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := template.NewCatalog(config.NewConfigManager()).Remove(args[0]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("template removed:", args[0])
+		},
+	}
+	defaultTemplateCmd = &cobra.Command{
+		Use:   "default [name]",
+		Short: "use the template for the orders not choosing one",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := template.NewCatalog(config.NewConfigManager()).SetDefault(args[0]); err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("default template:", args[0])
+		},
+	}
+)
+
+// limit format the min and max of a template, 0 is unlimited
+func limit(min, max uint64) string {
+	format := func(v uint64) string {
+		if v == 0 {
+			return "-"
+		}
+		return fmt.Sprint(v)
+	}
+	return format(min) + ".." + format(max)
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(lsTemplateCmd, addTemplateCmd, rmTemplateCmd, defaultTemplateCmd)
+	addTemplateCmd.Flags().StringVar(&templateOption.Image, "image", "", "docker image or url of the kvm base image")
+	addTemplateCmd.Flags().StringVar(&templateOption.Sha256, "sha256", "", "hex sha256 of the kvm base image verified after download, or the digest the docker image is pinned to")
+	addTemplateCmd.Flags().StringVar(&templateOption.System, "system", "", "system label shown to the tenants")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MinCpu, "min-cpu", 0, "minimum cores")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MaxCpu, "max-cpu", 0, "maximum cores")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MinMem, "min-mem", 0, "minimum memory in GB")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MaxMem, "max-mem", 0, "maximum memory in GB")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MinDisk, "min-disk", 0, "minimum disk in GB")
+	addTemplateCmd.Flags().Uint64Var(&templateOption.MaxDisk, "max-disk", 0, "maximum disk in GB")
+	addTemplateCmd.Flags().IntVar(&templateOption.AccessPort, "port", 22, "ssh port inside the instance")
+	addTemplateCmd.Flags().StringVar(&templateOption.Runtime, "runtime", "", "oci runtime of the docker containers, like runsc or kata-runtime")
+	addTemplateCmd.Flags().StringVar(&templateOption.Seccomp, "seccomp", "", "seccomp profile file of the docker containers")
+	addTemplateCmd.Flags().StringVar(&templateOption.AppArmor, "apparmor", "", "apparmor profile of the docker containers")
+	addTemplateCmd.Flags().StringSliceVar(&templateOption.CapDrop, "cap-drop", nil, "capabilities dropped from the docker containers")
+	_ = addTemplateCmd.MarkFlagRequired("image")
+}
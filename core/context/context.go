@@ -2,12 +2,18 @@ package context
 
 import (
 	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
 	"github.com/hamster-shared/hamster-provider/core/modules/chain"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
 	"github.com/hamster-shared/hamster-provider/core/modules/event"
+	"github.com/hamster-shared/hamster-provider/core/modules/expiry"
+	"github.com/hamster-shared/hamster-provider/core/modules/expose"
 	"github.com/hamster-shared/hamster-provider/core/modules/listener"
 	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
 	"github.com/hamster-shared/hamster-provider/core/modules/pk"
+	"github.com/hamster-shared/hamster-provider/core/modules/snapshot"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	"github.com/hamster-shared/hamster-provider/core/modules/vm"
 )
@@ -18,6 +24,12 @@ type CoreContext struct {
 	VmManager     vm.Manager
 	Cm            *config.ConfigManager
 	PkManager     *pk.Manager
+	Snapshots     *snapshot.Manager
+	Expiry        *expiry.Workflow
+	Destruction   *destruction.Pipeline
+	Services      *expose.Manager
+	Catalog       *template.Catalog
+	ImageCache    *cache.ImageCache
 	ReportClient  chain.ReportClient
 	SubstrateApi  *gsrpc.SubstrateAPI
 	TimerService  *utils.TimerService
@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"github.com/gin-contrib/static"
 	"github.com/hamster-shared/hamster-provider/core/context"
+	"github.com/hamster-shared/hamster-provider/core/modules/auth"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"net/http"
 )
 
 func StartApi(ctx *context.CoreContext) error {
 	r := NewMyServer(ctx)
 	// router
 	v1 := r.Group("/api/v1")
+	v1.Use(audit(auth.NewAuditLogger(auth.DefaultAuditLogPath(config.DefaultConfigDir()))), authenticate)
 	{
 
 		// basic configuration
@@ -30,19 +34,47 @@ func StartApi(ctx *context.CoreContext) error {
 			chain.POST("/withdraw-amount", withdrawAmount)
 			chain.POST("/price", changeUnitPrice)
 		}
-		// container routing
-		container := v1.Group("/container")
+		// order instance routing
+		instances := v1.Group("/instances")
 		{
-			container.GET("/start", startContainer)
-			container.GET("/delete", deleteContainer)
+			instances.GET("", listInstances)
+			// readable after the agreement ends, the data export and the destruction receipt are announced in them
+			instances.GET("/:order/expiry", getInstanceExpiry)
+			instances.GET("/:order/destruction", getInstanceDestruction)
+			instance := instances.Group("/:order", agreementRequired)
+			{
+				instance.GET("", getInstance)
+				instance.POST("/stop", stopInstance)
+				instance.POST("/start", startInstance)
+				instance.POST("/reboot", rebootInstance)
+				instance.POST("/resize", resizeInstance)
+				instance.GET("/console", getInstanceConsole)
+				instance.GET("/keys", listInstanceKeys)
+				instance.POST("/keys", addInstanceKey)
+				instance.POST("/keys/remove", removeInstanceKey)
+				instance.POST("/keys/sync", syncInstanceKeys)
+				instance.GET("/snapshots", listInstanceSnapshots)
+				instance.POST("/snapshots", createInstanceSnapshot)
+				instance.POST("/snapshots/restore", restoreInstanceSnapshot)
+				instance.POST("/snapshots/remove", removeInstanceSnapshot)
+				instance.GET("/ports", listInstancePorts)
+				instance.POST("/ports", exposeInstancePorts)
+				instance.POST("/ports/remove", closeInstancePorts)
+			}
 		}
 
-		pk := v1.Group("/pk")
-		// publick key
+		// template catalog
+		templates := v1.Group("/templates")
 		{
-			pk.POST("/grantKey", grantKey)
-			pk.POST("/deleteKey", deleteKey)
-			pk.POST("/queryKey", queryKey)
+			templates.GET("", listTemplates)
+			templates.POST("", saveTemplate)
+			templates.POST("/remove", removeTemplate)
+			templates.POST("/default", setDefaultTemplate)
+		}
+		// image downloads
+		images := v1.Group("/images")
+		{
+			images.GET("/downloads", listImageDownloads)
 		}
 
 		p2p := v1.Group("/p2p")
@@ -54,10 +86,6 @@ func StartApi(ctx *context.CoreContext) error {
 			p2p.POST("/close", closeP2p)
 			p2p.POST("/check", checkP2p)
 		}
-		vm := v1.Group("/vm")
-		{
-			vm.POST("/create", createVm)
-		}
 		resource := v1.Group("/resource")
 		{
 			resource.POST("/modify-price", modifyPrice)
@@ -72,6 +100,19 @@ func StartApi(ctx *context.CoreContext) error {
 
 	r.Use(static.Serve("/", static.LocalFile("./frontend/dist", false)))
 	// listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
-	port := ctx.GetConfig().ApiPort
-	return r.Run(fmt.Sprintf("0.0.0.0:%d", port))
+	cfg := ctx.GetConfig()
+	addr := fmt.Sprintf("0.0.0.0:%d", cfg.ApiPort)
+	if cfg.Auth.Mode == config.AuthMTLS {
+		tlsConfig, err := newMTLSConfig(cfg.Auth)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{
+			Addr:      addr,
+			Handler:   r,
+			TLSConfig: tlsConfig,
+		}
+		return server.ListenAndServeTLS(cfg.Auth.CertFile, cfg.Auth.KeyFile)
+	}
+	return r.Run(addr)
 }
@@ -0,0 +1,110 @@
+package corehttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/auth"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	identityKey = "identity"
+	roleKey     = "role"
+)
+
+// authenticate identify the caller by api token or client certificate and check the role scope
+func authenticate(c *MyContext) {
+	cfg := c.CoreContext.GetConfig()
+	if cfg == nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, BadRequest("config not initialized"))
+		return
+	}
+	identity, role, err := caller(c, cfg.Auth)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, BadRequest(err.Error()))
+		return
+	}
+	c.Set(identityKey, identity)
+	c.Set(roleKey, string(role))
+	if !auth.Allowed(role, c.Request.Method) {
+		c.AbortWithStatusJSON(http.StatusForbidden, BadRequest(fmt.Sprintf("role %s is not allowed to %s %s", role, c.Request.Method, c.FullPath())))
+		return
+	}
+	c.Next()
+}
+
+func caller(c *MyContext, option config.AuthOption) (string, config.Role, error) {
+	if option.Mode == config.AuthMTLS {
+		if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+			return "", "", errors.New("client certificate required")
+		}
+		cert := c.Request.TLS.PeerCertificates[0]
+		role, ok := auth.CertificateRole(cert)
+		if !ok {
+			return "", "", errors.New("client certificate has no role")
+		}
+		return "cert:" + cert.Subject.CommonName, role, nil
+	}
+
+	if len(option.Tokens) == 0 {
+		return "", "", errors.New("no api token configured, please run `hamster-provider config token create`")
+	}
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", "", errors.New("api token required")
+	}
+	token, ok := auth.MatchToken(option.Tokens, strings.TrimPrefix(header, "Bearer "))
+	if !ok {
+		return "", "", errors.New("invalid api token")
+	}
+	return "token:" + token.Name, token.Role, nil
+}
+
+// audit record every mutating request, including the rejected ones
+func audit(logger *auth.AuditLogger) HandlerFunc {
+	return func(c *MyContext) {
+		c.Next()
+		if !auth.IsMutating(c.Request.Method) {
+			return
+		}
+		err := logger.Record(auth.AuditRecord{
+			Time:     time.Now(),
+			Identity: c.GetString(identityKey),
+			Role:     c.GetString(roleKey),
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			ClientIp: c.ClientIP(),
+			Status:   c.Writer.Status(),
+		})
+		if err != nil {
+			logrus.Errorf("write audit log fail: %s", err)
+		}
+	}
+}
+
+// newMTLSConfig tls config which requires client certificates signed by the client CA
+func newMTLSConfig(option config.AuthOption) (*tls.Config, error) {
+	if option.CertFile == "" || option.KeyFile == "" || option.ClientCA == "" {
+		return nil, errors.New("mtls requires certFile, keyFile and clientCa")
+	}
+	ca, err := os.ReadFile(option.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s", option.ClientCA)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
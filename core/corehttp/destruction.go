@@ -0,0 +1,35 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
+	"net/http"
+	"strconv"
+)
+
+// @Summary get instance destruction receipt
+// @Description the receipt of the destruction of the instance of the order, it lists the steps taken and
+// @Description what remained when the instance could not be destroyed completely
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/destruction [GET]
+func getInstanceDestruction(c *MyContext) {
+	orderNo, err := strconv.ParseUint(c.Param("order"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("Incorrect order format: %s", c.Param("order"))))
+		return
+	}
+	receipt, err := c.CoreContext.Destruction.Receipt(orderNo)
+	if errors.Is(err, destruction.ErrReceiptNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("read destruction receipt fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(receipt))
+}
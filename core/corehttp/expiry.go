@@ -0,0 +1,30 @@
+package corehttp
+
+import (
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"net/http"
+	"strconv"
+)
+
+// @Summary get instance expiry
+// @Description the expiry workflow of the instance of the order, after the end of the agreement it tells
+// @Description how to download the data volume before the instance is destroyed
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/expiry [GET]
+func getInstanceExpiry(c *MyContext) {
+	orderNo, err := strconv.ParseUint(c.Param("order"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("Incorrect order format: %s", c.Param("order"))))
+		return
+	}
+	status, ok := c.CoreContext.Expiry.Status(vm.InstanceName(orderNo))
+	if !ok {
+		c.JSON(http.StatusNotFound, BadRequest("the instance has no expiry workflow"))
+		return
+	}
+	c.JSON(http.StatusOK, Success(status))
+}
@@ -1,18 +1,17 @@
 package corehttp
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/hamster-shared/hamster-provider/core/modules/chain"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
 )
 
-type Keys struct {
-	PublicKey string `json:"public_key"`
-}
-
 type ChangePrice struct {
 	Price uint64 `json:"price"`
 }
@@ -21,125 +20,6 @@ type AddDuration struct {
 	Duration uint16 `json:"duration"`
 }
 
-// @Summary startContainer
-// @Description startContainer
-// @Tags containerOperation
-// @Accept json
-// @Produce json
-// @Success 200 {string} startContainer
-// @Router /container/start [get]
-func startContainer(c *MyContext) {
-
-	name := c.Query("name")
-	if err := c.CoreContext.VmManager.Start(name); err != nil {
-		c.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-	c.String(http.StatusOK, "start container success")
-}
-
-// @Summary delete container
-// @Description delete container
-// @Tags containerOperation
-// @Accept json
-// @Produce json
-// @Success 200 {string} deleteContainer
-// @Router /container/delete [get]
-func deleteContainer(c *MyContext) {
-
-	name := c.Query("name")
-	if err := c.CoreContext.VmManager.Destroy(name); err != nil {
-		c.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-	c.String(http.StatusOK, "delete container success")
-}
-
-// @Summary grant key
-// @Description grant key
-// @Tags key operation
-// @Accept json
-// @Produce json
-// @Param param body Keys true "the key need upload"
-// @Success 200 {string} grantKey
-// @Router /pk/grantKey [POST]
-func grantKey(gin *MyContext) {
-
-	name := gin.Query("name")
-	json := Keys{}
-	if err := gin.BindJSON(&json); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	if err := gin.CoreContext.PkManager.AddPublicKey(json.PublicKey); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	if err := gin.CoreContext.VmManager.InjectionPublicKey(name, json.PublicKey); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	gin.String(http.StatusOK, "you public key is :%s\n", json.PublicKey)
-	gin.String(http.StatusOK, "public key upload success \n")
-}
-
-// @Summary delete key
-// @Description delete key
-// @Tags key operation
-// @Accept json
-// @Produce json
-// @Param param body Keys true "the key want delete"
-// @Success 200 {string} grantKey
-// @Router /pk/deleteKey [POST]
-func deleteKey(gin *MyContext) {
-
-	json := Keys{}
-	if err := gin.BindJSON(&json); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	if err := gin.CoreContext.PkManager.DeletePublicKey(json.PublicKey); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-	gin.String(http.StatusOK, "the key you want delete is :%s\n", json.PublicKey)
-	gin.String(http.StatusOK, "the key delete success\n")
-}
-
-// @Summary query key
-// @Description uery key
-// @Tags key operation
-// @Accept json
-// @Produce json
-// @Param param body Keys true "the key you want query"
-// @Success 200 {string} queryKey
-// @Router /pk/queryKey [POST]
-func queryKey(gin *MyContext) {
-	json := Keys{}
-	if err := gin.BindJSON(&json); err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	res, err := gin.CoreContext.PkManager.QueryPublicKey(json.PublicKey)
-	if err != nil {
-		gin.String(http.StatusBadRequest, "err:%v", err)
-		return
-	}
-
-	gin.String(http.StatusOK, "the key you query is :%s\n", json.PublicKey)
-
-	if res == true {
-		gin.String(http.StatusOK, "the key you query is  exists")
-	} else {
-		gin.String(http.StatusOK, "the key you query is not exists")
-	}
-}
-
 // @Summary p2p port listen
 // @Description p2p port listen
 // @Tags p2p
@@ -200,8 +80,10 @@ func forwardP2p(gin *MyContext) {
 	}
 
 	targetPeerId := gin.Query("peerId")
+	// the ssh of the peer by default, /x/hamster/{order}/{port} for a service port of an instance
+	protocol := gin.DefaultQuery("protocol", "/x/ssh")
 
-	err = gin.CoreContext.P2pClient.Forward(port, targetPeerId)
+	err = gin.CoreContext.P2pClient.ForwardProtocol(protocol, port, targetPeerId)
 	if err != nil {
 		logrus.Error("p2p port create fail")
 		gin.String(400, "p2p port create fail")
@@ -263,19 +145,6 @@ func checkP2p(gin *MyContext) {
 	}
 }
 
-// createVm create virtual machine
-func createVm(gin *MyContext) {
-	name := gin.Query("name")
-	manage := gin.CoreContext.VmManager
-	logrus.Info("create virtual machine  start")
-	_, err := manage.Create(name)
-	logrus.Info("create virtual machine  end")
-	if err != nil {
-		logrus.Error("create virtual machine  fail")
-		fmt.Println(err)
-	}
-}
-
 func modifyPrice(gin *MyContext) {
 	reportClient := gin.CoreContext.ReportClient
 	var json = ChangePrice{}
@@ -309,8 +178,21 @@ func addDuration(gin *MyContext) {
 	}
 }
 
+// approvalRequired respond the call data when the funds moving call waits for the staking account
+func approvalRequired(gin *MyContext, err error) bool {
+	var approval *chain.ApprovalRequiredError
+	if !errors.As(err, &approval) {
+		return false
+	}
+	gin.JSON(http.StatusAccepted, Success(approval))
+	return true
+}
+
 func receiveIncome(gin *MyContext) {
 	err := gin.CoreContext.ReportClient.ReceiveIncome()
+	if approvalRequired(gin, err) {
+		return
+	}
 	if err != nil {
 		gin.JSON(http.StatusBadRequest, BadRequest("Failed to receive benefits"))
 	} else {
@@ -323,37 +205,85 @@ func getConfig(gin *MyContext) {
 	if cfg.Bootstraps == nil {
 		cfg.Bootstraps = []string{}
 	}
+	redactConfig(cfg)
 	gin.JSON(http.StatusOK, Success(cfg))
 }
 
-func setConfig(gin *MyContext) {
-	cfg := gin.CoreContext.GetConfig()
-	reqBody := config.Config{}
-	if err := gin.BindJSON(&reqBody); err != nil {
-		gin.JSON(http.StatusBadRequest, BadRequest())
-		return
-	}
+// redacted replaces a secret that is set in the returned config
+const redacted = "******"
+
+// redactConfig never expose the secrets, the keystore backed ones are masked so the ui can tell they are set
+func redactConfig(cfg *config.Config) {
+	cfg.SeedOrPhrase = ""
+	cfg.Identity.PrivKey = ""
+	registries := make([]config.RegistryOption, len(cfg.Registries))
+	for i, r := range cfg.Registries {
+		r.Password = redact(r.Password)
+		r.IdentityToken = redact(r.IdentityToken)
+		registries[i] = r
+	}
+	cfg.Registries = registries
+	cfg.Signer.RemoteToken = redact(cfg.Signer.RemoteToken)
+	cfg.Proxy.ColdSigner.RemoteToken = redact(cfg.Proxy.ColdSigner.RemoteToken)
+}
 
-	cfg.Vm = reqBody.Vm
-	cfg.ChainApi = reqBody.ChainApi
-	// 校验seed 是否合法
-	_, err := signature.KeyringPairFromSecret(reqBody.SeedOrPhrase, 42)
-	if err != nil {
-		gin.JSON(http.StatusBadRequest, BadRequest("seed not invalid"))
-		return
+func redact(secret string) string {
+	if secret == "" {
+		return ""
 	}
+	return redacted
+}
 
-	cfg.SeedOrPhrase = reqBody.SeedOrPhrase
-	cfg.ConfigFlag = config.DONE
-	cfg.Bootstraps = reqBody.Bootstraps
+// keepSecret an empty or redacted value posted back keeps the stored secret
+func keepSecret(posted string) bool {
+	return posted == "" || posted == redacted
+}
 
-	err = gin.CoreContext.Cm.Save(cfg)
+var (
+	errConfigBody = errors.New("invalid config")
+	errConfigSeed = errors.New("seed not invalid")
+)
+
+func setConfig(gin *MyContext) {
+	body, err := gin.GetRawData()
 	if err != nil {
-		gin.JSON(http.StatusBadRequest, BadRequest("save config fail"))
+		gin.JSON(http.StatusBadRequest, BadRequest())
 		return
 	}
 
-	gin.JSON(http.StatusOK, Success(""))
+	err = gin.CoreContext.Cm.Update(func(cfg *config.Config) error {
+		// decode onto the stored vm option, the settings the ui does not post are kept
+		reqBody := config.Config{Vm: cfg.Vm}
+		if err := json.Unmarshal(body, &reqBody); err != nil {
+			return errConfigBody
+		}
+
+		cfg.Vm = reqBody.Vm
+		cfg.ChainApi = reqBody.ChainApi
+		// the seed is write only, keep the old one when it is empty.
+		// the registries, the signer and the proxy are only set by the cli, the redacted ones posted back are ignored
+		if !keepSecret(reqBody.SeedOrPhrase) {
+			// 校验seed 是否合法
+			if _, err := signature.KeyringPairFromSecret(reqBody.SeedOrPhrase, cfg.Signer.Prefix()); err != nil {
+				return errConfigSeed
+			}
+			cfg.SeedOrPhrase = reqBody.SeedOrPhrase
+		}
+
+		cfg.ConfigFlag = config.DONE
+		cfg.Bootstraps = reqBody.Bootstraps
+		return nil
+	})
+	switch err {
+	case nil:
+		gin.JSON(http.StatusOK, Success(""))
+	case errConfigBody:
+		gin.JSON(http.StatusBadRequest, BadRequest())
+	case errConfigSeed:
+		gin.JSON(http.StatusBadRequest, BadRequest(err.Error()))
+	default:
+		gin.JSON(http.StatusBadRequest, BadRequest("save config fail"))
+	}
 }
 
 func setBootState(gin *MyContext) {
@@ -471,6 +401,9 @@ func stakingAmount(gin *MyContext) {
 		return
 	}
 	err = gin.CoreContext.ReportClient.StakingAmount(int64(json.Price))
+	if approvalRequired(gin, err) {
+		return
+	}
 	if err != nil {
 		gin.JSON(http.StatusBadRequest, BadRequest("The pledge amount failed"))
 	} else {
@@ -486,6 +419,9 @@ func withdrawAmount(gin *MyContext) {
 		return
 	}
 	err = gin.CoreContext.ReportClient.WithdrawStakingAmount(int64(json.Price))
+	if approvalRequired(gin, err) {
+		return
+	}
 	if err != nil {
 		gin.JSON(http.StatusBadRequest, BadRequest("Failed to retrieve the pledge amount"))
 	} else {
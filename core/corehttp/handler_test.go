@@ -0,0 +1,79 @@
+package corehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/hamster-shared/hamster-provider/core/context"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func serveConfig(t *testing.T, cfg *config.Config) (*gin.Engine, *config.ConfigManager) {
+	gin.SetMode(gin.TestMode)
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(cfg))
+	ctx := &context.CoreContext{Cm: cm}
+	r := gin.New()
+	r.GET("/config", handleFunc(getConfig, ctx))
+	r.POST("/config", handleFunc(setConfig, ctx))
+	return r, cm
+}
+
+func TestConfigRedacted(t *testing.T) {
+	r, cm := serveConfig(t, &config.Config{
+		SeedOrPhrase: "//Alice",
+		Registries:   []config.RegistryOption{{Server: "registry.example.com", Username: "u", Password: "secret", IdentityToken: "token"}},
+		Signer:       config.SignerOption{Type: "remote", RemoteUrl: "http://signer", RemoteToken: "signer-token"},
+		Proxy:        config.ProxyOption{ColdSigner: config.SignerOption{Type: "remote", RemoteUrl: "http://cold", RemoteToken: "cold-token"}},
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.NotContains(t, w.Body.String(), "token\"")
+	assert.NotContains(t, w.Body.String(), "Alice")
+	assert.NotContains(t, w.Body.String(), "signer-token")
+	assert.NotContains(t, w.Body.String(), "cold-token")
+
+	var res struct {
+		Result config.Config `json:"result"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, redacted, res.Result.Registries[0].Password)
+
+	// the redacted config posted back keeps the stored secrets
+	body, _ := json.Marshal(res.Result)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	cfg, err := cm.GetConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "//Alice", cfg.SeedOrPhrase)
+	assert.Equal(t, "secret", cfg.Registries[0].Password)
+	assert.Equal(t, "token", cfg.Registries[0].IdentityToken)
+	assert.Equal(t, "signer-token", cfg.Signer.RemoteToken)
+	assert.Equal(t, "cold-token", cfg.Proxy.ColdSigner.RemoteToken)
+}
+
+func TestSetConfigKeepsVm(t *testing.T) {
+	r, cm := serveConfig(t, &config.Config{Vm: config.VmOption{
+		Cpu: 1, Type: "firecracker", DataPath: "-", Template: "small", Packages: []string{"git"},
+	}})
+	// the fields the initialization page posts
+	body := `{"vm":{"cpu":2,"mem":4,"disk":50,"system":"ubuntu","image":"ubuntu:20.04","accessPort":22,"type":"firecracker"}}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cfg, err := cm.GetConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), cfg.Vm.Cpu)
+	assert.Equal(t, "-", cfg.Vm.DataPath)
+	assert.Equal(t, "small", cfg.Vm.Template)
+	assert.Equal(t, []string{"git"}, cfg.Vm.Packages)
+}
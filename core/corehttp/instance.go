@@ -0,0 +1,256 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/chain"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+const (
+	orderNoKey         = "orderNo"
+	defaultConsoleTail = 100
+)
+
+var errInstanceNotFound = errors.New("the instance does not exist")
+
+// agreementRequired only allow operations on the orders of this resource whose agreement is valid
+func agreementRequired(c *MyContext) {
+	orderNo, err := strconv.ParseUint(c.Param("order"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("Incorrect order format: %s", c.Param("order"))))
+		return
+	}
+	reportClient := c.CoreContext.ReportClient
+	order, err := reportClient.GetOrder(orderNo)
+	if errors.Is(err, chain.ErrOrderNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, BadRequest("order not found"))
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, BadRequest(fmt.Sprintf("query order fail: %s", err)))
+		return
+	}
+	if uint64(order.ResourceIndex) != c.CoreContext.GetConfig().ChainRegInfo.ResourceIndex {
+		c.AbortWithStatusJSON(http.StatusForbidden, BadRequest("order does not belong to this resource"))
+		return
+	}
+	if !order.AgreementIndex.IsSome() {
+		c.AbortWithStatusJSON(http.StatusForbidden, BadRequest("order has no agreement"))
+		return
+	}
+	overdue, err := reportClient.InstanceOverdue(orderNo)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, BadRequest(fmt.Sprintf("query agreement fail: %s", err)))
+		return
+	}
+	if overdue <= 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, BadRequest("agreement has expired"))
+		return
+	}
+	c.Set(orderNoKey, orderNo)
+	c.Next()
+}
+
+func orderInstanceName(c *MyContext) string {
+	return vm.InstanceName(c.GetUint64(orderNoKey))
+}
+
+func instanceInfo(c *MyContext, name string) (*vm.InstanceInfo, error) {
+	manager := c.CoreContext.VmManager
+	status, err := manager.Status(name)
+	if err != nil {
+		return nil, err
+	}
+	// the kvm backend returns no status for a missing domain
+	if status == nil {
+		return nil, errInstanceNotFound
+	}
+	orderNo, _ := vm.ParseInstanceName(name)
+	info := &vm.InstanceInfo{
+		OrderNo: orderNo,
+		Name:    name,
+		Status:  status.String(),
+		User:    vm.TenantUser{Name: c.CoreContext.GetConfig().Vm.User.Name}.LoginName(),
+	}
+	if status.IsRunning() {
+		info.Ip, _ = manager.GetIp(name)
+		info.AccessPort = manager.GetAccessPort(name)
+	}
+	return info, nil
+}
+
+// @Summary list instances
+// @Description list the order instances of this provider
+// @Tags instance
+// @Produce json
+// @Success 200 {object} Result
+// @Router /instances [GET]
+func listInstances(c *MyContext) {
+	names, err := c.CoreContext.VmManager.List()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("list instances fail: %s", err)))
+		return
+	}
+	instances := []*vm.InstanceInfo{}
+	for _, name := range names {
+		info, err := instanceInfo(c, name)
+		if err != nil {
+			continue
+		}
+		instances = append(instances, info)
+	}
+	c.JSON(http.StatusOK, Success(instances))
+}
+
+// @Summary get instance
+// @Description get the instance of the order
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order} [GET]
+func getInstance(c *MyContext) {
+	info, err := instanceInfo(c, orderInstanceName(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, BadRequest(fmt.Sprintf("instance not found: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(info))
+}
+
+// @Summary stop instance
+// @Description stop the instance of the order
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/stop [POST]
+func stopInstance(c *MyContext) {
+	if err := c.CoreContext.VmManager.Stop(orderInstanceName(c)); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("stop instance fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("stop instance success"))
+}
+
+// @Summary start instance
+// @Description start the instance of the order
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/start [POST]
+func startInstance(c *MyContext) {
+	if err := c.CoreContext.VmManager.Start(orderInstanceName(c)); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("start instance fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("start instance success"))
+}
+
+// @Summary reboot instance
+// @Description reboot the instance of the order
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/reboot [POST]
+func rebootInstance(c *MyContext) {
+	if err := c.CoreContext.VmManager.Reboot(orderInstanceName(c)); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("reboot instance fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("reboot instance success"))
+}
+
+// @Summary resize instance
+// @Description apply the upgrade of the order to the running instance once the host has the capacity, the parts of
+// @Description the size left 0 are kept
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body vm.Size true "cpu, memory in GB and disk in GB"
+// @Success 200 {object} Result
+// @Router /instances/{order}/resize [POST]
+func resizeInstance(c *MyContext) {
+	var size vm.Size
+	if err := c.BindJSON(&size); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	name := orderInstanceName(c)
+	size, err := resize(c.CoreContext.VmManager, name, size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("resize instance fail: %s", err)))
+		return
+	}
+	logrus.Infof("instance %s resized to %s", name, size)
+	// the instance keeps the size after a restart
+	if err = c.CoreContext.Catalog.Resized(name, size); err != nil {
+		logrus.Errorf("keep the size of the instance %s fail: %s", name, err)
+	}
+	c.JSON(http.StatusOK, Success(size))
+}
+
+// resize resize the running instance once the host is known to have the capacity, the parts of the size left 0
+// are kept
+func resize(manager vm.Manager, name string, size vm.Size) (vm.Size, error) {
+	resizer, ok := manager.(vm.Resizer)
+	if !ok {
+		return size, errors.New("the virtualization can not resize instances")
+	}
+	current, err := resizer.InstanceSize(name)
+	if err != nil {
+		return size, err
+	}
+	if size.Cpu == 0 {
+		size.Cpu = current.Cpu
+	}
+	if size.Memory == 0 {
+		size.Memory = current.Memory
+	}
+	if size.Disk == 0 {
+		size.Disk = current.Disk
+	}
+	host, err := utils.GetHostResources(config.DefaultConfigDir())
+	if err != nil {
+		return size, err
+	}
+	if err = vm.CheckCapacity(host, current, size); err != nil {
+		return size, err
+	}
+	return size, resizer.Resize(name, size)
+}
+
+// @Summary instance console log
+// @Description the last lines of the instance console log
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Param tail query int false "number of lines, default 100"
+// @Success 200 {object} Result
+// @Router /instances/{order}/console [GET]
+func getInstanceConsole(c *MyContext) {
+	tail := defaultConsoleTail
+	if c.Query("tail") != "" {
+		n, err := strconv.Atoi(c.Query("tail"))
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("Incorrect parameter format : %s", c.Query("tail"))))
+			return
+		}
+		tail = n
+	}
+	log, err := c.CoreContext.VmManager.ConsoleLog(orderInstanceName(c), tail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("read console log fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(log))
+}
@@ -0,0 +1,70 @@
+package corehttp
+
+import (
+	"errors"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/gin-gonic/gin"
+	"github.com/hamster-shared/hamster-provider/core/context"
+	"github.com/hamster-shared/hamster-provider/core/modules/chain"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeReportClient struct {
+	chain.ReportClient
+	orderErr   error
+	overdueErr error
+}
+
+func (f *fakeReportClient) GetOrder(orderIndex uint64) (*chain.ComputingOrder, error) {
+	if f.orderErr != nil {
+		return nil, f.orderErr
+	}
+	return &chain.ComputingOrder{ResourceIndex: 1, AgreementIndex: types.NewOptionU64(types.NewU64(7))}, nil
+}
+
+func (f *fakeReportClient) InstanceOverdue(orderIndex uint64) (time.Duration, error) {
+	return time.Hour, f.overdueErr
+}
+
+// fakeVm a kvm domain that no longer exists, its status is nil
+type fakeVm struct {
+	vm.Manager
+}
+
+func (f *fakeVm) Status(name string) (*vm.Status, error) {
+	return nil, nil
+}
+
+func serveInstance(t *testing.T, report chain.ReportClient) int {
+	gin.SetMode(gin.TestMode)
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{ChainRegInfo: config.ChainRegInfo{ResourceIndex: 1}}))
+	ctx := &context.CoreContext{Cm: cm, ReportClient: report, VmManager: &fakeVm{}}
+	r := gin.New()
+	r.GET("/instances/:order", handleFunc(agreementRequired, ctx), handleFunc(getInstance, ctx))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/instances/3", nil))
+	return w.Code
+}
+
+func TestGetMissingInstance(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, serveInstance(t, &fakeReportClient{}))
+}
+
+func TestAgreementUnavailable(t *testing.T) {
+	// the agreement cannot be checked, the request is refused
+	assert.Equal(t, http.StatusServiceUnavailable, serveInstance(t, &fakeReportClient{overdueErr: errors.New("connection refused")}))
+}
+
+func TestOrderUnavailable(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, serveInstance(t, &fakeReportClient{orderErr: chain.ErrOrderNotFound}))
+	// the chain can not be queried, the order may exist
+	assert.Equal(t, http.StatusServiceUnavailable, serveInstance(t, &fakeReportClient{orderErr: errors.New("connection refused")}))
+}
@@ -0,0 +1,109 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/pk"
+	"net/http"
+)
+
+type Keys struct {
+	PublicKey string `json:"publicKey"`
+}
+
+type KeyFingerprint struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// @Summary list instance keys
+// @Description list the ssh public keys authorized on the instance of the order
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/keys [GET]
+func listInstanceKeys(c *MyContext) {
+	keys, err := c.CoreContext.PkManager.ListKeys(c.GetUint64(orderNoKey))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("list keys fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(keys))
+}
+
+// @Summary add instance key
+// @Description authorize an OpenSSH public key on the instance of the order
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body Keys true "the public key"
+// @Success 200 {object} Result
+// @Router /instances/{order}/keys [POST]
+func addInstanceKey(c *MyContext) {
+	var json Keys
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	key, err := c.CoreContext.PkManager.AddKey(c.GetUint64(orderNoKey), json.PublicKey, config.KeySourceTenant)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("add key fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(key))
+}
+
+// @Summary remove instance key
+// @Description revoke the public key from the instance of the order
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body KeyFingerprint true "fingerprint of the key"
+// @Success 200 {object} Result
+// @Router /instances/{order}/keys/remove [POST]
+func removeInstanceKey(c *MyContext) {
+	var json KeyFingerprint
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	err := c.CoreContext.PkManager.RemoveKey(c.GetUint64(orderNoKey), json.Fingerprint)
+	if errors.Is(err, pk.ErrKeyNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("remove key fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("remove key success"))
+}
+
+// @Summary sync instance keys
+// @Description sync the tenant public key of the order from the chain and apply the keys to the instance
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/keys/sync [POST]
+func syncInstanceKeys(c *MyContext) {
+	orderNo := c.GetUint64(orderNoKey)
+	order, err := c.CoreContext.ReportClient.GetOrder(orderNo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("get order fail: %s", err)))
+		return
+	}
+	manager := c.CoreContext.PkManager
+	if _, _, err = manager.SyncOrderKey(orderNo, string(order.TenantInfo.PublicKey)); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("sync order key fail: %s", err)))
+		return
+	}
+	if err = manager.Apply(orderNo); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("apply keys fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("sync keys success"))
+}
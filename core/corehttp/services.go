@@ -0,0 +1,71 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/expose"
+	"net/http"
+)
+
+// ServicePorts the ports of the instance, all the exposed ports when closing without ports
+type ServicePorts struct {
+	Ports []int `json:"ports"`
+}
+
+// @Summary list instance service ports
+// @Description list the ports of the instance of the order exposed in the p2p network and their protocols
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/ports [GET]
+func listInstancePorts(c *MyContext) {
+	c.JSON(http.StatusOK, Success(c.CoreContext.Services.List(c.GetUint64(orderNoKey))))
+}
+
+// @Summary expose instance service ports
+// @Description expose the ports of the instance of the order in the p2p network, each port under the
+// @Description protocol /x/hamster/{order}/{port}, forward the protocol from the provider peer to reach it
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body ServicePorts true "ports of the instance"
+// @Success 200 {object} Result
+// @Router /instances/{order}/ports [POST]
+func exposeInstancePorts(c *MyContext) {
+	var json ServicePorts
+	if err := c.BindJSON(&json); err != nil || len(json.Ports) == 0 {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	ports, err := c.CoreContext.Services.Expose(c.GetUint64(orderNoKey), json.Ports)
+	if errors.Is(err, expose.ErrTooManyPorts) {
+		c.JSON(http.StatusForbidden, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("expose ports fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(ports))
+}
+
+// @Summary close instance service ports
+// @Description close the exposed ports of the instance of the order, all of them when no port is given
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body ServicePorts true "ports of the instance"
+// @Success 200 {object} Result
+// @Router /instances/{order}/ports/remove [POST]
+func closeInstancePorts(c *MyContext) {
+	var json ServicePorts
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	done := c.CoreContext.Services.Close(c.GetUint64(orderNoKey), json.Ports)
+	c.JSON(http.StatusOK, Success(fmt.Sprintf("%d ports closed", done)))
+}
@@ -0,0 +1,125 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/snapshot"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"net/http"
+)
+
+type SnapshotLabel struct {
+	Label string `json:"label"`
+}
+
+type SnapshotName struct {
+	Name string `json:"name"`
+}
+
+// SnapshotList the snapshots of the order and the number it may keep
+type SnapshotList struct {
+	Quota     int           `json:"quota"`
+	Snapshots []vm.Snapshot `json:"snapshots"`
+}
+
+// @Summary list instance snapshots
+// @Description list the snapshots of the instance of the order and the snapshot quota
+// @Tags instance
+// @Produce json
+// @Param order path int true "order index"
+// @Success 200 {object} Result
+// @Router /instances/{order}/snapshots [GET]
+func listInstanceSnapshots(c *MyContext) {
+	quota, err := c.CoreContext.Snapshots.Quota()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("list snapshots fail: %s", err)))
+		return
+	}
+	snapshots, err := c.CoreContext.Snapshots.List(c.GetUint64(orderNoKey))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("list snapshots fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(SnapshotList{Quota: quota, Snapshots: snapshots}))
+}
+
+// @Summary create instance snapshot
+// @Description snapshot the instance of the order, fails when the snapshot quota is used up
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body SnapshotLabel true "label of the snapshot"
+// @Success 200 {object} Result
+// @Router /instances/{order}/snapshots [POST]
+func createInstanceSnapshot(c *MyContext) {
+	var json SnapshotLabel
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	s, err := c.CoreContext.Snapshots.Create(c.GetUint64(orderNoKey), json.Label)
+	if errors.Is(err, snapshot.ErrQuotaExceeded) || errors.Is(err, snapshot.ErrDisabled) {
+		c.JSON(http.StatusForbidden, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("create snapshot fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(s))
+}
+
+// @Summary restore instance snapshot
+// @Description restore the instance of the order to the snapshot, the changes since the snapshot are lost
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body SnapshotName true "name of the snapshot"
+// @Success 200 {object} Result
+// @Router /instances/{order}/snapshots/restore [POST]
+func restoreInstanceSnapshot(c *MyContext) {
+	var json SnapshotName
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	err := c.CoreContext.Snapshots.Restore(c.GetUint64(orderNoKey), json.Name)
+	if errors.Is(err, vm.ErrSnapshotNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("restore snapshot fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success("restore snapshot success"))
+}
+
+// @Summary remove instance snapshot
+// @Description delete the snapshot of the instance of the order
+// @Tags instance
+// @Accept json
+// @Produce json
+// @Param order path int true "order index"
+// @Param param body SnapshotName true "name of the snapshot"
+// @Success 200 {object} Result
+// @Router /instances/{order}/snapshots/remove [POST]
+func removeInstanceSnapshot(c *MyContext) {
+	var json SnapshotName
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	err := c.CoreContext.Snapshots.Delete(c.GetUint64(orderNoKey), json.Name)
+	if errors.Is(err, vm.ErrSnapshotNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("remove snapshot fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(""))
+}
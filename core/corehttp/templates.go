@@ -0,0 +1,115 @@
+package corehttp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"net/http"
+)
+
+type TemplateName struct {
+	Name string `json:"name"`
+}
+
+// @Summary list templates
+// @Description list the template catalog offered to the tenants
+// @Tags template
+// @Produce json
+// @Success 200 {object} Result
+// @Router /templates [GET]
+func listTemplates(c *MyContext) {
+	templates, err := c.CoreContext.Catalog.List()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("list templates fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(templates))
+}
+
+// @Summary list image downloads
+// @Description the progress of the image downloads and docker pulls, and their last results
+// @Tags template
+// @Produce json
+// @Success 200 {object} Result
+// @Router /images/downloads [GET]
+func listImageDownloads(c *MyContext) {
+	c.JSON(http.StatusOK, Success(c.CoreContext.ImageCache.Progress()))
+}
+
+// @Summary save template
+// @Description add or replace a template of the catalog, its image is pulled in the background
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param param body config.TemplateOption true "the template"
+// @Success 200 {object} Result
+// @Router /templates [POST]
+func saveTemplate(c *MyContext) {
+	var json config.TemplateOption
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	if err := c.CoreContext.Catalog.Save(json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("save template fail: %s", err)))
+		return
+	}
+	if preparer, ok := c.CoreContext.VmManager.(vm.ImagePreparer); ok {
+		go c.CoreContext.Catalog.PrewarmTemplate(preparer, json)
+	}
+	c.JSON(http.StatusOK, Success(json))
+}
+
+// @Summary remove template
+// @Description remove a template of the catalog
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param param body TemplateName true "name of the template"
+// @Success 200 {object} Result
+// @Router /templates/remove [POST]
+func removeTemplate(c *MyContext) {
+	var json TemplateName
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	err := c.CoreContext.Catalog.Remove(json.Name)
+	if errors.Is(err, template.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("remove template fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(""))
+}
+
+// @Summary default template
+// @Description use the template for the orders not choosing one
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param param body TemplateName true "name of the template"
+// @Success 200 {object} Result
+// @Router /templates/default [POST]
+func setDefaultTemplate(c *MyContext) {
+	var json TemplateName
+	if err := c.BindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest())
+		return
+	}
+	err := c.CoreContext.Catalog.SetDefault(json.Name)
+	if errors.Is(err, template.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, BadRequest(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, BadRequest(fmt.Sprintf("set default template fail: %s", err)))
+		return
+	}
+	c.JSON(http.StatusOK, Success(""))
+}
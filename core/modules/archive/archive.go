@@ -0,0 +1,393 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxSize the limit of the extracted bytes when the options do not set one
+const DefaultMaxSize int64 = 64 << 30
+
+var (
+	ErrUnsafePath        = errors.New("archive entry escapes the destination")
+	ErrSymlink           = errors.New("archive entry is a link")
+	ErrTooLarge          = errors.New("archive exceeds the size limit")
+	ErrUnsupportedFormat = errors.New("unsupported archive format")
+)
+
+// SymlinkPolicy how the symbolic and hard links of an archive are handled
+type SymlinkPolicy int
+
+const (
+	SymlinkReject    SymlinkPolicy = iota // fail on any link
+	SymlinkSkip                           // ignore the links
+	SymlinkContained                      // keep the links pointing inside the destination
+)
+
+// Options of the extraction
+type Options struct {
+	MaxSize         int64 // total bytes written, DefaultMaxSize when 0
+	Symlinks        SymlinkPolicy
+	StripComponents int // leading path segments removed from the entry names, like tar --strip-components
+}
+
+// Format the compression and the container of a file, detected from its name
+type Format struct {
+	Compression string // gz, xz, zst or empty
+	Archive     string // tar, zip or empty for a single compressed file
+}
+
+// DetectFormat detect the format from the file name, like image.tar.xz or image.qcow2.gz
+func DetectFormat(name string) (Format, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Format{Archive: "zip"}, nil
+	case strings.HasSuffix(name, ".tgz"):
+		return Format{Compression: "gz", Archive: "tar"}, nil
+	case strings.HasSuffix(name, ".tar"):
+		return Format{Archive: "tar"}, nil
+	}
+	for _, c := range []string{"gz", "xz", "zst"} {
+		if strings.HasSuffix(name, ".tar."+c) {
+			return Format{Compression: c, Archive: "tar"}, nil
+		}
+		if strings.HasSuffix(name, "."+c) {
+			return Format{Compression: c}, nil
+		}
+	}
+	return Format{}, fmt.Errorf("%w: %s", ErrUnsupportedFormat, name)
+}
+
+// TrimExtension the name of the file without its archive or compression extension
+func TrimExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tar.xz", ".tar.zst", ".tgz", ".tar", ".zip", ".gz", ".xz", ".zst"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// IsArchive whether the name has an archive or compression extension
+func IsArchive(name string) bool {
+	_, err := DetectFormat(name)
+	return err == nil
+}
+
+// Extract extract the archive into the dst directory, a single compressed file, like image.qcow2.gz,
+// is decompressed into dst/image.qcow2, return the written files
+func Extract(file, dst string, opt Options) ([]string, error) {
+	format, err := DetectFormat(file)
+	if err != nil {
+		return nil, err
+	}
+	if format.Archive == "zip" {
+		return ExtractZip(file, dst, opt)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := decompress(f, format.Compression)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if format.Archive == "tar" {
+		return ExtractTar(r, dst, opt)
+	}
+	target := filepath.Join(dst, filepath.Base(TrimExtension(file)))
+	if err = os.MkdirAll(dst, os.ModePerm); err != nil {
+		return nil, err
+	}
+	limit := newLimit(opt)
+	if err = writeFile(target, r, 0644, limit); err != nil {
+		return nil, err
+	}
+	return []string{target}, nil
+}
+
+// ExtractTar extract the uncompressed tar stream into the dst directory
+func ExtractTar(src io.Reader, dst string, opt Options) ([]string, error) {
+	root, err := prepareRoot(dst)
+	if err != nil {
+		return nil, err
+	}
+	limit := newLimit(opt)
+	var files []string
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		name, ok := stripName(header.Name, opt.StripComponents)
+		if !ok {
+			continue
+		}
+		target, err := containedPath(root, name)
+		if err != nil {
+			return files, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, os.ModePerm); err != nil {
+				return files, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err = writeFile(target, tr, header.FileInfo().Mode().Perm(), limit); err != nil {
+				return files, err
+			}
+			files = append(files, target)
+		case tar.TypeSymlink, tar.TypeLink:
+			linked, err := link(root, target, header, opt)
+			if err != nil {
+				return files, err
+			}
+			if linked {
+				files = append(files, target)
+			}
+		default:
+			// devices, fifos and the other special files are never extracted
+			continue
+		}
+	}
+}
+
+// ExtractZip extract the zip file into the dst directory
+func ExtractZip(src, dst string, opt Options) ([]string, error) {
+	root, err := prepareRoot(dst)
+	if err != nil {
+		return nil, err
+	}
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	limit := newLimit(opt)
+	var files []string
+	for _, f := range r.File {
+		name, ok := stripName(f.Name, opt.StripComponents)
+		if !ok {
+			continue
+		}
+		target, err := containedPath(root, name)
+		if err != nil {
+			return files, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(target, os.ModePerm); err != nil {
+				return files, err
+			}
+		case mode&os.ModeSymlink != 0:
+			if opt.Symlinks == SymlinkSkip {
+				continue
+			}
+			return files, fmt.Errorf("%w: %s", ErrSymlink, f.Name)
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return files, err
+			}
+			err = writeFile(target, rc, mode.Perm(), limit)
+			rc.Close()
+			if err != nil {
+				return files, err
+			}
+			files = append(files, target)
+		}
+	}
+	return files, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+func decompress(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "gz":
+		return gzip.NewReader(r)
+	case "xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case "zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return readCloser{Reader: zr, close: func() error { zr.Close(); return nil }}, nil
+	case "":
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, compression)
+}
+
+// sizeLimit the bytes left to write
+type sizeLimit struct {
+	left int64
+}
+
+func newLimit(opt Options) *sizeLimit {
+	if opt.MaxSize > 0 {
+		return &sizeLimit{left: opt.MaxSize}
+	}
+	return &sizeLimit{left: DefaultMaxSize}
+}
+
+// writeFile write the file, removed when it exceeds the limit
+func writeFile(target string, r io.Reader, perm os.FileMode, limit *sizeLimit) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	// an existing link at the target is replaced, never followed
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(target); err != nil {
+			return err
+		}
+	}
+	fd, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm|0600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(fd, io.LimitReader(r, limit.left+1))
+	closeErr := fd.Close()
+	if err == nil && n > limit.left {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return err
+	}
+	limit.left -= n
+	return nil
+}
+
+// link create the link of the tar entry according to the policy, return whether it is created
+func link(root, target string, header *tar.Header, opt Options) (bool, error) {
+	switch opt.Symlinks {
+	case SymlinkSkip:
+		return false, nil
+	case SymlinkContained:
+	default:
+		return false, fmt.Errorf("%w: %s", ErrSymlink, header.Name)
+	}
+	if filepath.IsAbs(header.Linkname) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrUnsafePath, header.Name, header.Linkname)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return false, err
+	}
+	if header.Typeflag == tar.TypeLink {
+		// hard link names are relative to the root of the archive
+		name, ok := stripName(header.Linkname, opt.StripComponents)
+		if !ok {
+			return false, fmt.Errorf("%w: %s -> %s", ErrUnsafePath, header.Name, header.Linkname)
+		}
+		source, err := containedPath(root, name)
+		if err != nil {
+			return false, err
+		}
+		return true, os.Link(source, target)
+	}
+	// symbolic links are relative to their directory
+	resolved := filepath.Join(filepath.Dir(target), header.Linkname)
+	if !within(root, resolved) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrUnsafePath, header.Name, header.Linkname)
+	}
+	return true, os.Symlink(header.Linkname, target)
+}
+
+func prepareRoot(dst string) (string, error) {
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dst)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// stripName remove the leading segments of the entry name, false when nothing is left
+func stripName(name string, strip int) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	segs := strings.Split(strings.Trim(name, "/"), "/")
+	if strings.HasPrefix(name, "/") {
+		// keep absolute names absolute, they are rejected by containedPath
+		segs[0] = "/" + segs[0]
+	}
+	if len(segs) <= strip {
+		return "", false
+	}
+	name = strings.Join(segs[strip:], "/")
+	if name == "" || name == "." {
+		return "", false
+	}
+	return name, true
+}
+
+// containedPath the target of the entry, the entry must not be absolute or escape the root,
+// including through the links already extracted
+func containedPath(root, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	target := filepath.Join(root, filepath.FromSlash(name))
+	if !within(root, target) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	// the existing parent directories are resolved, a link must not lead outside the root
+	dir := filepath.Dir(target)
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !within(root, resolved) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return target, nil
+}
+
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, filepath.Clean(target))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
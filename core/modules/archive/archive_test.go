@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	body     string
+	typeflag byte
+	linkname string
+}
+
+func tarball(t *testing.T, entries ...entry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: typeflag, Linkname: e.linkname}
+		if typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		assert.NoError(t, tw.WriteHeader(header))
+		if typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(e.body))
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func writeArchive(t *testing.T, name string, data []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, data, 0644))
+	return file
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		"ubuntu.qcow2.tar.gz": {Compression: "gz", Archive: "tar"},
+		"ubuntu.tgz":          {Compression: "gz", Archive: "tar"},
+		"ubuntu.tar.xz":       {Compression: "xz", Archive: "tar"},
+		"ubuntu.tar.zst":      {Compression: "zst", Archive: "tar"},
+		"ubuntu.qcow2.gz":     {Compression: "gz"},
+		"ubuntu.img.XZ":       {Compression: "xz"},
+		"ubuntu.zip":          {Archive: "zip"},
+	}
+	for name, format := range cases {
+		got, err := DetectFormat(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, format, got, name)
+	}
+	_, err := DetectFormat("ubuntu.qcow2")
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+	assert.Equal(t, "ubuntu.qcow2", TrimExtension("ubuntu.qcow2.tar.zst"))
+	assert.Equal(t, "ubuntu.qcow2", TrimExtension("ubuntu.qcow2"))
+}
+
+func TestExtractTar(t *testing.T) {
+	dst := t.TempDir()
+	data := tarball(t,
+		entry{name: "image/", typeflag: tar.TypeDir},
+		entry{name: "image/ubuntu.qcow2", body: "qcow2"},
+		entry{name: "image/dev", typeflag: tar.TypeChar},
+	)
+	files, err := ExtractTar(bytes.NewReader(data), dst, Options{StripComponents: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dst, "ubuntu.qcow2")}, files)
+	_, err = os.Stat(filepath.Join(dst, "dev"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractTarUnsafePath(t *testing.T) {
+	for _, name := range []string{"../evil", "a/../../evil", "/etc/evil"} {
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "dst")
+		_, err := ExtractTar(bytes.NewReader(tarball(t, entry{name: name, body: "evil"})), dst, Options{})
+		assert.ErrorIs(t, err, ErrUnsafePath, name)
+		_, err = os.Stat(filepath.Join(dir, "evil"))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestExtractTarSymlink(t *testing.T) {
+	outside := t.TempDir()
+	escape := tarball(t,
+		entry{name: "link", typeflag: tar.TypeSymlink, linkname: outside},
+		entry{name: "link/evil", body: "evil"},
+	)
+	_, err := ExtractTar(bytes.NewReader(escape), t.TempDir(), Options{})
+	assert.ErrorIs(t, err, ErrSymlink)
+
+	_, err = ExtractTar(bytes.NewReader(escape), t.TempDir(), Options{Symlinks: SymlinkContained})
+	assert.ErrorIs(t, err, ErrUnsafePath)
+
+	relative := tarball(t,
+		entry{name: "link", typeflag: tar.TypeSymlink, linkname: "../../" + filepath.Base(outside)},
+		entry{name: "link/evil", body: "evil"},
+	)
+	_, err = ExtractTar(bytes.NewReader(relative), t.TempDir(), Options{Symlinks: SymlinkContained})
+	assert.ErrorIs(t, err, ErrUnsafePath)
+	_, err = os.Stat(filepath.Join(outside, "evil"))
+	assert.True(t, os.IsNotExist(err))
+
+	dst := t.TempDir()
+	contained := tarball(t,
+		entry{name: "ubuntu.qcow2", body: "qcow2"},
+		entry{name: "latest", typeflag: tar.TypeSymlink, linkname: "ubuntu.qcow2"},
+		entry{name: "hard", typeflag: tar.TypeLink, linkname: "ubuntu.qcow2"},
+	)
+	files, err := ExtractTar(bytes.NewReader(contained), dst, Options{Symlinks: SymlinkContained})
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	data, err := os.ReadFile(filepath.Join(dst, "latest"))
+	assert.NoError(t, err)
+	assert.Equal(t, "qcow2", string(data))
+
+	files, err = ExtractTar(bytes.NewReader(contained), t.TempDir(), Options{Symlinks: SymlinkSkip})
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestExtractTarTooLarge(t *testing.T) {
+	dst := t.TempDir()
+	data := tarball(t,
+		entry{name: "a", body: "0123456789"},
+		entry{name: "b", body: "0123456789"},
+	)
+	_, err := ExtractTar(bytes.NewReader(data), dst, Options{MaxSize: 15})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = os.Stat(filepath.Join(dst, "b"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractCompressed(t *testing.T) {
+	data := tarball(t, entry{name: "ubuntu.qcow2", body: "qcow2"})
+	var gz, xzBuf, zst bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write(data)
+	assert.NoError(t, gw.Close())
+	xw, err := xz.NewWriter(&xzBuf)
+	assert.NoError(t, err)
+	_, _ = xw.Write(data)
+	assert.NoError(t, xw.Close())
+	zw, err := zstd.NewWriter(&zst)
+	assert.NoError(t, err)
+	_, _ = zw.Write(data)
+	assert.NoError(t, zw.Close())
+
+	for name, compressed := range map[string][]byte{
+		"ubuntu.tar.gz":  gz.Bytes(),
+		"ubuntu.tar.xz":  xzBuf.Bytes(),
+		"ubuntu.tar.zst": zst.Bytes(),
+	} {
+		dst := t.TempDir()
+		files, err := Extract(writeArchive(t, name, compressed), dst, Options{})
+		assert.NoError(t, err, name)
+		assert.Equal(t, []string{filepath.Join(dst, "ubuntu.qcow2")}, files, name)
+	}
+}
+
+func TestExtractSingleFile(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write(bytes.Repeat([]byte("q"), 1024))
+	assert.NoError(t, gw.Close())
+	file := writeArchive(t, "ubuntu.qcow2.gz", gz.Bytes())
+
+	dst := t.TempDir()
+	files, err := Extract(file, dst, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dst, "ubuntu.qcow2")}, files)
+	info, err := os.Stat(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), info.Size())
+
+	// a small archive inflating beyond the limit is a bomb
+	dst = t.TempDir()
+	_, err = Extract(file, dst, Options{MaxSize: 512})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = os.Stat(filepath.Join(dst, "ubuntu.qcow2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractZip(t *testing.T) {
+	zipFile := func(names ...string) string {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, name := range names {
+			w, err := zw.Create(name)
+			assert.NoError(t, err)
+			_, _ = io.WriteString(w, "data")
+		}
+		assert.NoError(t, zw.Close())
+		return writeArchive(t, "image.zip", buf.Bytes())
+	}
+
+	dst := t.TempDir()
+	files, err := Extract(zipFile("image/ubuntu.vhdx"), dst, Options{StripComponents: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dst, "ubuntu.vhdx")}, files)
+
+	_, err = Extract(zipFile("../../evil"), t.TempDir(), Options{})
+	assert.ErrorIs(t, err, ErrUnsafePath)
+}
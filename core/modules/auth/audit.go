@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const auditLogFilename = "audit.log"
+
+// AuditRecord an audit log entry of a mutating request
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Identity string    `json:"identity"`
+	Role     string    `json:"role"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	ClientIp string    `json:"clientIp"`
+	Status   int       `json:"status"`
+}
+
+// AuditLogger append only audit log, one json record per line
+type AuditLogger struct {
+	lock sync.Mutex
+	path string
+}
+
+func NewAuditLogger(path string) *AuditLogger {
+	return &AuditLogger{
+		path: path,
+	}
+}
+
+// DefaultAuditLogPath the audit log in the config directory
+func DefaultAuditLogPath(configDir string) string {
+	return filepath.Join(configDir, auditLogFilename)
+}
+
+// Record append the record to the audit log
+func (l *AuditLogger) Record(r AuditRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(r)
+}
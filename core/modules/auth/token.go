@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"net/http"
+)
+
+const tokenBytes = 32
+
+// GenerateToken generate a random api token, the plaintext is only returned once
+func GenerateToken(name string, role config.Role) (string, config.ApiToken, error) {
+	if _, err := ParseRole(string(role)); err != nil {
+		return "", config.ApiToken{}, err
+	}
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", config.ApiToken{}, err
+	}
+	token := hex.EncodeToString(buf)
+	return token, config.ApiToken{
+		Name: name,
+		Hash: HashToken(token),
+		Role: role,
+	}, nil
+}
+
+// HashToken the stored form of the token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchToken find the api token the plaintext token belongs to
+func MatchToken(tokens []config.ApiToken, token string) (*config.ApiToken, bool) {
+	if token == "" {
+		return nil, false
+	}
+	hash := []byte(HashToken(token))
+	for i := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(tokens[i].Hash)) == 1 {
+			return &tokens[i], true
+		}
+	}
+	return nil, false
+}
+
+// ParseRole parse the role name
+func ParseRole(role string) (config.Role, error) {
+	switch config.Role(role) {
+	case config.RoleReadOnly, config.RoleAdmin:
+		return config.Role(role), nil
+	default:
+		return "", fmt.Errorf("unknown role: %s, must be %s or %s", role, config.RoleReadOnly, config.RoleAdmin)
+	}
+}
+
+// CertificateRole the role of a client certificate is taken from its organizational unit
+func CertificateRole(cert *x509.Certificate) (config.Role, bool) {
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if role, err := ParseRole(ou); err == nil {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// IsMutating whether the http method changes the state of the provider
+func IsMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// Allowed whether the role is allowed to call the http method
+func Allowed(role config.Role, method string) bool {
+	if role == config.RoleAdmin {
+		return true
+	}
+	return role == config.RoleReadOnly && !IsMutating(method)
+}
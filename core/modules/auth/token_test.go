@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestGenerateToken(t *testing.T) {
+	token, apiToken, err := GenerateToken("admin", config.RoleAdmin)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, apiToken.Hash)
+
+	matched, ok := MatchToken([]config.ApiToken{apiToken}, token)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", matched.Name)
+
+	_, ok = MatchToken([]config.ApiToken{apiToken}, token+"0")
+	assert.False(t, ok)
+
+	_, _, err = GenerateToken("root", "root")
+	assert.Error(t, err)
+}
+
+func TestAllowed(t *testing.T) {
+	assert.True(t, Allowed(config.RoleReadOnly, http.MethodGet))
+	assert.False(t, Allowed(config.RoleReadOnly, http.MethodPost))
+	assert.True(t, Allowed(config.RoleAdmin, http.MethodPost))
+	assert.False(t, Allowed("", http.MethodGet))
+}
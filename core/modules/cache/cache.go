@@ -0,0 +1,307 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const indexFile = "index.json"
+
+var ErrChecksumMismatch = errors.New("sha256 checksum mismatch")
+
+// Source an image to download, Sha256 is the hex sha256 of the file, not verified when empty
+type Source struct {
+	Url    string
+	Sha256 string
+}
+
+// TaskStatus the state of a download
+type TaskStatus string
+
+const (
+	TaskDownloading TaskStatus = "downloading"
+	TaskVerifying   TaskStatus = "verifying"
+	TaskDone        TaskStatus = "done"
+	TaskFailed      TaskStatus = "failed"
+)
+
+// Progress the progress of a download, Total is -1 when unknown
+type Progress struct {
+	Key     string     `json:"key"`
+	Done    int64      `json:"done"`
+	Total   int64      `json:"total"`
+	Status  TaskStatus `json:"status"`
+	Error   string     `json:"error,omitempty"`
+	Started time.Time  `json:"started"`
+	Updated time.Time  `json:"updated"`
+}
+
+type task struct {
+	done     chan struct{}
+	err      error
+	progress Progress
+}
+
+type entry struct {
+	Url      string    `json:"url"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Sha256   string    `json:"sha256"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// ImageCache 下载并缓存镜像文件, 同一镜像的并发下载只执行一次, 缓存超过容量时淘汰最久未使用的文件
+type ImageCache struct {
+	dir    string
+	budget int64
+	mu     sync.Mutex
+	tasks  map[string]*task
+}
+
+// NewImageCache create the cache in the dir, budget is the size limit in bytes, 0 is unlimited
+func NewImageCache(dir string, budget int64) *ImageCache {
+	return &ImageCache{
+		dir:    dir,
+		budget: budget,
+		tasks:  map[string]*task{},
+	}
+}
+
+// Fetch return the cached file of the source, it is downloaded and verified when missing
+func (c *ImageCache) Fetch(src Source) (string, error) {
+	if src.Url == "" {
+		return "", errors.New("image url is empty")
+	}
+	file := c.path(src.Url)
+	if c.hit(src, file) {
+		return file, nil
+	}
+	err := c.Do(src.Url, func(report utils.DownloadProgress) error {
+		return c.download(src, file, report)
+	})
+	if err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// Do run fn once for concurrent calls with the same key, the other callers wait for its result,
+// the progress fn reports is listed by Progress
+func (c *ImageCache) Do(key string, fn func(report utils.DownloadProgress) error) error {
+	c.mu.Lock()
+	if t, ok := c.tasks[key]; ok && t.progress.Status != TaskDone && t.progress.Status != TaskFailed {
+		c.mu.Unlock()
+		<-t.done
+		return t.err
+	}
+	now := time.Now()
+	t := &task{
+		done:     make(chan struct{}),
+		progress: Progress{Key: key, Total: -1, Status: TaskDownloading, Started: now, Updated: now},
+	}
+	c.tasks[key] = t
+	c.mu.Unlock()
+
+	err := fn(func(done, total int64) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		t.progress.Done = done
+		t.progress.Total = total
+		t.progress.Updated = time.Now()
+	})
+
+	c.mu.Lock()
+	t.err = err
+	t.progress.Status = TaskDone
+	if err != nil {
+		t.progress.Status = TaskFailed
+		t.progress.Error = err.Error()
+	}
+	t.progress.Updated = time.Now()
+	c.mu.Unlock()
+	close(t.done)
+	return err
+}
+
+// Progress the downloads in progress and their last results
+func (c *ImageCache) Progress() []Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := []Progress{}
+	for _, t := range c.tasks {
+		res = append(res, t.progress)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Started.Before(res[j].Started)
+	})
+	return res
+}
+
+// Evict remove the least recently used files until the cache fits the budget, keep is not removed
+func (c *ImageCache) Evict(keep ...string) ([]string, error) {
+	if c.budget <= 0 {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	var entries []*entry
+	for _, e := range index {
+		total += e.Size
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	var removed []string
+	for _, e := range entries {
+		if total <= c.budget {
+			break
+		}
+		if utils.Contains(keep, e.Url) {
+			continue
+		}
+		if t, ok := c.tasks[e.Url]; ok && t.progress.Status == TaskDownloading {
+			continue
+		}
+		if err = os.Remove(filepath.Join(c.dir, e.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		delete(index, e.Url)
+		total -= e.Size
+		removed = append(removed, e.Url)
+		log.Infof("image %s evicted from the cache", e.Url)
+	}
+	return removed, c.save(index)
+}
+
+// hit whether the file of the source is cached and matches the checksum, the use is recorded
+func (c *ImageCache) hit(src Source, file string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index, err := c.load()
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	e, ok := index[src.Url]
+	if !ok {
+		return false
+	}
+	if _, err = os.Stat(file); err != nil {
+		delete(index, src.Url)
+		_ = c.save(index)
+		return false
+	}
+	if src.Sha256 != "" && !strings.EqualFold(src.Sha256, e.Sha256) {
+		// the checksum of the catalog changed, download again
+		return false
+	}
+	e.LastUsed = time.Now()
+	_ = c.save(index)
+	return true
+}
+
+// download fetch the source into the cache and verify it
+func (c *ImageCache) download(src Source, file string, report utils.DownloadProgress) error {
+	if err := utils.DownloadResume(src.Url, file, report); err != nil {
+		return err
+	}
+	c.setStatus(src.Url, TaskVerifying)
+	sum, size, err := fileSha256(file)
+	if err != nil {
+		return err
+	}
+	if src.Sha256 != "" && !strings.EqualFold(src.Sha256, sum) {
+		_ = os.Remove(file)
+		return fmt.Errorf("%s: %w, expected %s, got %s", src.Url, ErrChecksumMismatch, src.Sha256, sum)
+	}
+
+	c.mu.Lock()
+	index, err := c.load()
+	if err == nil {
+		index[src.Url] = &entry{
+			Url:      src.Url,
+			File:     filepath.Base(file),
+			Size:     size,
+			Sha256:   sum,
+			LastUsed: time.Now(),
+		}
+		err = c.save(index)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = c.Evict(src.Url)
+	return err
+}
+
+func (c *ImageCache) setStatus(key string, status TaskStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tasks[key]; ok {
+		t.progress.Status = status
+		t.progress.Updated = time.Now()
+	}
+}
+
+// path the cache file of the url, prefixed with a hash of the url so images with the same name do not collide
+func (c *ImageCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])[:12]+"-"+path.Base(url))
+}
+
+func (c *ImageCache) load() (map[string]*entry, error) {
+	index := map[string]*entry{}
+	data, err := os.ReadFile(filepath.Join(c.dir, indexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return index, json.Unmarshal(data, &index)
+}
+
+func (c *ImageCache) save(index map[string]*entry) error {
+	if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, indexFile), data, 0600)
+}
+
+func fileSha256(file string) (string, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newImageServer(t *testing.T, images map[string][]byte, requests *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		// slow enough for the concurrent fetches to join the first download
+		time.Sleep(50 * time.Millisecond)
+		data, ok := images[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// ServeContent answers the range requests
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetch(t *testing.T) {
+	image := bytes.Repeat([]byte("hamster"), 1024)
+	var requests int32
+	server := newImageServer(t, map[string][]byte{"/ubuntu.qcow2": image}, &requests)
+	c := NewImageCache(t.TempDir(), 0)
+	src := Source{Url: server.URL + "/ubuntu.qcow2", Sha256: checksum(image)}
+
+	// concurrent fetches download once
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			file, err := c.Fetch(src)
+			assert.NoError(t, err)
+			data, _ := os.ReadFile(file)
+			assert.Equal(t, image, data)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	_, err := c.Fetch(src)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	progress := c.Progress()
+	assert.Len(t, progress, 1)
+	assert.Equal(t, TaskDone, progress[0].Status)
+	assert.Equal(t, int64(len(image)), progress[0].Done)
+
+	_, err = c.Fetch(Source{Url: server.URL + "/missing.qcow2"})
+	assert.Error(t, err)
+}
+
+func TestFetchChecksumMismatch(t *testing.T) {
+	var requests int32
+	server := newImageServer(t, map[string][]byte{"/ubuntu.qcow2": []byte("tampered")}, &requests)
+	c := NewImageCache(t.TempDir(), 0)
+	_, err := c.Fetch(Source{Url: server.URL + "/ubuntu.qcow2", Sha256: checksum([]byte("image"))})
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = os.Stat(c.path(server.URL + "/ubuntu.qcow2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFetchResume(t *testing.T) {
+	image := bytes.Repeat([]byte("0123456789"), 100)
+	var requests int32
+	server := newImageServer(t, map[string][]byte{"/ubuntu.qcow2": image}, &requests)
+	c := NewImageCache(t.TempDir(), 0)
+	url := server.URL + "/ubuntu.qcow2"
+
+	// an interrupted download left the first half
+	assert.NoError(t, os.MkdirAll(c.dir, os.ModePerm))
+	assert.NoError(t, os.WriteFile(c.path(url)+".part", image[:500], 0644))
+	file, err := c.Fetch(Source{Url: url, Sha256: checksum(image)})
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(file)
+	assert.Equal(t, image, data)
+}
+
+func TestEvict(t *testing.T) {
+	images := map[string][]byte{
+		"/a.qcow2": bytes.Repeat([]byte("a"), 400),
+		"/b.qcow2": bytes.Repeat([]byte("b"), 400),
+		"/c.qcow2": bytes.Repeat([]byte("c"), 400),
+	}
+	var requests int32
+	server := newImageServer(t, images, &requests)
+	c := NewImageCache(t.TempDir(), 1000)
+
+	a, err := c.Fetch(Source{Url: server.URL + "/a.qcow2"})
+	assert.NoError(t, err)
+	b, err := c.Fetch(Source{Url: server.URL + "/b.qcow2"})
+	assert.NoError(t, err)
+	// a is used again, b becomes the least recently used
+	_, err = c.Fetch(Source{Url: server.URL + "/a.qcow2"})
+	assert.NoError(t, err)
+	_, err = c.Fetch(Source{Url: server.URL + "/c.qcow2"})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(a)
+	assert.NoError(t, err)
+	_, err = os.Stat(b)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	gsrpc "github.com/centrifuge/go-substrate-rpc-client/v4"
-	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
 	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
 	"github.com/sirupsen/logrus"
@@ -12,19 +11,51 @@ import (
 	"time"
 )
 
+// ErrOrderNotFound the order index is not in the resource order storage of the chain
+var ErrOrderNotFound = errors.New("order not found")
+
 // ChainClient blockchain chain connection
 type ChainClient struct {
-	cm  *config.ConfigManager
-	api *gsrpc.SubstrateAPI
+	cm     *config.ConfigManager
+	api    *gsrpc.SubstrateAPI
+	signer Signer
+	proxy  *proxyAccount
 }
 
 func NewChainClient(cm *config.ConfigManager, api *gsrpc.SubstrateAPI) (*ChainClient, error) {
+	cfg, err := cm.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSigner(cm, cfg.Signer)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := newProxyAccount(cm, cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
 	return &ChainClient{
-		cm:  cm,
-		api: api,
+		cm:     cm,
+		api:    api,
+		signer: signer,
+		proxy:  proxy,
 	}, nil
 }
 
+// account the account holding the stake and the resources on chain
+func (cc *ChainClient) account() ([]byte, string, error) {
+	if cc.proxy != nil {
+		return cc.proxy.publicKey, cc.proxy.address, nil
+	}
+	publicKey, err := cc.signer.PublicKey()
+	if err != nil {
+		return nil, "", err
+	}
+	address, err := cc.signer.Address()
+	return publicKey, address, err
+}
+
 func (cc *ChainClient) getPeerId() string {
 	cf, err := cc.cm.GetConfig()
 	if err != nil {
@@ -81,7 +112,7 @@ func (cc *ChainClient) getPeerId() string {
 //	}
 //
 //	// Sign the transaction using User's default account
-//	err = ext.Sign(keypair, o)
+//	err = signExtrinsic(&ext, signer, o)
 //	if err != nil {
 //		return err
 //	}
@@ -102,9 +133,42 @@ func (cc *ChainClient) getPeerId() string {
 //	return nil
 //}
 
+// callAndWatch submit the routine call, signed as the proxy of the staking account when configured
 func (cc *ChainClient) callAndWatch(c types.Call, meta *types.Metadata, hook func(header *types.Header) error) error {
+	if cc.proxy != nil {
+		pc, err := proxyCall(meta, cc.proxy.publicKey, c)
+		if err != nil {
+			return err
+		}
+		return cc.callAndWatchAs(cc.signer, pc, meta, hook)
+	}
+	return cc.callAndWatchAs(cc.signer, c, meta, hook)
+}
 
-	cf, err := cc.cm.GetConfig()
+// fundsCallAndWatch submit the funds moving call, signed by the staking account itself
+func (cc *ChainClient) fundsCallAndWatch(callName string, c types.Call, meta *types.Metadata, hook func(header *types.Header) error) error {
+	if cc.proxy == nil {
+		return cc.callAndWatchAs(cc.signer, c, meta, hook)
+	}
+	cold, err := cc.proxy.coldSigner()
+	if err != nil {
+		return err
+	}
+	if cold == nil {
+		callData, err := types.EncodeToHexString(c)
+		if err != nil {
+			return err
+		}
+		return &ApprovalRequiredError{
+			Call:     callName,
+			CallData: callData,
+			Account:  cc.proxy.address,
+		}
+	}
+	return cc.callAndWatchAs(cold, c, meta, hook)
+}
+
+func (cc *ChainClient) callAndWatchAs(signer Signer, c types.Call, meta *types.Metadata, hook func(header *types.Header) error) error {
 
 	// Create the extrinsic
 	ext := types.NewExtrinsic(c)
@@ -118,15 +182,13 @@ func (cc *ChainClient) callAndWatch(c types.Call, meta *types.Metadata, hook fun
 		return err
 	}
 
-	keypair, err := signature.KeyringPairFromSecret(cf.SeedOrPhrase, 42)
-	address := keypair.Address
-	println(address)
+	publicKey, err := signer.PublicKey()
 	if err != nil {
 		return err
 	}
 
 	// Get the nonce for Account
-	key, err := types.CreateStorageKey(meta, "System", "Account", keypair.PublicKey)
+	key, err := types.CreateStorageKey(meta, "System", "Account", publicKey)
 	if err != nil {
 		return err
 	}
@@ -152,7 +214,7 @@ func (cc *ChainClient) callAndWatch(c types.Call, meta *types.Metadata, hook fun
 	}
 
 	// Sign the transaction using User's default account
-	err = ext.Sign(keypair, o)
+	err = signExtrinsic(&ext, signer, o)
 	if err != nil {
 		return err
 	}
@@ -189,8 +251,7 @@ func (cc *ChainClient) callAndWatch(c types.Call, meta *types.Metadata, hook fun
 }
 
 func (cc *ChainClient) getBlock(blockNumber uint64) {
-	cf, _ := cc.cm.GetConfig()
-	kp, _ := signature.KeyringPairFromSecret(cf.SeedOrPhrase, 42)
+	publicKey, _ := cc.signer.PublicKey()
 	meta, err := cc.api.RPC.State.GetMetadataLatest()
 	hash, err := cc.api.RPC.Chain.GetBlockHash(uint64(blockNumber))
 	if err != nil {
@@ -214,7 +275,7 @@ func (cc *ChainClient) getBlock(blockNumber uint64) {
 			continue
 		}
 
-		if string(ext.Signature.Signer.AsID[:]) != string(kp.PublicKey) {
+		if string(ext.Signature.Signer.AsID[:]) != string(publicKey) {
 			continue
 		}
 		fmt.Println("callIndex:", ext.Method.CallIndex.SectionIndex)
@@ -290,8 +351,10 @@ func (cc *ChainClient) RegisterResource(r ResourceInfo) error {
 		if len(events.Provider_RegisterResourceSuccess) > 0 {
 			for _, e := range events.Provider_RegisterResourceSuccess {
 				if e.PeerId == cc.getPeerId() {
-					cf.ChainRegInfo.ResourceIndex = uint64(e.Index)
-					return cc.cm.Save(cf)
+					return cc.cm.Update(func(cfg *config.Config) error {
+						cfg.ChainRegInfo.ResourceIndex = uint64(e.Index)
+						return nil
+					})
 				}
 			}
 		}
@@ -420,12 +483,10 @@ func (cc *ChainClient) OrderExec(orderIndex uint64) error {
 		if len(events.ResourceOrder_OrderExecSuccess) > 0 {
 			for _, e := range events.ResourceOrder_OrderExecSuccess {
 				if uint64(e.OrderIndex) == orderIndex {
-					cfg, err := cc.cm.GetConfig()
-					if err != nil {
-						return err
-					}
-					cfg.ChainRegInfo.AgreementIndex = uint64(e.AgreementIndex)
-					return cc.cm.Save(cfg)
+					return cc.cm.Update(func(cfg *config.Config) error {
+						cfg.ChainRegInfo.AgreementIndex = uint64(e.AgreementIndex)
+						return nil
+					})
 				}
 			}
 			return errors.New("cannot get agreementIndex")
@@ -442,8 +503,7 @@ func (cc *ChainClient) CheckExtrinsicSuccess(header *types.Header, call string)
 
 	fmt.Printf("check tx exec Success, blockNumber : %d\n", header.Number)
 
-	cf, _ := cc.cm.GetConfig()
-	kp, _ := signature.KeyringPairFromSecret(cf.SeedOrPhrase, 42)
+	publicKey, _ := cc.signer.PublicKey()
 	meta, err := cc.api.RPC.State.GetMetadataLatest()
 	if err != nil {
 		logrus.Errorf("get block hash error: %s", err)
@@ -461,16 +521,40 @@ func (cc *ChainClient) CheckExtrinsicSuccess(header *types.Header, call string)
 	extrinsics := block.Block.Extrinsics
 	// get the event corresponding to the block
 	events, err := cc.GetEvent(uint64(header.Number))
+	if err != nil {
+		return err
+	}
 
 	callIndex, err := meta.FindCallIndex(call)
+	if err != nil {
+		return err
+	}
 
-	for _, e := range events.System_ExtrinsicFailed {
-		extrinsicIndex := e.Phase.AsApplyExtrinsic
+	// the call is sent by the signer, directly or wrapped in Proxy.proxy
+	sentBySigner := func(extrinsic types.Extrinsic) bool {
+		if string(extrinsic.Signature.Signer.AsID[:]) != string(publicKey) {
+			return false
+		}
+		if cc.proxy == nil {
+			return extrinsic.Method.CallIndex == callIndex
+		}
+		proxyIndex, err := meta.FindCallIndex("Proxy.proxy")
+		if err != nil || extrinsic.Method.CallIndex != proxyIndex {
+			return false
+		}
+		index, ok := proxiedCallIndex(extrinsic.Method.Args)
+		return ok && index == callIndex
+	}
 
-		extrinsic := extrinsics[extrinsicIndex]
-		//who := extrinsic.Signature.Signer.AsID
-		if extrinsic.Method.CallIndex == callIndex && string(extrinsic.Signature.Signer.AsID[:]) == string(kp.PublicKey) {
-			return err
+	for _, e := range events.System_ExtrinsicFailed {
+		if sentBySigner(extrinsics[e.Phase.AsApplyExtrinsic]) {
+			return fmt.Errorf("%s failed", call)
+		}
+	}
+	// a failed proxied call does not fail the extrinsic, check the result of the proxy
+	for _, e := range events.Proxy_ProxyExecuted {
+		if !e.Result.Ok && sentBySigner(extrinsics[e.Phase.AsApplyExtrinsic]) {
+			return fmt.Errorf("%s failed", call)
 		}
 	}
 
@@ -497,20 +581,28 @@ func (cc *ChainClient) CalculateProviderOverdue(agreementIndex uint64) time.Dura
 }
 
 func (cc *ChainClient) CalculateInstanceOverdue(orderIndex uint64) time.Duration {
-	header, err := cc.api.RPC.Chain.GetHeaderLatest()
+	duration, err := cc.InstanceOverdue(orderIndex)
 	if err != nil {
 		return time.Second
 	}
+	return duration
+}
+
+func (cc *ChainClient) InstanceOverdue(orderIndex uint64) (time.Duration, error) {
+	header, err := cc.api.RPC.Chain.GetHeaderLatest()
+	if err != nil {
+		return 0, err
+	}
 	currentNumber := int64(header.Number)
 	order, err := cc.GetOrder(orderIndex)
 	if err != nil {
-		return time.Second
+		return 0, err
 	}
 	overdueNumber := int64(order.RentDuration) + int64(order.Create)
 
 	duration := overdueNumber - currentNumber
 
-	return time.Duration(int64(time.Second) * duration * 6)
+	return time.Duration(int64(time.Second) * duration * 6), nil
 }
 
 func (cc *ChainClient) GetResource(resourceIndex uint64) (*ComputingResource, error) {
@@ -609,11 +701,14 @@ func (cc *ChainClient) GetOrder(orderIndex uint64) (*ComputingOrder, error) {
 
 	var order ComputingOrder
 	ok, err := cc.api.RPC.State.GetStorageLatest(key, &order)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
-		return nil, errors.New("cannot get state with computingResource")
+		return nil, ErrOrderNotFound
 	}
 
-	return &order, err
+	return &order, nil
 }
 
 func (cc *ChainClient) GetAgreementIndex(orderIndex uint64) (uint64, error) {
@@ -640,21 +735,18 @@ func (cc *ChainClient) ReceiveIncome() error {
 		return err
 	}
 
-	c, err := types.NewCall(meta, "ResourceOrder.withdraw_rental_amount", types.NewU64(config.ChainRegInfo.AgreementIndex))
+	callName := "ResourceOrder.withdraw_rental_amount"
+	c, err := types.NewCall(meta, callName, types.NewU64(config.ChainRegInfo.AgreementIndex))
 
 	if err != nil {
 		return err
 	}
 
-	return cc.callAndWatch(c, meta, nil)
+	return cc.fundsCallAndWatch(callName, c, meta, nil)
 }
 
 func (cc *ChainClient) GetAccountInfo() (*AccountInfo, error) {
-	cf, err := cc.cm.GetConfig()
-	if err != nil {
-		return nil, err
-	}
-	keypair, err := signature.KeyringPairFromSecret(cf.SeedOrPhrase, 42)
+	publicKey, address, err := cc.account()
 	if err != nil {
 		return nil, err
 	}
@@ -664,7 +756,7 @@ func (cc *ChainClient) GetAccountInfo() (*AccountInfo, error) {
 	}
 
 	// Get the nonce for Account
-	key, err := types.CreateStorageKey(meta, "System", "Account", keypair.PublicKey)
+	key, err := types.CreateStorageKey(meta, "System", "Account", publicKey)
 	if err != nil {
 		return nil, err
 	}
@@ -678,17 +770,13 @@ func (cc *ChainClient) GetAccountInfo() (*AccountInfo, error) {
 		return nil, errors.New("failed to get account information")
 	}
 	var accountInfo AccountInfo
-	accountInfo.Address = keypair.Address
+	accountInfo.Address = address
 	accountInfo.Amount = account.Data.Free
 	return &accountInfo, nil
 }
 
 func (cc *ChainClient) GetStakingInfo() (*StakingAmount, error) {
-	cf, err := cc.cm.GetConfig()
-	if err != nil {
-		return nil, err
-	}
-	keypair, err := signature.KeyringPairFromSecret(cf.SeedOrPhrase, 42)
+	publicKey, _, err := cc.account()
 	if err != nil {
 		return nil, err
 	}
@@ -696,7 +784,7 @@ func (cc *ChainClient) GetStakingInfo() (*StakingAmount, error) {
 	if err != nil {
 		return nil, err
 	}
-	key, err := types.CreateStorageKey(meta, "ResourceOrder", "Staking", keypair.PublicKey)
+	key, err := types.CreateStorageKey(meta, "ResourceOrder", "Staking", publicKey)
 	if err != nil {
 		return nil, err
 	}
@@ -717,13 +805,14 @@ func (cc *ChainClient) StakingAmount(unitPrice int64) error {
 		return err
 	}
 
-	c, err := types.NewCall(meta, "ResourceOrder.staking_amount", types.NewU128(*big.NewInt(unitPrice)))
+	callName := "ResourceOrder.staking_amount"
+	c, err := types.NewCall(meta, callName, types.NewU128(*big.NewInt(unitPrice)))
 
 	if err != nil {
 		return err
 	}
 
-	return cc.callAndWatch(c, meta, nil)
+	return cc.fundsCallAndWatch(callName, c, meta, nil)
 }
 
 func (cc *ChainClient) WithdrawStakingAmount(unitPrice int64) error {
@@ -732,13 +821,14 @@ func (cc *ChainClient) WithdrawStakingAmount(unitPrice int64) error {
 		return err
 	}
 
-	c, err := types.NewCall(meta, "ResourceOrder.withdraw_amount", types.NewU128(*big.NewInt(unitPrice)))
+	callName := "ResourceOrder.withdraw_amount"
+	c, err := types.NewCall(meta, callName, types.NewU128(*big.NewInt(unitPrice)))
 
 	if err != nil {
 		return err
 	}
 
-	return cc.callAndWatch(c, meta, nil)
+	return cc.fundsCallAndWatch(callName, c, meta, nil)
 }
 
 func (cc *ChainClient) ReceiveIncomeJudge() bool {
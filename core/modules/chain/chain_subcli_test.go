@@ -427,7 +427,7 @@ func TestDisplaySystemEvents(t *testing.T) {
 	}
 }
 
-type AccountInfo struct {
+type subAccountInfo struct {
 	Nonce       types.U32
 	Consumers   types.U32
 	Providers   types.U32
@@ -458,7 +458,7 @@ func TestListenToBalanceChange(t *testing.T) {
 	}
 	fmt.Println(key.Hex())
 
-	var accountInfo AccountInfo
+	var accountInfo subAccountInfo
 	ok, err := api.RPC.State.GetStorageLatest(key, &accountInfo)
 	if err != nil || !ok {
 		panic(err)
@@ -490,7 +490,7 @@ func TestListenToBalanceChange(t *testing.T) {
 				continue
 			}
 
-			var acc AccountInfo
+			var acc subAccountInfo
 			if err = types.DecodeFromBytes(chng.StorageData, &acc); err != nil {
 				panic(err)
 			}
@@ -623,7 +623,7 @@ func TestAccountAmount(t *testing.T) {
 		panic(err)
 	}
 
-	var accountInfo AccountInfo
+	var accountInfo subAccountInfo
 	ok, err := api.RPC.State.GetStorageLatest(key, &accountInfo)
 	if err != nil || !ok {
 		panic(err)
@@ -28,8 +28,14 @@ type ReportClient interface {
 
 	CalculateInstanceOverdue(orderIndex uint64) time.Duration
 
+	// InstanceOverdue the time left of the agreement of the order, fails when the chain cannot be queried
+	InstanceOverdue(orderIndex uint64) (time.Duration, error)
+
 	GetAgreementIndex(orderIndex uint64) (uint64, error)
 
+	// GetOrder get order information
+	GetOrder(orderIndex uint64) (*ComputingOrder, error)
+
 	//GetResource get vm resource
 	GetResource(resourceIndex uint64) (*ComputingResource, error)
 
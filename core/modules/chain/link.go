@@ -127,3 +127,7 @@ func (c *LinkClient) OrderExec(orderIndex uint64) error {
 func (c *LinkClient) CalculateInstanceOverdue(agreementIndex uint64) time.Duration {
 	return time.Second
 }
+
+func (c *LinkClient) InstanceOverdue(agreementIndex uint64) (time.Duration, error) {
+	return time.Second, nil
+}
@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+)
+
+var (
+	// fundsCalls the calls moving the funds of the staking account, never signed by the proxy
+	fundsCalls = []string{
+		"ResourceOrder.staking_amount",
+		"ResourceOrder.withdraw_amount",
+		"ResourceOrder.withdraw_rental_amount",
+	}
+	// fundsPallets none of the calls of the pallets is signed by the proxy, the index of the pallet
+	// is found in the metadata through one of its calls
+	fundsPallets = map[string]string{
+		"Balances": "Balances.transfer",
+		"Staking":  "Staking.bond",
+	}
+)
+
+// ApprovalRequiredError the funds moving call must be signed and submitted by the staking account
+type ApprovalRequiredError struct {
+	Call     string `json:"call"`     // call name
+	CallData string `json:"callData"` // hex encoded call, submit it with the wallet of the staking account
+	Account  string `json:"account"`  // ss58 address of the staking account
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return fmt.Sprintf("%s must be approved by the staking account %s", e.Call, e.Account)
+}
+
+// proxyAccount the staking account and the cold signer of the proxy option
+type proxyAccount struct {
+	address   string
+	publicKey []byte
+	cold      Signer
+}
+
+func newProxyAccount(cm *config.ConfigManager, option config.ProxyOption) (*proxyAccount, error) {
+	if !option.Enabled() {
+		return nil, nil
+	}
+	publicKey, _, err := DecodeSs58Address(option.Real)
+	if err != nil {
+		return nil, err
+	}
+	account := &proxyAccount{
+		address:   option.Real,
+		publicKey: publicKey,
+	}
+	switch option.ColdSigner.Type {
+	case "":
+	case config.SignerRemote:
+		account.cold, err = newSigner(cm, option.ColdSigner)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cold signer must be remote, got: %s", option.ColdSigner.Type)
+	}
+	return account, nil
+}
+
+// coldSigner the signer of the staking account, nil when the call waits for approval
+func (a *proxyAccount) coldSigner() (Signer, error) {
+	if a.cold == nil {
+		return nil, nil
+	}
+	coldKey, err := a.cold.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(coldKey, a.publicKey) {
+		return nil, errors.New("the cold signer is not the staking account")
+	}
+	return a.cold, nil
+}
+
+// refuseFundsCall fail when the call moves the funds of the staking account
+func refuseFundsCall(meta *types.Metadata, c types.Call) error {
+	for _, name := range fundsCalls {
+		if index, err := meta.FindCallIndex(name); err == nil && index == c.CallIndex {
+			return fmt.Errorf("%s is never signed by the proxy", name)
+		}
+	}
+	for pallet, call := range fundsPallets {
+		if index, err := meta.FindCallIndex(call); err == nil && index.SectionIndex == c.CallIndex.SectionIndex {
+			return fmt.Errorf("the calls of %s are never signed by the proxy", pallet)
+		}
+	}
+	return nil
+}
+
+// proxyCall wrap the call in Proxy.proxy, dispatched as the real account
+func proxyCall(meta *types.Metadata, real []byte, c types.Call) (types.Call, error) {
+	if err := refuseFundsCall(meta, c); err != nil {
+		return types.Call{}, err
+	}
+	// the force proxy type is None, any proxy type allowing the call will do
+	return types.NewCall(meta, "Proxy.proxy", types.NewAccountID(real), types.NewOptionU8Empty(), c)
+}
+
+// proxiedCallIndex the call index of the call wrapped in Proxy.proxy
+func proxiedCallIndex(args types.Args) (types.CallIndex, bool) {
+	// real account id (32 bytes), force proxy type None (1 byte), then the call
+	if len(args) < 35 || args[32] != 0 {
+		return types.CallIndex{}, false
+	}
+	return types.CallIndex{SectionIndex: args[33], MethodIndex: args[34]}, true
+}
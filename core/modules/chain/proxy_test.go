@@ -0,0 +1,72 @@
+package chain
+
+import (
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProxiedCallIndex(t *testing.T) {
+	real := make([]byte, 32)
+	real[0] = 1
+	inner := types.Call{
+		CallIndex: types.CallIndex{SectionIndex: 9, MethodIndex: 3},
+		Args:      types.Args{0, 1, 2},
+	}
+	var args types.Args
+	for _, arg := range []interface{}{types.NewAccountID(real), types.NewOptionU8Empty(), inner} {
+		b, err := types.EncodeToBytes(arg)
+		assert.NoError(t, err)
+		args = append(args, b...)
+	}
+
+	index, ok := proxiedCallIndex(args)
+	assert.True(t, ok)
+	assert.Equal(t, inner.CallIndex, index)
+
+	_, ok = proxiedCallIndex(args[:34])
+	assert.False(t, ok)
+}
+
+func TestNewProxyAccount(t *testing.T) {
+	cm := newTestSignerConfig(t)
+	address, _ := NewKeystoreSigner(cm).Address()
+
+	account, err := newProxyAccount(cm, config.ProxyOption{})
+	assert.NoError(t, err)
+	assert.Nil(t, account)
+
+	account, err = newProxyAccount(cm, config.ProxyOption{Real: address})
+	assert.NoError(t, err)
+	cold, err := account.coldSigner()
+	assert.NoError(t, err)
+	assert.Nil(t, cold)
+
+	_, err = newProxyAccount(cm, config.ProxyOption{
+		Real:       address,
+		ColdSigner: config.SignerOption{Type: config.SignerKeystore},
+	})
+	assert.Error(t, err)
+
+	_, err = newProxyAccount(cm, config.ProxyOption{Real: "not an address"})
+	assert.Error(t, err)
+}
+
+func TestProxyRefusesFundsCalls(t *testing.T) {
+	var meta types.Metadata
+	assert.NoError(t, types.DecodeFromHexString(types.MetadataV14Data, &meta))
+	real := make([]byte, 32)
+
+	for _, name := range []string{"Balances.transfer", "Balances.transfer_keep_alive", "Staking.bond"} {
+		c, err := types.NewCall(&meta, name, types.NewAccountID(real), types.NewUCompactFromUInt(1))
+		assert.NoError(t, err)
+		_, err = proxyCall(&meta, real, c)
+		assert.Error(t, err, name)
+	}
+
+	remark, err := types.NewCall(&meta, "System.remark", []byte("heartbeat"))
+	assert.NoError(t, err)
+	_, err = proxyCall(&meta, real, remark)
+	assert.NoError(t, err)
+}
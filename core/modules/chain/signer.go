@@ -0,0 +1,363 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/decred/base58"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/vedhavyas/go-subkey"
+	"golang.org/x/crypto/blake2b"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWatchOnly     = errors.New("watch only account cannot sign transactions")
+	ErrNoSignerToken = errors.New("the signer api cannot be served without a token")
+)
+
+// Signer signs the chain transactions of the provider account
+type Signer interface {
+	// PublicKey the public key of the account
+	PublicKey() ([]byte, error)
+	// Address the ss58 address of the account
+	Address() (string, error)
+	// Sign sign the scale encoded payload with sr25519
+	Sign(payload []byte) ([]byte, error)
+}
+
+// NewSigner create the signer configured in the config
+func NewSigner(cm *config.ConfigManager) (Signer, error) {
+	cfg, err := cm.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(cm, cfg.Signer)
+}
+
+func newSigner(cm *config.ConfigManager, option config.SignerOption) (Signer, error) {
+	switch option.Type {
+	case "", config.SignerKeystore:
+		return NewKeystoreSigner(cm), nil
+	case config.SignerRemote:
+		return NewRemoteSigner(option.RemoteUrl, option.RemoteToken)
+	case config.SignerWatchOnly:
+		return NewWatchOnlySigner(option.Address)
+	default:
+		return nil, fmt.Errorf("unknown signer type: %s", option.Type)
+	}
+}
+
+// KeystoreSigner signs with the seed kept by the config manager, usually in the encrypted keystore
+type KeystoreSigner struct {
+	cm *config.ConfigManager
+}
+
+func NewKeystoreSigner(cm *config.ConfigManager) *KeystoreSigner {
+	return &KeystoreSigner{cm: cm}
+}
+
+func (s *KeystoreSigner) keyringPair() (signature.KeyringPair, error) {
+	cfg, err := s.cm.GetConfig()
+	if err != nil {
+		return signature.KeyringPair{}, err
+	}
+	if cfg.SeedOrPhrase == "" {
+		return signature.KeyringPair{}, errors.New("chain seed is not configured")
+	}
+	return signature.KeyringPairFromSecret(cfg.SeedOrPhrase, cfg.Signer.Prefix())
+}
+
+func (s *KeystoreSigner) PublicKey() ([]byte, error) {
+	kp, err := s.keyringPair()
+	return kp.PublicKey, err
+}
+
+func (s *KeystoreSigner) Address() (string, error) {
+	kp, err := s.keyringPair()
+	return kp.Address, err
+}
+
+func (s *KeystoreSigner) Sign(payload []byte) ([]byte, error) {
+	kp, err := s.keyringPair()
+	if err != nil {
+		return nil, err
+	}
+	return signature.Sign(payload, kp.URI)
+}
+
+// WatchOnlySigner knows the account but cannot sign, the provider can only query the chain
+type WatchOnlySigner struct {
+	address   string
+	publicKey []byte
+}
+
+func NewWatchOnlySigner(address string) (*WatchOnlySigner, error) {
+	publicKey, _, err := DecodeSs58Address(address)
+	if err != nil {
+		return nil, err
+	}
+	return &WatchOnlySigner{
+		address:   address,
+		publicKey: publicKey,
+	}, nil
+}
+
+func (s *WatchOnlySigner) PublicKey() ([]byte, error) {
+	return s.publicKey, nil
+}
+
+func (s *WatchOnlySigner) Address() (string, error) {
+	return s.address, nil
+}
+
+func (s *WatchOnlySigner) Sign(payload []byte) ([]byte, error) {
+	return nil, ErrWatchOnly
+}
+
+// RemoteSigner signs over the http signer api, so the seed can be kept off the provider host
+type RemoteSigner struct {
+	url     string
+	token   string
+	client  *http.Client
+	account *SignerAccount
+	// guards account, a failed query is tried again on the next call
+	lock sync.Mutex
+}
+
+// SignerAccount response of GET /account of the signer api
+type SignerAccount struct {
+	PublicKey string `json:"publicKey"` // hex encoded
+	Address   string `json:"address"`
+}
+
+// SignRequest request of POST /sign of the signer api
+type SignRequest struct {
+	Payload string `json:"payload"` // hex encoded
+}
+
+// SignResponse response of POST /sign of the signer api
+type SignResponse struct {
+	Signature string `json:"signature"` // hex encoded
+}
+
+func NewRemoteSigner(url string, token string) (*RemoteSigner, error) {
+	if url == "" {
+		return nil, errors.New("remote signer url is not configured")
+	}
+	return &RemoteSigner{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: time.Second * 30},
+	}, nil
+}
+
+func (s *RemoteSigner) do(method string, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, s.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("remote signer %s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (s *RemoteSigner) getAccount() (*SignerAccount, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.account != nil {
+		return s.account, nil
+	}
+	var account SignerAccount
+	if err := s.do(http.MethodGet, "/account", nil, &account); err != nil {
+		return nil, err
+	}
+	s.account = &account
+	return s.account, nil
+}
+
+func (s *RemoteSigner) PublicKey() ([]byte, error) {
+	account, err := s.getAccount()
+	if err != nil {
+		return nil, err
+	}
+	return types.HexDecodeString(account.PublicKey)
+}
+
+func (s *RemoteSigner) Address() (string, error) {
+	account, err := s.getAccount()
+	if err != nil {
+		return "", err
+	}
+	return account.Address, nil
+}
+
+func (s *RemoteSigner) Sign(payload []byte) ([]byte, error) {
+	var resp SignResponse
+	err := s.do(http.MethodPost, "/sign", SignRequest{Payload: types.HexEncodeToString(payload)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return types.HexDecodeString(resp.Signature)
+}
+
+// NewSignerHandler serve the signer api with the signer, a local stand-in for a remote signer,
+// every request must carry the token
+func NewSignerHandler(signer Signer, token string) (http.Handler, error) {
+	if token == "" {
+		return nil, ErrNoSignerToken
+	}
+	expected := []byte("Bearer " + token)
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		publicKey, err := signer.PublicKey()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		address, err := signer.Address()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(SignerAccount{
+			PublicKey: types.HexEncodeToString(publicKey),
+			Address:   address,
+		})
+	})
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload, err := types.HexDecodeString(req.Payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sig, err := signer.Sign(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(SignResponse{Signature: types.HexEncodeToString(sig)})
+	})
+	return mux, nil
+}
+
+// signExtrinsic sign the extrinsic like types.Extrinsic.Sign, but with the Signer
+func signExtrinsic(ext *types.Extrinsic, signer Signer, o types.SignatureOptions) error {
+	if ext.Type() != types.ExtrinsicVersion4 {
+		return fmt.Errorf("unsupported extrinsic version: %v", ext.Version)
+	}
+	mb, err := types.EncodeToBytes(ext.Method)
+	if err != nil {
+		return err
+	}
+	era := o.Era
+	if !o.Era.IsMortalEra {
+		era = types.ExtrinsicEra{IsImmortalEra: true}
+	}
+	payload := types.ExtrinsicPayloadV4{
+		ExtrinsicPayloadV3: types.ExtrinsicPayloadV3{
+			Method:      mb,
+			Era:         era,
+			Nonce:       o.Nonce,
+			Tip:         o.Tip,
+			SpecVersion: o.SpecVersion,
+			GenesisHash: o.GenesisHash,
+			BlockHash:   o.BlockHash,
+		},
+		TransactionVersion: o.TransactionVersion,
+	}
+	b, err := types.EncodeToBytes(payload)
+	if err != nil {
+		return err
+	}
+	publicKey, err := signer.PublicKey()
+	if err != nil {
+		return err
+	}
+	sig, err := signer.Sign(b)
+	if err != nil {
+		return err
+	}
+	ext.Signature = types.ExtrinsicSignatureV4{
+		Signer:    types.NewMultiAddressFromAccountID(publicKey),
+		Signature: types.MultiSignature{IsSr25519: true, AsSr25519: types.NewSignature(sig)},
+		Era:       era,
+		Nonce:     o.Nonce,
+		Tip:       o.Tip,
+	}
+	// mark the extrinsic as signed
+	ext.Version |= types.ExtrinsicBitSigned
+	return nil
+}
+
+// DecodeSs58Address decode the public key and the prefix of a ss58 address with a 32 bytes account id
+func DecodeSs58Address(address string) ([]byte, uint8, error) {
+	data := base58.Decode(address)
+	if len(data) != 35 {
+		return nil, 0, fmt.Errorf("invalid ss58 address: %s", address)
+	}
+	prefix, publicKey, checksum := data[0], data[1:33], data[33:]
+	hasher, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	hasher.Write([]byte("SS58PRE"))
+	hasher.Write(data[:33])
+	if !bytes.Equal(hasher.Sum(nil)[:2], checksum) {
+		return nil, 0, fmt.Errorf("invalid ss58 address checksum: %s", address)
+	}
+	return publicKey, prefix, nil
+}
+
+// EncodeSs58Address encode the public key to ss58 address with the prefix
+func EncodeSs58Address(publicKey []byte, prefix uint8) (string, error) {
+	return subkey.SS58Address(publicKey, prefix)
+}
@@ -0,0 +1,85 @@
+package chain
+
+import (
+	"github.com/centrifuge/go-substrate-rpc-client/v4/signature"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+const testSeed = "betray extend distance category chimney globe employ scrap armor success kiss forum"
+
+func newTestSignerConfig(t *testing.T) *config.ConfigManager {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	err := cm.Save(&config.Config{
+		SeedOrPhrase: testSeed,
+	})
+	assert.NoError(t, err)
+	return cm
+}
+
+func TestRemoteSigner(t *testing.T) {
+	local := NewKeystoreSigner(newTestSignerConfig(t))
+	handler, err := NewSignerHandler(local, "token")
+	assert.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	remote, err := NewRemoteSigner(server.URL, "token")
+	assert.NoError(t, err)
+	address, err := remote.Address()
+	assert.NoError(t, err)
+	localAddress, _ := local.Address()
+	assert.Equal(t, localAddress, address)
+
+	publicKey, err := remote.PublicKey()
+	assert.NoError(t, err)
+	localKey, _ := local.PublicKey()
+	assert.Equal(t, localKey, publicKey)
+	payload := []byte("payload")
+	sig, err := remote.Sign(payload)
+	assert.NoError(t, err)
+	ok, err := signature.Verify(payload, sig, testSeed)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	unauthorized, _ := NewRemoteSigner(server.URL, "wrong")
+	_, err = unauthorized.Sign(payload)
+	assert.Error(t, err)
+	anonymous, _ := NewRemoteSigner(server.URL, "")
+	_, err = anonymous.Sign(payload)
+	assert.Error(t, err)
+
+	_, err = NewSignerHandler(local, "")
+	assert.Equal(t, ErrNoSignerToken, err)
+}
+
+func TestWatchOnlySigner(t *testing.T) {
+	local := NewKeystoreSigner(newTestSignerConfig(t))
+	address, err := local.Address()
+	assert.NoError(t, err)
+
+	watch, err := NewWatchOnlySigner(address)
+	assert.NoError(t, err)
+	publicKey, _ := watch.PublicKey()
+	localKey, _ := local.PublicKey()
+	assert.Equal(t, localKey, publicKey)
+	_, err = watch.Sign([]byte("payload"))
+	assert.Equal(t, ErrWatchOnly, err)
+
+	_, err = NewWatchOnlySigner(address[:len(address)-1] + "x")
+	assert.Error(t, err)
+}
+
+func TestSs58Address(t *testing.T) {
+	local := NewKeystoreSigner(newTestSignerConfig(t))
+	publicKey, _ := local.PublicKey()
+	address, err := EncodeSs58Address(publicKey, 0)
+	assert.NoError(t, err)
+	decoded, prefix, err := DecodeSs58Address(address)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0), prefix)
+	assert.Equal(t, publicKey, decoded)
+}
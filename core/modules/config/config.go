@@ -15,6 +15,9 @@ import (
 
 var packageLock sync.Mutex
 
+// updateLock serializes the read-modify-write of the config, packageLock only guards a single read or save
+var updateLock sync.Mutex
+
 const (
 	CONFIG_DIR_NAME         = ".hamster-provider"
 	CONFIG_DEFAULT_FILENAME = "config"
@@ -23,16 +26,23 @@ const (
 
 // Config  config parameter
 type Config struct {
-	ApiPort      int          `json:"apiPort"`      // API port number
-	Identity     Identity     `json:"identity"`     // p2p id
-	Keys         []PublicKey  `json:"keys"`         // public key list
-	Bootstraps   []string     `json:"bootstraps"`   // local nodes's bootstrap peer addresses
-	LinkApi      string       `json:"linkApi"`      // centralized reporting address
-	ChainApi     string       `json:"chainApi"`     // blockchain address
-	SeedOrPhrase string       `json:"seedOrPhrase"` // blockchain account seed or mnemonic
-	Vm           VmOption     `json:"vm"`           // theoretical environment config
-	ChainRegInfo ChainRegInfo `json:"chainRegInfo"` // chain registration information
-	ConfigFlag   ConfigFlag   `json:"configFlag"`
+	ApiPort      int                         `json:"apiPort"`      // API port number
+	Identity     Identity                    `json:"identity"`     // p2p id
+	Keys         []PublicKey                 `json:"keys"`         // public key list
+	Bootstraps   []string                    `json:"bootstraps"`   // local nodes's bootstrap peer addresses
+	LinkApi      string                      `json:"linkApi"`      // centralized reporting address
+	ChainApi     string                      `json:"chainApi"`     // blockchain address
+	SeedOrPhrase string                      `json:"seedOrPhrase"` // blockchain account seed or mnemonic
+	Vm           VmOption                    `json:"vm"`           // theoretical environment config
+	ChainRegInfo ChainRegInfo                `json:"chainRegInfo"` // chain registration information
+	ConfigFlag   ConfigFlag                  `json:"configFlag"`
+	Auth         AuthOption                  `json:"auth"`                // management api authentication
+	Signer       SignerOption                `json:"signer"`              // chain transaction signer
+	Proxy        ProxyOption                 `json:"proxy"`               // sign as the proxy of the staking account
+	Templates    []TemplateOption            `json:"templates"`           // template catalog offered to the tenants
+	Instances    map[string]InstanceTemplate `json:"instances,omitempty"` // template and size of each instance
+	Registries   []RegistryOption            `json:"registries"`          // credentials of the private docker registries
+	Expiry       ExpiryOption                `json:"expiry"`              // grace workflow at the end of the agreement
 }
 
 type ConfigFlag string
@@ -40,6 +50,17 @@ type ConfigFlag string
 const DONE ConfigFlag = "done"
 const NONE ConfigFlag = "none"
 
+// ExpiryOption the tenant is notified before the agreement ends and may download the data volume
+// for a while after the instance is stopped
+type ExpiryOption struct {
+	// blocks before the end of the agreement the notification is sent, 0 is the default of 600
+	NoticeBlocks uint64 `json:"noticeBlocks"`
+	// blocks the data export is kept after the end of the agreement, 0 is the default of 1200
+	GraceBlocks uint64 `json:"graceBlocks"`
+	// the expiry events are posted as json to the url, no notification when empty
+	NotifyUrl string `json:"notifyUrl"`
+}
+
 // VmOption vm configuration information
 type VmOption struct {
 	Cpu        uint64 `json:"cpu"`
@@ -48,8 +69,158 @@ type VmOption struct {
 	System     string `json:"system"`
 	Image      string `json:"image"`
 	AccessPort int    `json:"accessPort"`
-	// virtualization type,docker/kvm
+	// virtualization type,docker/podman/kvm/firecracker
 	Type string `json:"type"`
+	// api socket of podman, the rootless socket of the user when empty, podman only
+	Socket string `json:"socket"`
+	// host ports the access ports of the containers are mapped to, like 30000-39999 (the default), docker/podman only
+	PortRange string `json:"portRange"`
+	// the microvm host settings, firecracker only
+	Firecracker FirecrackerOption `json:"firecracker"`
+	// the account the tenant logs in with, root when the name is empty
+	User TenantUserOption `json:"user"`
+	// packages installed in the instance on the first boot, kvm only
+	Packages []string `json:"packages"`
+	// host cpus the vcpus are pinned to in turn, kvm only
+	CpuSet []uint `json:"cpuset"`
+	// the catalog template used when the order does not choose one
+	Template string `json:"template"`
+	// size limit of the image download cache in GB, 0 is unlimited
+	CacheSize uint64 `json:"cacheSize"`
+	// snapshots kept per order, 0 is the default of 3, -1 disables the snapshots
+	SnapshotQuota int `json:"snapshotQuota"`
+	// mount path of the data volume kept for the whole agreement, /data when empty, - disables the data volume
+	DataPath string `json:"dataPath"`
+	// size of the kvm data disk in GB, 0 is the default of 10
+	DataSize uint64 `json:"dataSize"`
+}
+
+// FirecrackerOption the firecracker binary, the guest kernel and the network of the microvms
+type FirecrackerOption struct {
+	Binary string `json:"binary"` // firecracker in the PATH when empty
+	Kernel string `json:"kernel"` // uncompressed guest kernel (vmlinux)
+	Subnet string `json:"subnet"` // the /30 networks of the taps are taken from it, 172.30.0.0/16 when empty
+	Init   string `json:"init"`   // init the guest boots, it mounts the overlay over the root, /sbin/overlay-init when empty
+}
+
+// TemplateOption a named template of the catalog, a zero limit is not checked
+type TemplateOption struct {
+	Name       string `json:"name"`       // unique name, like ubuntu-20.04
+	Image      string `json:"image"`      // docker image or url of the kvm base image
+	Sha256     string `json:"sha256"`     // hex sha256 of the kvm base image file, or the digest the docker image is pinned to
+	System     string `json:"system"`     // system label shown to the tenants
+	MinCpu     uint64 `json:"minCpu"`     // cores
+	MaxCpu     uint64 `json:"maxCpu"`     // cores
+	MinMem     uint64 `json:"minMem"`     // GB
+	MaxMem     uint64 `json:"maxMem"`     // GB
+	MinDisk    uint64 `json:"minDisk"`    // GB
+	MaxDisk    uint64 `json:"maxDisk"`    // GB
+	AccessPort int    `json:"accessPort"` // ssh port inside the instance, default 22
+	// the isolation of the docker and podman containers, a sandbox runtime or a profile is advertised as hardened,
+	// the capabilities sshd and the tenant user need can not be dropped
+	Runtime  string   `json:"runtime,omitempty"`  // oci runtime, like runsc or kata-runtime, the daemon default when empty
+	Seccomp  string   `json:"seccomp,omitempty"`  // seccomp profile file, the docker default when empty
+	AppArmor string   `json:"apparmor,omitempty"` // apparmor profile loaded on the host
+	CapDrop  []string `json:"capDrop,omitempty"`  // capabilities dropped, like ALL or NET_RAW
+}
+
+// InstanceTemplate the template an instance was created from and its size, the instance is rebuilt and
+// resized from it after a restart
+type InstanceTemplate struct {
+	Template string `json:"template"` // template name, empty is the default template
+	Cpu      uint64 `json:"cpu"`      // cores
+	Mem      uint64 `json:"mem"`      // GB
+	Disk     uint64 `json:"disk"`     // GB
+}
+
+// RegistryOption the credentials of a private docker registry, the password is kept in the keystore when it is used
+type RegistryOption struct {
+	Server        string `json:"server"` // registry host, like registry.example.com:5000, docker.io for docker hub
+	Username      string `json:"username"`
+	Password      string `json:"password,omitempty"`      // password or access token
+	IdentityToken string `json:"identityToken,omitempty"` // oauth identity token used instead of the password
+}
+
+// TenantUserOption the tenant user provisioned inside the instance
+type TenantUserOption struct {
+	Name         string   `json:"name"`         // user name, empty is root
+	Shell        string   `json:"shell"`        // login shell, default /bin/bash
+	Home         string   `json:"home"`         // home directory, default /home/<name>
+	Sudo         string   `json:"sudo"`         // sudo policy, none, all (without password) or commands, default none
+	SudoCommands []string `json:"sudoCommands"` // absolute command paths allowed by the commands policy
+}
+
+// AuthMode management api authentication mode
+type AuthMode string
+
+const (
+	AuthToken AuthMode = "token"
+	AuthMTLS  AuthMode = "mtls"
+)
+
+// Role the scope granted to an api caller
+type Role string
+
+const (
+	RoleReadOnly Role = "read"
+	RoleAdmin    Role = "admin"
+)
+
+// AuthOption management api authentication configuration
+type AuthOption struct {
+	Mode     AuthMode   `json:"mode"`     // token or mtls, default token
+	Tokens   []ApiToken `json:"tokens"`   // api tokens, only the hash is stored
+	CertFile string     `json:"certFile"` // server certificate, used by mtls
+	KeyFile  string     `json:"keyFile"`  // server private key, used by mtls
+	ClientCA string     `json:"clientCa"` // CA that signs client certificates, used by mtls
+}
+
+// ApiToken api token information
+type ApiToken struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"` // hex encoded sha256 of the token
+	Role Role   `json:"role"`
+}
+
+// SignerType how chain transactions are signed
+type SignerType string
+
+const (
+	SignerKeystore  SignerType = "keystore"
+	SignerRemote    SignerType = "remote"
+	SignerWatchOnly SignerType = "watch"
+)
+
+const DefaultSs58Prefix uint8 = 42
+
+// SignerOption chain transaction signer configuration
+type SignerOption struct {
+	Type        SignerType `json:"type"`                 // keystore, remote or watch, default keystore
+	RemoteUrl   string     `json:"remoteUrl"`            // remote signer address, used by remote
+	RemoteToken string     `json:"remoteToken"`          // remote signer bearer token, used by remote
+	Address     string     `json:"address"`              // ss58 address of the account, used by watch
+	Ss58Prefix  *uint8     `json:"ss58Prefix,omitempty"` // ss58 address prefix, default 42
+}
+
+// Prefix the ss58 address prefix of the chain
+func (o SignerOption) Prefix() uint8 {
+	if o.Ss58Prefix == nil {
+		return DefaultSs58Prefix
+	}
+	return *o.Ss58Prefix
+}
+
+// ProxyOption the signer acts as a proxy of the staking account through the Proxy pallet,
+// routine calls are wrapped in Proxy.proxy, funds moving calls are signed by the cold signer,
+// or wait for the approval of the staking account when no cold signer is configured
+type ProxyOption struct {
+	Real       string       `json:"real"`       // ss58 address of the staking account, empty disables the proxy
+	ColdSigner SignerOption `json:"coldSigner"` // signer of the staking account, only remote is supported
+}
+
+// Enabled whether the routine calls are signed as a proxy
+func (o ProxyOption) Enabled() bool {
+	return o.Real != ""
 }
 
 // Identity p2p identity token structure
@@ -60,14 +231,40 @@ type Identity struct {
 }
 
 // PublicKey public key information
+// PublicKey an ssh public key authorized on the instance of the order
 type PublicKey struct {
-	Key string `json:"key"`
+	Key         string    `json:"key"`         // authorized_keys line
+	Order       uint64    `json:"order"`       // order number of the instance
+	Fingerprint string    `json:"fingerprint"` // sha256 fingerprint of the key
+	Source      KeySource `json:"source"`      // where the key comes from
 }
 
+// KeySource where the public key comes from
+type KeySource string
+
+const (
+	KeySourceOrder  KeySource = "order"  // the public key of the tenant in the order
+	KeySourceTenant KeySource = "tenant" // added later by the tenant
+)
+
 type ConfigManager struct {
 	configPath string
+	secrets    SecretStore
+}
+
+// SecretStore keeps the secrets of the config out of the config file
+type SecretStore interface {
+	Get(name string) (string, error)
+	Put(name string, secret string) error
 }
 
+const (
+	SecretSeed    = "seed"
+	SecretPrivKey = "p2p"
+	// SecretRegistry prefix of the registry passwords and tokens, followed by the server
+	SecretRegistry = "registry/"
+)
+
 type ChainRegInfo struct {
 	ResourceIndex   uint64 `json:"resourceIndex"`
 	OrderIndex      uint64 `json:"orderIndex"`
@@ -89,6 +286,16 @@ func NewConfigManagerWithPath(path string) *ConfigManager {
 	}
 }
 
+// SetSecretStore save the chain seed and the p2p private key in the secret store instead of the config file
+func (cm *ConfigManager) SetSecretStore(store SecretStore) {
+	cm.secrets = store
+}
+
+// HasSecretStore whether the secrets are kept out of the config file
+func (cm *ConfigManager) HasSecretStore() bool {
+	return cm.secrets != nil
+}
+
 func DefaultConfigPath() string {
 	return strings.Join([]string{DefaultConfigDir(), CONFIG_DEFAULT_FILENAME}, string(os.PathSeparator))
 }
@@ -122,12 +329,63 @@ func (cm *ConfigManager) GetConfig() (*Config, error) {
 		return nil, fmt.Errorf("failure to decode config: %s", err)
 	}
 
+	if cm.secrets != nil {
+		if seed, err := cm.secrets.Get(SecretSeed); err == nil {
+			cfg.SeedOrPhrase = seed
+		}
+		if privKey, err := cm.secrets.Get(SecretPrivKey); err == nil {
+			cfg.Identity.PrivKey = privKey
+		}
+		for i, r := range cfg.Registries {
+			if password, err := cm.secrets.Get(SecretRegistry + r.Server); err == nil {
+				cfg.Registries[i].Password = password
+			}
+			if token, err := cm.secrets.Get(SecretRegistry + r.Server + "/token"); err == nil {
+				cfg.Registries[i].IdentityToken = token
+			}
+		}
+	}
+
 	return &cfg, nil
 }
 
 func (cm *ConfigManager) Save(config *Config) error {
 	packageLock.Lock()
 	defer packageLock.Unlock()
+
+	if cm.secrets != nil {
+		plain := *config
+		if plain.SeedOrPhrase != "" {
+			if err := cm.secrets.Put(SecretSeed, plain.SeedOrPhrase); err != nil {
+				return err
+			}
+			plain.SeedOrPhrase = ""
+		}
+		if plain.Identity.PrivKey != "" {
+			if err := cm.secrets.Put(SecretPrivKey, plain.Identity.PrivKey); err != nil {
+				return err
+			}
+			plain.Identity.PrivKey = ""
+		}
+		plain.Registries = make([]RegistryOption, len(config.Registries))
+		for i, r := range config.Registries {
+			if r.Password != "" {
+				if err := cm.secrets.Put(SecretRegistry+r.Server, r.Password); err != nil {
+					return err
+				}
+				r.Password = ""
+			}
+			if r.IdentityToken != "" {
+				if err := cm.secrets.Put(SecretRegistry+r.Server+"/token", r.IdentityToken); err != nil {
+					return err
+				}
+				r.IdentityToken = ""
+			}
+			plain.Registries[i] = r
+		}
+		config = &plain
+	}
+
 	f, err := os.OpenFile(cm.configPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0766)
 	defer f.Close()
 	if err != nil {
@@ -140,6 +398,22 @@ func (cm *ConfigManager) Save(config *Config) error {
 	return nil
 }
 
+// Update read the config, change it with fn and save it, the changes of the concurrent updates are not lost.
+// the config is not saved when fn returns an error
+func (cm *ConfigManager) Update(fn func(cfg *Config) error) error {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	cfg, err := cm.GetConfig()
+	if err != nil {
+		return err
+	}
+	if err = fn(cfg); err != nil {
+		return err
+	}
+	return cm.Save(cfg)
+}
+
 func CreateIdentity() (Identity, error) {
 	ident := Identity{
 		SwarmKey: SWARM_KEY,
@@ -150,8 +424,7 @@ func CreateIdentity() (Identity, error) {
 		return ident, err
 	}
 
-	// currently storing key unencrypted. in the future we need to encrypt it.
-	// TODO(security)
+	// the private key is moved to the keystore when the config is saved
 	skbytes, err := crypto.MarshalPrivateKey(priv)
 	if err != nil {
 		return ident, err
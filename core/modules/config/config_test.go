@@ -0,0 +1,29 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUpdateConcurrent(t *testing.T) {
+	cm := NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&Config{}))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, cm.Update(func(cfg *Config) error {
+				cfg.Keys = append(cfg.Keys, PublicKey{Order: uint64(i)})
+				return nil
+			}))
+		}(i)
+	}
+	wg.Wait()
+	cfg, err := cm.GetConfig()
+	assert.NoError(t, err)
+	// no update is lost
+	assert.Len(t, cfg.Keys, 20)
+}
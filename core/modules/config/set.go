@@ -6,41 +6,24 @@ import (
 
 // ConfigVM Configure
 func (cm *ConfigManager) ConfigVM(vmOption VmOption) error {
-
-	config, err := cm.GetConfig()
-	if err != nil {
-		return err
-	}
-	config.Vm = vmOption
-
-	err = cm.Save(config)
-	return err
+	return cm.Update(func(config *Config) error {
+		config.Vm = vmOption
+		return nil
+	})
 }
 
 func (cm *ConfigManager) AddBootstrap(bootstrap string) error {
-	config, err := cm.GetConfig()
-	if err != nil {
-		return err
-	}
-
-	bootstraps := config.Bootstraps
-
-	if utils.Contains(bootstraps, bootstrap) {
+	return cm.Update(func(config *Config) error {
+		if !utils.Contains(config.Bootstraps, bootstrap) {
+			config.Bootstraps = append(config.Bootstraps, bootstrap)
+		}
 		return nil
-	} else {
-		config.Bootstraps = append(bootstraps, bootstrap)
-	}
-
-	return cm.Save(config)
+	})
 }
 
 func (cm *ConfigManager) RemoveBootstrap(bootstrap string) error {
-	config, err := cm.GetConfig()
-	if err != nil {
-		return err
-	}
-
-	config.Bootstraps = utils.Remove(config.Bootstraps, bootstrap)
-
-	return cm.Save(config)
+	return cm.Update(func(config *Config) error {
+		config.Bootstraps = utils.Remove(config.Bootstraps, bootstrap)
+		return nil
+	})
 }
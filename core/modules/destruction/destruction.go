@@ -0,0 +1,246 @@
+package destruction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/expose"
+	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAttempts the pipeline is run again while something of the instance remains
+const DefaultAttempts = 3
+
+const (
+	ReasonExpired   = "expired"   // the agreement ended
+	ReasonWithdrawn = "withdrawn" // the tenant withdrew the order
+)
+
+var (
+	ErrNotVerified     = errors.New("the instance was not destroyed completely")
+	ErrReceiptNotFound = errors.New("destruction receipt not found")
+	// backoff the wait before the next attempt grows with the attempts
+	backoff = 5 * time.Second
+)
+
+// Listeners the p2p listeners exposing the instances
+type Listeners interface {
+	List() *p2p.P2PLsOutput
+	Close(target string) (int, error)
+}
+
+// Keys the public keys of the orders
+type Keys interface {
+	ListKeys(orderNo uint64) ([]config.PublicKey, error)
+	ClearKeys(orderNo uint64) error
+}
+
+// Receipt the record of the destruction of an order instance, kept after the instance is gone
+type Receipt struct {
+	OrderNo  uint64       `json:"orderNo"`
+	Name     string       `json:"name"`
+	Reason   string       `json:"reason"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	Attempts int          `json:"attempts"`
+	Steps    []StepResult `json:"steps"`
+	// what still existed after the last attempt
+	Residue []string `json:"residue"`
+	// nothing of the instance remained
+	Verified bool `json:"verified"`
+}
+
+// StepResult the outcome of a step in the last attempt it ran
+type StepResult struct {
+	Name     string `json:"name"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+type step struct {
+	name string
+	run  func() error
+}
+
+// Pipeline 订单实例的销毁流程: 关闭 p2p 监听, 停止并删除实例及其磁盘和数据卷, 清除公钥,
+// 检查没有残留后记录销毁凭证, 有残留时重试
+type Pipeline struct {
+	vm        vm.Manager
+	listeners Listeners
+	keys      Keys
+	// the receipts are saved in it
+	dir      string
+	attempts int
+	lock     sync.Mutex
+}
+
+func NewPipeline(vmManager vm.Manager, listeners Listeners, keys Keys, dir string) *Pipeline {
+	return &Pipeline{
+		vm:        vmManager,
+		listeners: listeners,
+		keys:      keys,
+		dir:       dir,
+		attempts:  DefaultAttempts,
+	}
+}
+
+// Destroy run the pipeline for the instance until nothing of it remains or the attempts are used up,
+// the receipt is saved in either case and ErrNotVerified is returned when something remains. The pipeline is
+// locked during an attempt only, the other instances are destroyed while it waits for the next one
+func (p *Pipeline) Destroy(name, reason string) (*Receipt, error) {
+	orderNo, _ := vm.ParseInstanceName(name)
+	receipt := &Receipt{
+		OrderNo: orderNo,
+		Name:    name,
+		Reason:  reason,
+		Started: time.Now().UTC(),
+	}
+	// the ssh address is only known while the instance runs, it is kept for the later attempts
+	targets := p.targets(name)
+	steps := []step{
+		{"p2p", func() error { return p.closeListeners(name, targets) }},
+		{"stop", func() error { return p.vm.Stop(name) }},
+		{"destroy", func() error { return p.vm.Destroy(name) }},
+		{"keys", func() error { return p.keys.ClearKeys(orderNo) }},
+	}
+	results := make([]StepResult, len(steps))
+	for i, s := range steps {
+		results[i].Name = s.name
+	}
+
+	for attempt := 1; attempt <= p.attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * backoff)
+		}
+		receipt.Attempts = attempt
+		p.lock.Lock()
+		for i, s := range steps {
+			results[i].Attempts++
+			results[i].Error = ""
+			if err := s.run(); err != nil {
+				results[i].Error = err.Error()
+			}
+		}
+		receipt.Residue = p.residue(name, orderNo, targets)
+		p.lock.Unlock()
+		if len(receipt.Residue) == 0 {
+			receipt.Verified = true
+			break
+		}
+		log.WithField("instance", name).Warnf("destruction attempt %d left %s", attempt, strings.Join(receipt.Residue, ", "))
+	}
+	receipt.Steps = results
+	receipt.Finished = time.Now().UTC()
+
+	if err := p.save(receipt); err != nil {
+		log.WithField("instance", name).Errorf("save destruction receipt fail: %s", err)
+	}
+	if !receipt.Verified {
+		return receipt, ErrNotVerified
+	}
+	return receipt, nil
+}
+
+// Receipt the destruction receipt of the order
+func (p *Pipeline) Receipt(orderNo uint64) (*Receipt, error) {
+	data, err := os.ReadFile(p.receiptFile(orderNo))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var receipt Receipt
+	if err = json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// targets the p2p target address of the ssh port of the instance, none when it is not running
+func (p *Pipeline) targets(name string) []string {
+	ip, err := p.vm.GetIp(name)
+	if err != nil || ip == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("/ip4/%s/tcp/%d", ip, p.vm.GetAccessPort(name))}
+}
+
+// closeListeners close the listeners forwarding to the instance and those under a protocol of the instance,
+// the service ports of the order among them
+func (p *Pipeline) closeListeners(name string, targets []string) error {
+	for _, target := range p.listenerTargets(name, targets) {
+		if _, err := p.listeners.Close(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) listenerTargets(name string, targets []string) []string {
+	var found []string
+	// the service ports are matched by the order, a name that is not of an order has none
+	orderNo, isOrder := vm.ParseInstanceName(name)
+	for _, l := range p.listeners.List().Listeners {
+		if strings.HasSuffix(l.Protocol, "/"+name) || (isOrder && strings.HasPrefix(l.Protocol, expose.Prefix(orderNo))) ||
+			utils.Contains(targets, l.TargetAddress) {
+			found = append(found, l.TargetAddress)
+		}
+	}
+	return found
+}
+
+// residue what remains of the instance, its listeners and its keys
+func (p *Pipeline) residue(name string, orderNo uint64, targets []string) []string {
+	var residue []string
+	if checker, ok := p.vm.(vm.ResidueChecker); ok {
+		found, err := checker.Residue(name)
+		if err != nil {
+			residue = append(residue, "unverified: "+err.Error())
+		}
+		residue = append(residue, found...)
+	} else if _, err := p.vm.Status(name); err == nil {
+		residue = append(residue, "instance "+name)
+	}
+	for _, target := range p.listenerTargets(name, targets) {
+		residue = append(residue, "p2p listener "+target)
+	}
+	keys, err := p.keys.ListKeys(orderNo)
+	if err != nil {
+		residue = append(residue, "unverified: "+err.Error())
+	}
+	for _, k := range keys {
+		residue = append(residue, "public key "+k.Fingerprint)
+	}
+	return residue
+}
+
+func (p *Pipeline) receiptFile(orderNo uint64) string {
+	return filepath.Join(p.dir, strconv.FormatUint(orderNo, 10)+".json")
+}
+
+func (p *Pipeline) save(receipt *Receipt) error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := p.receiptFile(receipt.OrderNo)
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
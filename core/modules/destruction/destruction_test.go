@@ -0,0 +1,175 @@
+package destruction
+
+import (
+	"errors"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeVm struct {
+	vm.Manager
+	// destroy fails until it was called this many times
+	failures  int
+	destroyed int
+	residue   []string
+}
+
+func (f *fakeVm) GetIp(name string) (string, error) {
+	return "172.17.0.2", nil
+}
+
+func (f *fakeVm) GetAccessPort(name string) int {
+	return 22
+}
+
+func (f *fakeVm) Stop(name string) error {
+	return nil
+}
+
+func (f *fakeVm) Destroy(name string) error {
+	f.destroyed++
+	if f.destroyed <= f.failures {
+		return errors.New("volume is in use")
+	}
+	f.residue = nil
+	return nil
+}
+
+func (f *fakeVm) Residue(name string) ([]string, error) {
+	return f.residue, nil
+}
+
+type fakeListeners struct {
+	listeners []p2p.P2PListenerInfoOutput
+}
+
+func (f *fakeListeners) List() *p2p.P2PLsOutput {
+	return &p2p.P2PLsOutput{Listeners: f.listeners}
+}
+
+func (f *fakeListeners) Close(target string) (int, error) {
+	var kept []p2p.P2PListenerInfoOutput
+	for _, l := range f.listeners {
+		if l.TargetAddress != target {
+			kept = append(kept, l)
+		}
+	}
+	done := len(f.listeners) - len(kept)
+	f.listeners = kept
+	return done, nil
+}
+
+type fakeKeys struct {
+	keys map[uint64][]config.PublicKey
+}
+
+func (f *fakeKeys) ListKeys(orderNo uint64) ([]config.PublicKey, error) {
+	return f.keys[orderNo], nil
+}
+
+func (f *fakeKeys) ClearKeys(orderNo uint64) error {
+	delete(f.keys, orderNo)
+	return nil
+}
+
+func newPipeline(t *testing.T, fake *fakeVm) (*Pipeline, *fakeListeners, *fakeKeys) {
+	backoff = time.Millisecond
+	t.Cleanup(func() { backoff = 5 * time.Second })
+	listeners := &fakeListeners{listeners: []p2p.P2PListenerInfoOutput{
+		{Protocol: "/x/ssh", TargetAddress: "/ip4/172.17.0.2/tcp/22"},
+		{Protocol: "/x/export/order_3", TargetAddress: "/ip4/127.0.0.1/tcp/40000"},
+		{Protocol: "/x/hamster/3/8080", TargetAddress: "/ip4/172.20.0.2/tcp/8080"},
+		{Protocol: "/x/ssh", TargetAddress: "/ip4/172.17.0.3/tcp/22"},
+		{Protocol: "/x/hamster/30/8080", TargetAddress: "/ip4/172.21.0.2/tcp/8080"},
+	}}
+	keys := &fakeKeys{keys: map[uint64][]config.PublicKey{
+		3: {{Order: 3, Fingerprint: "SHA256:abc"}},
+		4: {{Order: 4, Fingerprint: "SHA256:def"}},
+	}}
+	return NewPipeline(fake, listeners, keys, t.TempDir()), listeners, keys
+}
+
+func TestDestroy(t *testing.T) {
+	fake := &fakeVm{residue: []string{"container 1"}}
+	p, listeners, keys := newPipeline(t, fake)
+
+	receipt, err := p.Destroy(vm.InstanceName(3), ReasonExpired)
+	assert.NoError(t, err)
+	assert.True(t, receipt.Verified)
+	assert.Equal(t, 1, receipt.Attempts)
+	assert.Empty(t, receipt.Residue)
+	assert.Equal(t, []string{"p2p", "stop", "destroy", "keys"}, []string{
+		receipt.Steps[0].Name, receipt.Steps[1].Name, receipt.Steps[2].Name, receipt.Steps[3].Name,
+	})
+
+	// only the listeners and keys of the order are removed
+	assert.Equal(t, []p2p.P2PListenerInfoOutput{
+		{Protocol: "/x/ssh", TargetAddress: "/ip4/172.17.0.3/tcp/22"},
+		{Protocol: "/x/hamster/30/8080", TargetAddress: "/ip4/172.21.0.2/tcp/8080"},
+	}, listeners.listeners)
+	assert.Len(t, keys.keys[4], 1)
+
+	saved, err := p.Receipt(3)
+	assert.NoError(t, err)
+	assert.Equal(t, ReasonExpired, saved.Reason)
+	assert.True(t, saved.Verified)
+}
+
+func TestDestroyRetry(t *testing.T) {
+	fake := &fakeVm{failures: 1, residue: []string{"volume order_3-data"}}
+	p, _, _ := newPipeline(t, fake)
+
+	receipt, err := p.Destroy(vm.InstanceName(3), ReasonWithdrawn)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, receipt.Attempts)
+	assert.Equal(t, 2, receipt.Steps[2].Attempts)
+	assert.Empty(t, receipt.Steps[2].Error)
+}
+
+func TestDestroyUnlockedBetweenAttempts(t *testing.T) {
+	fake := &fakeVm{failures: 1, residue: []string{"volume order_3-data"}}
+	p, _, _ := newPipeline(t, fake)
+	backoff = 200 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		_, err := p.Destroy(vm.InstanceName(3), ReasonExpired)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// the first attempt left the volume, the pipeline is free while waiting for the next one
+	locked := make(chan struct{})
+	go func() {
+		p.lock.Lock()
+		p.lock.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("the pipeline is locked during the backoff")
+	}
+	assert.NoError(t, <-done)
+}
+
+func TestDestroyNotVerified(t *testing.T) {
+	fake := &fakeVm{failures: 10, residue: []string{"volume order_3-data"}}
+	p, _, _ := newPipeline(t, fake)
+
+	receipt, err := p.Destroy(vm.InstanceName(3), ReasonExpired)
+	assert.ErrorIs(t, err, ErrNotVerified)
+	assert.Equal(t, DefaultAttempts, receipt.Attempts)
+	assert.Equal(t, "volume is in use", receipt.Steps[2].Error)
+	assert.Equal(t, []string{"volume order_3-data"}, receipt.Residue)
+
+	saved, err := p.Receipt(3)
+	assert.NoError(t, err)
+	assert.False(t, saved.Verified)
+
+	_, err = p.Receipt(5)
+	assert.ErrorIs(t, err, ErrReceiptNotFound)
+}
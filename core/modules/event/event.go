@@ -1,6 +1,6 @@
 package event
 
-import "strconv"
+import "github.com/hamster-shared/hamster-provider/core/modules/vm"
 
 type VmRequest struct {
 	Tag         OperationTag
@@ -11,13 +11,14 @@ type VmRequest struct {
 	Type        string
 	Image       string
 	System      string
+	Template    string // catalog template of the instance, the default template when empty
 	PublicKey   string
 	OrderNo     uint64
 	AgreementNo uint64
 }
 
 func (req *VmRequest) getName() string {
-	return "order_" + strconv.Itoa(int(req.OrderNo))
+	return vm.InstanceName(req.OrderNo)
 }
 
 type OperationTag int
@@ -3,7 +3,12 @@ package event
 import (
 	"github.com/hamster-shared/hamster-provider/core/modules/chain"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
+	"github.com/hamster-shared/hamster-provider/core/modules/expiry"
+	"github.com/hamster-shared/hamster-provider/core/modules/expose"
 	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
+	"github.com/hamster-shared/hamster-provider/core/modules/pk"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	"github.com/hamster-shared/hamster-provider/core/modules/vm"
 )
@@ -14,6 +19,11 @@ type EventContext struct {
 	TimerService *utils.TimerService
 	Cm           *config.ConfigManager
 	P2pClient    *p2p.P2pClient
+	PkManager    *pk.Manager
+	Catalog      *template.Catalog
+	Expiry       *expiry.Workflow
+	Destruction  *destruction.Pipeline
+	Services     *expose.Manager
 }
 
 func (ec *EventContext) GetConfig() *config.Config {
@@ -1,5 +1,9 @@
 package event
 
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/expiry"
+)
+
 type IEventService interface {
 	Create(r *VmRequest)
 	Destroy(r *VmRequest)
@@ -28,6 +32,13 @@ func (s *EventService) init(coreContext EventContext) {
 	GlobalEventBus.Sub(destroyHandler.Name(), "destroyHandler", destroyHandler.EventHandleFunc(destroyHandler))
 	GlobalEventBus.Sub(renewHandler.Name(), "renewHandler", renewHandler.EventHandleFunc(renewHandler))
 	GlobalEventBus.Sub(recoverHandler.Name(), "recoverHandler", recoverHandler.EventHandleFunc(recoverHandler))
+
+	// the grace periods in progress before a restart go on
+	if coreContext.Expiry != nil {
+		coreContext.Expiry.Restore(func(name string) expiry.Actions {
+			return expiryActions(coreContext, name)
+		})
+	}
 }
 
 func (s *EventService) Create(req *VmRequest) {
@@ -12,8 +12,28 @@ type CreateVmHandler struct {
 
 func (h *CreateVmHandler) HandlerEvent(e *VmRequest) {
 
+	// the tenant public key of the order, an invalid key is not injected
+	var publicKey string
+	key, _, err := h.CoreContext.PkManager.SyncOrderKey(e.OrderNo, e.PublicKey)
+	if err != nil {
+		log.Errorf("order %d public key is invalid: %s", e.OrderNo, err)
+	} else if key != nil {
+		publicKey = key.Key
+	}
+
+	// the template of the order, kept for the rebuilds and resizes of the instance
+	t, err := h.CoreContext.Catalog.Assign(e.getName(), e.Template, e.Cpu, e.Mem, e.Disk)
+	if err != nil {
+		log.Errorf("order %d template is invalid: %s", e.OrderNo, err)
+		return
+	}
+	if err = h.CoreContext.VmManager.SetInstanceTemplate(e.getName(), t); err != nil {
+		log.Errorf("order %d template %s is unavailable: %s", e.OrderNo, t.Name, err)
+		return
+	}
+
 	// inject public key
-	_, err := h.CoreContext.VmManager.CreateAndStartAndInjectionPublicKey(e.getName(), e.PublicKey)
+	_, err = h.CoreContext.VmManager.CreateAndStartAndInjectionPublicKey(e.getName(), publicKey)
 	if err != nil {
 		log.Error("failed to process order,%v", err)
 		return
@@ -1,6 +1,7 @@
 package event
 
 import (
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,12 +17,15 @@ func (h *DestroyVmHandler) HandlerEvent(e *VmRequest) {
 		log.Error("query agreementNo fail")
 	}
 
-	_ = h.CoreContext.VmManager.Stop(e.getName())
-	_ = h.CoreContext.VmManager.Destroy(e.getName())
+	h.CoreContext.Expiry.Cancel(e.getName())
 	h.CoreContext.TimerService.UnSubTimer(agreementNo)
 	h.CoreContext.TimerService.UnSubTicker(agreementNo)
-	targetAddress := getVmTargetAddress(h.CoreContext, e.getName())
-	_, _ = h.CoreContext.P2pClient.Close(targetAddress)
+	// the p2p listeners, the instance with its disks and volumes and the keys are removed and checked
+	if _, err = h.CoreContext.Destruction.Destroy(e.getName(), destruction.ReasonWithdrawn); err != nil {
+		log.Errorf("destroy the withdrawn instance %s fail: %s", e.getName(), err)
+		return
+	}
+	unassignTemplate(h.CoreContext, e.getName())
 }
 
 func (h *DestroyVmHandler) Name() string {
@@ -29,6 +29,15 @@ func (h *RecoverVmHandler) HandlerEvent(e *VmRequest) {
 		}
 	}
 
+	// the order key may have been changed while the provider was offline
+	if _, changed, err := h.CoreContext.PkManager.SyncOrderKey(e.OrderNo, e.PublicKey); err != nil {
+		log.Errorf("order %d public key is invalid: %s", e.OrderNo, err)
+	} else if changed {
+		if err = h.CoreContext.PkManager.Apply(e.OrderNo); err != nil {
+			log.Errorf("order %d failed to apply public keys: %s", e.OrderNo, err)
+		}
+	}
+
 	err = successDealOrder(h.CoreContext, e.OrderNo, e.getName())
 
 	if err != nil {
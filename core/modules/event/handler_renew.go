@@ -1,6 +1,8 @@
 package event
 
 import (
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -13,20 +15,48 @@ func (h *RenewVmHandler) HandlerEvent(e *VmRequest) {
 
 	orderNo := e.OrderNo
 
-	cm := h.CoreContext.Cm
-	cfg, _ := cm.GetConfig()
-
-	cfg.ChainRegInfo.RenewOrderIndex = orderNo
-	_ = cm.Save(cfg)
+	_ = h.CoreContext.Cm.Update(func(cfg *config.Config) error {
+		cfg.ChainRegInfo.RenewOrderIndex = orderNo
+		return nil
+	})
+	cfg := h.CoreContext.GetConfig()
 	overdue := h.CoreContext.ReportClient.CalculateInstanceOverdue(e.AgreementNo)
-	timer := h.CoreContext.TimerService.GetTimer(e.AgreementNo)
-	timer.Reset(overdue)
+	name := vm.InstanceName(cfg.ChainRegInfo.OrderIndex)
+	if h.CoreContext.Expiry.Schedule(name, overdue, expiryActions(h.CoreContext, name)) {
+		// the instance was stopped at the end of the agreement, expose it again
+		if err := forwardSSHToP2p(h.CoreContext, name); err != nil {
+			log.Errorf("forward the renewed instance %s fail: %s", name, err)
+		}
+		if err := h.CoreContext.Services.Resume(cfg.ChainRegInfo.OrderIndex); err != nil {
+			log.Errorf("expose the service ports of the renewed instance %s fail: %s", name, err)
+		}
+	}
+	syncRenewOrderKey(h.CoreContext, cfg.ChainRegInfo.OrderIndex, orderNo)
 	err := h.CoreContext.ReportClient.OrderExec(orderNo)
 	if err != nil {
 		log.Error("report order exec fail")
 	}
 }
 
+// syncRenewOrderKey the tenant may change the public key when renewing, apply it to the instance of the order
+func syncRenewOrderKey(ctx EventContext, instanceOrderNo, renewOrderNo uint64) {
+	order, err := ctx.ReportClient.GetOrder(renewOrderNo)
+	if err != nil {
+		log.Errorf("query renew order %d fail: %s", renewOrderNo, err)
+		return
+	}
+	_, changed, err := ctx.PkManager.SyncOrderKey(instanceOrderNo, string(order.TenantInfo.PublicKey))
+	if err != nil {
+		log.Errorf("order %d public key is invalid: %s", renewOrderNo, err)
+		return
+	}
+	if changed {
+		if err = ctx.PkManager.Apply(instanceOrderNo); err != nil {
+			log.Errorf("order %d failed to apply public keys: %s", instanceOrderNo, err)
+		}
+	}
+}
+
 func (h *RenewVmHandler) Name() string {
 	return ResourceOrder_ReNewOrderSuccess
 }
@@ -2,6 +2,10 @@ package event
 
 import (
 	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/destruction"
+	"github.com/hamster-shared/hamster-provider/core/modules/expiry"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
 	log "github.com/sirupsen/logrus"
 	"time"
 )
@@ -57,27 +61,53 @@ func forwardSSHToP2p(ctx EventContext, name string) error {
 func dealOverdueOrder(ctx EventContext, agreementIndex uint64, name string) bool {
 	// calculate instance expiration time
 	overdue := ctx.ReportClient.CalculateInstanceOverdue(ctx.GetConfig().ChainRegInfo.OrderIndex)
-	instanceTimer := time.NewTimer(overdue)
-	ctx.TimerService.SubTimer(agreementIndex, instanceTimer)
-
-	go func(t *time.Timer) {
-		<-t.C
-		cfg := ctx.GetConfig()
+	// the tenant is notified before the end, the instance is stopped at the end and destroyed after the data export window
+	ctx.Expiry.Schedule(name, overdue, expiryActions(ctx, name))
+	return overdue < 0
+}
 
-		targetAddress := getVmTargetAddress(ctx, name)
-		_, _ = ctx.P2pClient.Close(targetAddress)
+func expiryActions(ctx EventContext, name string) expiry.Actions {
+	orderNo, isOrder := vm.ParseInstanceName(name)
+	return expiry.Actions{
+		Expire: func() {
+			targetAddress := getVmTargetAddress(ctx, name)
+			_, _ = ctx.P2pClient.Close(targetAddress)
+			// the service ports are exposed again if the order is renewed
+			if isOrder {
+				ctx.Services.Suspend(orderNo)
+			}
+		},
+		Destroy: func() {
+			if isOrder {
+				ctx.Services.Forget(orderNo)
+			}
 
-		// expires triggers close
-		_ = ctx.VmManager.Stop(name)
-		_ = ctx.VmManager.Destroy(name)
-		// modify the resource status on the chain to unused
-		_ = ctx.ReportClient.ChangeResourceStatus(ctx.GetConfig().ChainRegInfo.ResourceIndex)
-		// delete agreement number
-		cfg.ChainRegInfo.OrderIndex = 0
-		cfg.ChainRegInfo.AgreementIndex = 0
-		cfg.ChainRegInfo.RenewOrderIndex = 0
-		_ = ctx.Cm.Save(cfg)
-	}(instanceTimer)
+			_, err := ctx.Destruction.Destroy(name, destruction.ReasonExpired)
+			if err != nil {
+				log.Errorf("destroy the expired instance %s fail: %s", name, err)
+			}
+			// modify the resource status on the chain to unused
+			_ = ctx.ReportClient.ChangeResourceStatus(ctx.GetConfig().ChainRegInfo.ResourceIndex)
+			// delete agreement number, the config is read again as the destruction saved the cleared keys
+			clearOrder := func(cfg *config.Config) error {
+				cfg.ChainRegInfo.OrderIndex = 0
+				cfg.ChainRegInfo.AgreementIndex = 0
+				cfg.ChainRegInfo.RenewOrderIndex = 0
+				return nil
+			}
+			if err := ctx.Cm.Update(clearOrder); err != nil {
+				log.Errorf("clear the order of the expired instance %s fail: %s", name, err)
+			}
+			if err == nil {
+				unassignTemplate(ctx, name)
+			}
+		},
+	}
+}
 
-	return overdue < 0
+// unassignTemplate forget the template of the destroyed instance
+func unassignTemplate(ctx EventContext, name string) {
+	if err := ctx.Catalog.Unassign(name); err != nil {
+		log.Errorf("forget the template of the instance %s fail: %s", name, err)
+	}
 }
@@ -0,0 +1,410 @@
+package expiry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNoticeBlocks the tenant is notified an hour before the end of the agreement
+	DefaultNoticeBlocks = 600
+	// DefaultGraceBlocks the data export is kept two hours after the end of the agreement
+	DefaultGraceBlocks = 1200
+)
+
+// blockTime the chain produces a block every 6 seconds
+var blockTime = 6 * time.Second
+
+// Phase the step of the workflow the instance is in
+type Phase string
+
+const (
+	PhaseRunning   Phase = "running"   // the agreement is in force
+	PhaseNotified  Phase = "notified"  // the tenant was told the agreement is about to end
+	PhaseExport    Phase = "export"    // the instance is stopped, its data volume can be downloaded once the token is set
+	PhaseDestroyed Phase = "destroyed" // the instance and its data are gone
+)
+
+// Status the workflow of an instance, posted to the notify url and returned by the api
+type Status struct {
+	Name     string    `json:"name"`
+	OrderNo  uint64    `json:"orderNo"`
+	Phase    Phase     `json:"phase"`
+	ExpireAt time.Time `json:"expireAt"`
+	// the data volume is served as a tar.gz over the p2p protocol until the deadline,
+	// forward the protocol to a local port and GET /<token>
+	ExportProtocol string `json:"exportProtocol,omitempty"`
+	ExportToken    string `json:"exportToken,omitempty"`
+	ExportSize     int64  `json:"exportSize,omitempty"`
+	// the content of the tarball, the files of the volume or a qcow2 image of the data disk
+	ExportFormat   string    `json:"exportFormat,omitempty"`
+	ExportDeadline time.Time `json:"exportDeadline"`
+}
+
+// Tunnel exposes the export server in the p2p network
+type Tunnel interface {
+	ListenProtocol(protoOpt string, targetOpt string) error
+	Close(target string) (int, error)
+}
+
+// Actions the event handlers take at the steps of the workflow
+type Actions struct {
+	// Expire is called at the end of the agreement, before the instance is stopped
+	Expire func()
+	// Destroy is called when the export window is over, it destroys the instance
+	Destroy func()
+}
+
+// Workflow 协议到期的宽限流程: 到期前通知租户, 到期时停止实例并开放数据卷下载, 宽限期结束后销毁实例
+type Workflow struct {
+	cm     *config.ConfigManager
+	vm     vm.Manager
+	tunnel Tunnel
+	// the export tarballs and the state of the workflows are written in it
+	dir    string
+	client *http.Client
+	// run serializes the steps of the workflows, lock guards the status
+	run    sync.Mutex
+	lock   sync.RWMutex
+	orders map[string]*order
+}
+
+type order struct {
+	status  Status
+	actions Actions
+	timer   *time.Timer
+	export  *export
+}
+
+func NewWorkflow(cm *config.ConfigManager, vmManager vm.Manager, tunnel Tunnel, dir string) *Workflow {
+	return &Workflow{
+		cm:     cm,
+		vm:     vmManager,
+		tunnel: tunnel,
+		dir:    dir,
+		client: &http.Client{Timeout: 10 * time.Second},
+		orders: make(map[string]*order),
+	}
+}
+
+// Schedule start the workflow of the instance whose agreement ends after overdue, a scheduled workflow
+// is replaced. resumed reports the instance was stopped for the export and has been started again
+func (w *Workflow) Schedule(name string, overdue time.Duration, actions Actions) (resumed bool) {
+	w.run.Lock()
+	defer w.run.Unlock()
+
+	if old := w.orders[name]; old != nil {
+		w.stop(old)
+		if old.status.Phase == PhaseExport {
+			if err := w.vm.Start(name); err != nil {
+				log.WithField("instance", name).Errorf("start the renewed instance fail: %s", err)
+			} else {
+				resumed = true
+			}
+		}
+	}
+
+	orderNo, _ := vm.ParseInstanceName(name)
+	expireAt := time.Now().Add(overdue)
+	o := &order{
+		status: Status{
+			Name:           name,
+			OrderNo:        orderNo,
+			Phase:          PhaseRunning,
+			ExpireAt:       expireAt,
+			ExportDeadline: expireAt.Add(blocks(w.options().GraceBlocks)),
+		},
+		actions: actions,
+	}
+	w.lock.Lock()
+	w.orders[name] = o
+	w.save(o.status)
+	w.lock.Unlock()
+
+	if time.Now().Before(expireAt) {
+		w.arm(o, expireAt.Add(-blocks(w.options().NoticeBlocks)), w.notice)
+	} else {
+		w.arm(o, expireAt, w.expire)
+	}
+	return resumed
+}
+
+// Restore resume the workflows saved before the provider restarted, an export that did not survive the
+// restart is written again, a workflow already scheduled is kept
+func (w *Workflow) Restore(actions func(name string) Actions) {
+	files, err := filepath.Glob(filepath.Join(w.dir, "*.json"))
+	if err != nil {
+		log.Errorf("list expiry workflows fail: %s", err)
+		return
+	}
+	w.run.Lock()
+	defer w.run.Unlock()
+	for _, file := range files {
+		var status Status
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, &status)
+		}
+		if err != nil {
+			log.Errorf("read expiry workflow %s fail: %s", file, err)
+			continue
+		}
+		if status.Name == "" || w.orders[status.Name] != nil {
+			continue
+		}
+		if status.Phase == PhaseDestroyed {
+			w.remove(status.Name)
+			continue
+		}
+		o := &order{status: status, actions: actions(status.Name)}
+		w.lock.Lock()
+		w.orders[status.Name] = o
+		w.lock.Unlock()
+
+		if status.Phase == PhaseRunning && time.Now().Before(status.ExpireAt) {
+			w.arm(o, status.ExpireAt.Add(-blocks(w.options().NoticeBlocks)), w.notice)
+		} else {
+			w.arm(o, status.ExpireAt, w.expire)
+		}
+		log.WithField("instance", status.Name).Infof("resume agreement expiry: %s", status.Phase)
+	}
+}
+
+// Cancel stop the workflow of the instance without destroying it, the export is closed
+func (w *Workflow) Cancel(name string) {
+	w.run.Lock()
+	defer w.run.Unlock()
+	if o := w.orders[name]; o != nil {
+		w.stop(o)
+		w.lock.Lock()
+		delete(w.orders, name)
+		w.remove(name)
+		w.lock.Unlock()
+	}
+}
+
+// Status the workflow of the instance
+func (w *Workflow) Status(name string) (Status, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	o, ok := w.orders[name]
+	if !ok {
+		return Status{}, false
+	}
+	return o.status, true
+}
+
+// arm run the step at the time unless the workflow was replaced in the meantime, the caller holds run
+func (w *Workflow) arm(o *order, at time.Time, step func(o *order)) {
+	o.timer = time.AfterFunc(time.Until(at), func() {
+		w.run.Lock()
+		defer w.run.Unlock()
+		if w.current(o) {
+			step(o)
+		}
+	})
+}
+
+// current reports the workflow was not replaced or cancelled
+func (w *Workflow) current(o *order) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.orders[o.status.Name] == o
+}
+
+// stop the timer and the export of the workflow, the caller holds run
+func (w *Workflow) stop(o *order) {
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	if o.export != nil {
+		o.export.close(w.tunnel)
+		o.export = nil
+	}
+}
+
+func (w *Workflow) update(o *order, change func(s *Status)) Status {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	change(&o.status)
+	if o.status.Phase == PhaseDestroyed {
+		w.remove(o.status.Name)
+	} else {
+		w.save(o.status)
+	}
+	return o.status
+}
+
+func (w *Workflow) notice(o *order) {
+	status := w.update(o, func(s *Status) {
+		s.Phase = PhaseNotified
+	})
+	w.arm(o, status.ExpireAt, w.expire)
+	w.notify(status)
+}
+
+// expire stop the instance and serve its data volume until the deadline, the instance is destroyed at once
+// when it has nothing to export
+func (w *Workflow) expire(o *order) {
+	name := o.status.Name
+	if o.actions.Expire != nil {
+		o.actions.Expire()
+	}
+	if err := w.vm.Stop(name); err != nil {
+		log.WithField("instance", name).Errorf("stop the expired instance fail: %s", err)
+	}
+	w.update(o, func(s *Status) {
+		s.Phase = PhaseExport
+		s.ExportProtocol = ""
+		s.ExportToken = ""
+		s.ExportSize = 0
+		s.ExportFormat = ""
+	})
+	w.export(o)
+}
+
+// export write the tarball of the stopped instance outside run, the steps of the other workflows are not held
+// up while the data volume is compressed, the tarball is dropped when the workflow changed in the meantime
+func (w *Workflow) export(o *order) {
+	name := o.status.Name
+	deadline := o.status.ExportDeadline
+	if !time.Now().Before(deadline) {
+		w.finish(o)
+		return
+	}
+	w.arm(o, deadline, w.finish)
+	go func() {
+		e, err := w.startExport(name, deadline)
+		w.run.Lock()
+		defer w.run.Unlock()
+		if !w.current(o) || o.status.Phase != PhaseExport {
+			if e != nil {
+				e.close(w.tunnel)
+			}
+			return
+		}
+		if err == errNothingToExport {
+			w.finish(o)
+			return
+		}
+		if err != nil {
+			// the stopped instance keeps the data until the deadline, it can still be saved by hand
+			log.WithField("instance", name).Errorf("export the data volume fail: %s", err)
+		} else {
+			o.export = e
+		}
+		status := w.update(o, func(s *Status) {
+			if e != nil {
+				s.ExportProtocol = e.protocol
+				s.ExportToken = e.token
+				s.ExportSize = e.size
+				s.ExportFormat = e.format
+			}
+		})
+		w.notify(status)
+	}()
+}
+
+func (w *Workflow) finish(o *order) {
+	w.stop(o)
+	if o.actions.Destroy != nil {
+		o.actions.Destroy()
+	}
+	status := w.update(o, func(s *Status) {
+		s.Phase = PhaseDestroyed
+		s.ExportProtocol = ""
+		s.ExportToken = ""
+		s.ExportSize = 0
+		s.ExportFormat = ""
+	})
+	w.notify(status)
+}
+
+// notify post the status to the notify url of the provider, which passes it on to the tenant
+func (w *Workflow) notify(status Status) {
+	log.WithField("instance", status.Name).Infof("agreement expiry: %s", status.Phase)
+	url := w.options().NotifyUrl
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(status)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	resp, err := w.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.WithField("instance", status.Name).Errorf("post expiry notification fail: %s", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.WithField("instance", status.Name).Errorf("post expiry notification fail: %s", resp.Status)
+	}
+}
+
+// options the expiry configuration with the defaults filled in
+func (w *Workflow) options() config.ExpiryOption {
+	var opt config.ExpiryOption
+	if cfg, err := w.cm.GetConfig(); err == nil {
+		opt = cfg.Expiry
+	}
+	if opt.NoticeBlocks == 0 {
+		opt.NoticeBlocks = DefaultNoticeBlocks
+	}
+	if opt.GraceBlocks == 0 {
+		opt.GraceBlocks = DefaultGraceBlocks
+	}
+	return opt
+}
+
+func blocks(n uint64) time.Duration {
+	return time.Duration(n) * blockTime
+}
+
+func (w *Workflow) stateFile(name string) string {
+	return filepath.Join(w.dir, name+".json")
+}
+
+// save the status of the workflow, the caller holds lock
+func (w *Workflow) save(status Status) {
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		log.WithField("instance", status.Name).Errorf("save expiry workflow fail: %s", err)
+		return
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	file := w.stateFile(status.Name)
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		log.WithField("instance", status.Name).Errorf("save expiry workflow fail: %s", err)
+	}
+}
+
+// remove the saved status of the workflow, the caller holds lock
+func (w *Workflow) remove(name string) {
+	if err := os.Remove(w.stateFile(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.WithField("instance", name).Errorf("remove expiry workflow fail: %s", err)
+	}
+}
+
+// ExportProtocol the p2p protocol the data volume of the instance is served under
+func ExportProtocol(name string) string {
+	return fmt.Sprintf("/x/export/%s", name)
+}
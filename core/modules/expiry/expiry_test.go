@@ -0,0 +1,249 @@
+package expiry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeVm struct {
+	vm.Manager
+	data    string
+	stopped int32
+	started int32
+}
+
+func (f *fakeVm) Stop(name string) error {
+	atomic.AddInt32(&f.stopped, 1)
+	return nil
+}
+
+func (f *fakeVm) Start(name string) error {
+	atomic.AddInt32(&f.started, 1)
+	return nil
+}
+
+func (f *fakeVm) ExportData(name string, w io.Writer) error {
+	if f.data == "" {
+		return vm.ErrNoData
+	}
+	tw := tar.NewWriter(w)
+	if err := tw.WriteHeader(&tar.Header{Name: "data.txt", Mode: 0600, Size: int64(len(f.data))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(f.data)); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (f *fakeVm) DataFormat() string {
+	return vm.DataFiles
+}
+
+type fakeTunnel struct {
+	lock      sync.Mutex
+	listeners map[string]string
+}
+
+func (f *fakeTunnel) ListenProtocol(protoOpt string, targetOpt string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.listeners[targetOpt] = protoOpt
+	return nil
+}
+
+func (f *fakeTunnel) Close(target string) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.listeners[target]; !ok {
+		return 0, nil
+	}
+	delete(f.listeners, target)
+	return 1, nil
+}
+
+func (f *fakeTunnel) target(protoOpt string) string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for target, proto := range f.listeners {
+		if proto == protoOpt {
+			return target
+		}
+	}
+	return ""
+}
+
+func newWorkflow(t *testing.T, fake *fakeVm, opt config.ExpiryOption) (*Workflow, *fakeTunnel) {
+	blockTime = 10 * time.Millisecond
+	t.Cleanup(func() { blockTime = 6 * time.Second })
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{Expiry: opt}))
+	tunnel := &fakeTunnel{listeners: map[string]string{}}
+	return NewWorkflow(cm, fake, tunnel, filepath.Join(t.TempDir(), "exports")), tunnel
+}
+
+func phase(w *Workflow, name string) Phase {
+	status, _ := w.Status(name)
+	return status.Phase
+}
+
+// exported the tarball is written in the background after the instance is stopped
+func exported(w *Workflow, name string) bool {
+	status, _ := w.Status(name)
+	return status.ExportToken != ""
+}
+
+func TestWorkflow(t *testing.T) {
+	fake := &fakeVm{data: "tenant data"}
+	w, tunnel := newWorkflow(t, fake, config.ExpiryOption{NoticeBlocks: 5, GraceBlocks: 30})
+	name := vm.InstanceName(7)
+	var expired, destroyed int32
+	w.Schedule(name, 100*time.Millisecond, Actions{
+		Expire:  func() { atomic.AddInt32(&expired, 1) },
+		Destroy: func() { atomic.AddInt32(&destroyed, 1) },
+	})
+	status, ok := w.Status(name)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), status.OrderNo)
+	assert.Equal(t, PhaseRunning, status.Phase)
+
+	assert.Eventually(t, func() bool { return phase(w, name) == PhaseNotified }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return exported(w, name) }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, PhaseExport, phase(w, name))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&expired))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.stopped))
+
+	status, _ = w.Status(name)
+	assert.Equal(t, "/x/export/order_7", status.ExportProtocol)
+	assert.NotZero(t, status.ExportSize)
+	assert.Equal(t, vm.DataFiles, status.ExportFormat)
+	target := tunnel.target(status.ExportProtocol)
+	assert.NotEmpty(t, target)
+	port := target[strings.LastIndex(target, "/")+1:]
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%s/wrong", port))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%s/%s", port, status.ExportToken))
+	assert.NoError(t, err)
+	gz, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "data.txt", header.Name)
+	content, _ := io.ReadAll(tr)
+	assert.Equal(t, "tenant data", string(content))
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool { return phase(w, name) == PhaseDestroyed }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&destroyed))
+	assert.Empty(t, tunnel.target(status.ExportProtocol))
+	assert.NoFileExists(t, filepath.Join(w.dir, name+".tar.gz"))
+}
+
+func TestWorkflowRenew(t *testing.T) {
+	fake := &fakeVm{data: "tenant data"}
+	w, tunnel := newWorkflow(t, fake, config.ExpiryOption{NoticeBlocks: 1, GraceBlocks: 100})
+	name := vm.InstanceName(8)
+	var destroyed int32
+	actions := Actions{Destroy: func() { atomic.AddInt32(&destroyed, 1) }}
+
+	assert.False(t, w.Schedule(name, 0, actions))
+	assert.Eventually(t, func() bool { return exported(w, name) }, time.Second, 5*time.Millisecond)
+	status, _ := w.Status(name)
+
+	// renewing the expired instance starts it again and closes the export
+	assert.True(t, w.Schedule(name, time.Hour, actions))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fake.started))
+	assert.Equal(t, PhaseRunning, phase(w, name))
+	assert.Empty(t, tunnel.target(status.ExportProtocol))
+	assert.NoFileExists(t, filepath.Join(w.dir, name+".tar.gz"))
+
+	w.Cancel(name)
+	assert.NoFileExists(t, filepath.Join(w.dir, name+".json"))
+	_, ok := w.Status(name)
+	assert.False(t, ok)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&destroyed))
+}
+
+func TestWorkflowNothingToExport(t *testing.T) {
+	var phases []Phase
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var status Status
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&status))
+		lock.Lock()
+		phases = append(phases, status.Phase)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	w, _ := newWorkflow(t, &fakeVm{}, config.ExpiryOption{NoticeBlocks: 1, GraceBlocks: 100, NotifyUrl: server.URL})
+	name := vm.InstanceName(9)
+	var destroyed int32
+	w.Schedule(name, 20*time.Millisecond, Actions{Destroy: func() { atomic.AddInt32(&destroyed, 1) }})
+
+	// the instance without a data volume is destroyed at the end of the agreement
+	assert.Eventually(t, func() bool { return phase(w, name) == PhaseDestroyed }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&destroyed))
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(phases) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []Phase{PhaseNotified, PhaseDestroyed}, phases)
+}
+
+func TestWorkflowRestore(t *testing.T) {
+	fake := &fakeVm{data: "tenant data"}
+	w, tunnel := newWorkflow(t, fake, config.ExpiryOption{NoticeBlocks: 1, GraceBlocks: 100})
+	running, expired := vm.InstanceName(10), vm.InstanceName(11)
+	w.Schedule(running, time.Hour, Actions{})
+	w.Schedule(expired, 0, Actions{})
+	assert.Eventually(t, func() bool { return exported(w, expired) }, time.Second, 5*time.Millisecond)
+	before, _ := w.Status(running)
+	old, _ := w.Status(expired)
+
+	// the provider restarts, the export server is gone with it
+	state := filepath.Join(w.dir, expired+".json")
+	data, err := os.ReadFile(state)
+	assert.NoError(t, err)
+	w.Cancel(expired)
+	assert.NoError(t, os.WriteFile(state, data, 0600))
+	restarted := NewWorkflow(w.cm, fake, tunnel, w.dir)
+	var destroyed int32
+	restarted.Restore(func(name string) Actions {
+		return Actions{Destroy: func() { atomic.AddInt32(&destroyed, 1) }}
+	})
+	status, ok := restarted.Status(running)
+	assert.True(t, ok)
+	assert.Equal(t, PhaseRunning, status.Phase)
+	assert.True(t, before.ExpireAt.Equal(status.ExpireAt))
+
+	// the export is written again behind a new token and destroyed at the deadline
+	assert.Eventually(t, func() bool {
+		status, _ := restarted.Status(expired)
+		return status.ExportToken != "" && status.ExportToken != old.ExportToken
+	}, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return phase(restarted, expired) == PhaseDestroyed }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&destroyed))
+	assert.NoFileExists(t, state)
+}
@@ -0,0 +1,146 @@
+package expiry
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errNothingToExport the virtualization can not export data or the instance has no data volume
+var errNothingToExport = errors.New("nothing to export")
+
+// export the tarball of a data volume served on a local port until the deadline
+type export struct {
+	file     string
+	token    string
+	size     int64
+	format   string
+	protocol string
+	target   string
+	server   *http.Server
+}
+
+// startExport write the data volume of the stopped instance as a tar.gz and serve it on a random local
+// port behind a random token, the port is exposed in the p2p network under the export protocol
+func (w *Workflow) startExport(name string, deadline time.Time) (*export, error) {
+	exporter, ok := w.vm.(vm.DataExporter)
+	if !ok {
+		return nil, errNothingToExport
+	}
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		return nil, err
+	}
+	file := filepath.Join(w.dir, name+".tar.gz")
+	size, err := writeExport(exporter, name, file)
+	if errors.Is(err, vm.ErrNoData) {
+		return nil, errNothingToExport
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := newToken()
+	if err != nil {
+		_ = os.Remove(file)
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		_ = os.Remove(file)
+		return nil, err
+	}
+	e := &export{
+		file:     file,
+		token:    token,
+		size:     size,
+		format:   exporter.DataFormat(),
+		protocol: ExportProtocol(name),
+		target:   fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", l.Addr().(*net.TCPAddr).Port),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+token, func(rw http.ResponseWriter, r *http.Request) {
+		if time.Now().After(deadline) {
+			http.Error(rw, "the export has expired", http.StatusGone)
+			return
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			http.Error(rw, "the export is unavailable", http.StatusGone)
+			return
+		}
+		defer f.Close()
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(file)))
+		// range requests let an interrupted download resume
+		http.ServeContent(rw, r, filepath.Base(file), time.Time{}, f)
+	})
+	e.server = &http.Server{Handler: mux}
+	go func() {
+		if err := e.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.WithField("instance", name).Errorf("export server fail: %s", err)
+		}
+	}()
+
+	if w.tunnel != nil {
+		if err = w.tunnel.ListenProtocol(e.protocol, e.target); err != nil {
+			e.close(nil)
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// close the p2p listener and the server and remove the tarball
+func (e *export) close(tunnel Tunnel) {
+	if tunnel != nil {
+		_, _ = tunnel.Close(e.target)
+	}
+	_ = e.server.Close()
+	if err := os.Remove(e.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Errorf("remove export %s fail: %s", e.file, err)
+	}
+}
+
+func writeExport(exporter vm.DataExporter, name, file string) (int64, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(f)
+	err = exporter.ExportData(name, gz)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file)
+		return 0, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
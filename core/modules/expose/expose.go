@@ -0,0 +1,247 @@
+package expose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxPorts the service ports an order may expose at once
+const MaxPorts = 16
+
+var (
+	ErrInvalidPort  = errors.New("port must be within 1-65535")
+	ErrTooManyPorts = fmt.Errorf("an order may expose at most %d ports", MaxPorts)
+)
+
+// Tunnel the p2p listeners the ports are exposed by
+type Tunnel interface {
+	ListenProtocol(protoOpt string, targetOpt string) error
+	List() *p2p.P2PLsOutput
+	CloseProtocol(protoOpt string) int
+}
+
+// Port a port of the instance exposed in the p2p network, forward the protocol from the
+// provider peer to a local port to reach it
+type Port struct {
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	Target   string `json:"target"`
+}
+
+// Manager 将订单实例内租户选择的服务端口暴露到 p2p 网络, 每个端口使用独立的协议, 查询和关闭都限定在订单内
+type Manager struct {
+	vm     vm.Manager
+	tunnel Tunnel
+	lock   sync.Mutex
+	// the ports closed at the end of the agreement, exposed again when the order is renewed, they are kept
+	// in the file over a restart
+	suspended map[uint64][]int
+	file      string
+}
+
+// NewManager the manager of the service ports, the suspended ports are kept in the file
+func NewManager(vmManager vm.Manager, tunnel Tunnel, file string) *Manager {
+	m := &Manager{
+		vm:        vmManager,
+		tunnel:    tunnel,
+		suspended: map[uint64][]int{},
+		file:      file,
+	}
+	data, err := os.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &m.suspended)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Errorf("read the suspended service ports fail: %s", err)
+	}
+	return m
+}
+
+// Protocol the p2p protocol the port of the instance of the order is exposed under
+func Protocol(orderNo uint64, port int) string {
+	return fmt.Sprintf("%s%d", Prefix(orderNo), port)
+}
+
+// Prefix the prefix of the protocols of the ports of the order
+func Prefix(orderNo uint64) string {
+	return fmt.Sprintf("/x/hamster/%d/", orderNo)
+}
+
+// List the exposed ports of the order
+func (m *Manager) List(orderNo uint64) []Port {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.list(orderNo)
+}
+
+// Expose the ports of the instance of the order, the exposed ports are kept, the ports opened in the call
+// are closed again when one of them fails
+func (m *Manager) Expose(orderNo uint64, ports []int) ([]Port, error) {
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return nil, ErrInvalidPort
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	exposed := map[int]bool{}
+	for _, p := range m.list(orderNo) {
+		exposed[p.Port] = true
+	}
+	var add []int
+	for _, port := range ports {
+		if !exposed[port] {
+			exposed[port] = true
+			add = append(add, port)
+		}
+	}
+	if len(exposed) > MaxPorts {
+		return nil, ErrTooManyPorts
+	}
+
+	name := vm.InstanceName(orderNo)
+	var opened []string
+	for _, port := range add {
+		target, err := m.target(name, port)
+		if err == nil {
+			err = m.tunnel.ListenProtocol(Protocol(orderNo, port), target)
+		}
+		if err != nil {
+			for _, protocol := range opened {
+				m.tunnel.CloseProtocol(protocol)
+			}
+			return nil, fmt.Errorf("expose port %d fail: %w", port, err)
+		}
+		opened = append(opened, Protocol(orderNo, port))
+	}
+	return m.list(orderNo), nil
+}
+
+// Close the ports of the order, all of them when ports is empty, return the number of closed listeners
+func (m *Manager) Close(orderNo uint64, ports []int) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(ports) == 0 {
+		for _, p := range m.list(orderNo) {
+			ports = append(ports, p.Port)
+		}
+	}
+	done := 0
+	for _, port := range ports {
+		done += m.tunnel.CloseProtocol(Protocol(orderNo, port))
+	}
+	return done
+}
+
+// Suspend close the ports of the order when its instance is stopped at the end of the agreement
+func (m *Manager) Suspend(orderNo uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var ports []int
+	for _, p := range m.list(orderNo) {
+		ports = append(ports, p.Port)
+		m.tunnel.CloseProtocol(p.Protocol)
+	}
+	if len(ports) > 0 {
+		m.suspended[orderNo] = ports
+		m.save()
+	}
+}
+
+// Resume expose the ports suspended at the end of the agreement again, after the order is renewed
+func (m *Manager) Resume(orderNo uint64) error {
+	m.lock.Lock()
+	ports := m.suspended[orderNo]
+	m.lock.Unlock()
+	if len(ports) == 0 {
+		return nil
+	}
+	if _, err := m.Expose(orderNo, ports); err != nil {
+		// the ports stay suspended, the renewal can be retried
+		return err
+	}
+	m.Forget(orderNo)
+	return nil
+}
+
+// Forget drop the suspended ports of the order, its instance is destroyed
+func (m *Manager) Forget(orderNo uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.suspended[orderNo]; ok {
+		delete(m.suspended, orderNo)
+		m.save()
+	}
+}
+
+// save the suspended ports, the caller holds the lock
+func (m *Manager) save() {
+	err := os.MkdirAll(filepath.Dir(m.file), 0700)
+	var data []byte
+	if err == nil {
+		data, err = json.MarshalIndent(m.suspended, "", "  ")
+	}
+	tmp := m.file + ".tmp"
+	if err == nil {
+		err = os.WriteFile(tmp, data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, m.file)
+	}
+	if err != nil {
+		log.Errorf("save the suspended service ports fail: %s", err)
+	}
+}
+
+func (m *Manager) list(orderNo uint64) []Port {
+	prefix := Prefix(orderNo)
+	ports := []Port{}
+	for _, l := range m.tunnel.List().Listeners {
+		if !strings.HasPrefix(l.Protocol, prefix) {
+			continue
+		}
+		port, err := strconv.Atoi(strings.TrimPrefix(l.Protocol, prefix))
+		if err != nil {
+			continue
+		}
+		ports = append(ports, Port{Port: port, Protocol: l.Protocol, Target: l.TargetAddress})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+	return ports
+}
+
+// target the multiaddr the port of the instance is reached at from the host
+func (m *Manager) target(name string, port int) (string, error) {
+	var ip string
+	var err error
+	if resolver, ok := m.vm.(vm.ServiceResolver); ok {
+		ip, port, err = resolver.ServiceAddress(name, port)
+	} else {
+		ip, err = m.vm.GetIp(name)
+	}
+	if err != nil {
+		log.WithField("instance", name).Errorf("resolve the address of port %d fail: %s", port, err)
+		return "", fmt.Errorf("the instance is not reachable: %w", err)
+	}
+	addr := net.ParseIP(ip)
+	switch {
+	case addr == nil:
+		return "", fmt.Errorf("the instance has no address: %q", ip)
+	case addr.To4() != nil:
+		return fmt.Sprintf("/ip4/%s/tcp/%d", addr, port), nil
+	default:
+		return fmt.Sprintf("/ip6/%s/tcp/%d", addr, port), nil
+	}
+}
@@ -0,0 +1,189 @@
+package expose
+
+import (
+	"errors"
+	"github.com/hamster-shared/hamster-provider/core/modules/p2p"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+type fakeTunnel struct {
+	listeners []p2p.P2PListenerInfoOutput
+	// the protocol the listener fails on
+	fail string
+}
+
+func (f *fakeTunnel) ListenProtocol(protoOpt string, targetOpt string) error {
+	if protoOpt == f.fail {
+		return errors.New("protocol handler already registered")
+	}
+	f.listeners = append(f.listeners, p2p.P2PListenerInfoOutput{Protocol: protoOpt, TargetAddress: targetOpt})
+	return nil
+}
+
+func (f *fakeTunnel) List() *p2p.P2PLsOutput {
+	return &p2p.P2PLsOutput{Listeners: f.listeners}
+}
+
+func (f *fakeTunnel) CloseProtocol(protoOpt string) int {
+	done := 0
+	var kept []p2p.P2PListenerInfoOutput
+	for _, l := range f.listeners {
+		if l.Protocol == protoOpt {
+			done++
+			continue
+		}
+		kept = append(kept, l)
+	}
+	f.listeners = kept
+	return done
+}
+
+type fakeVm struct {
+	vm.Manager
+	ip string
+}
+
+func (f *fakeVm) GetIp(name string) (string, error) {
+	if f.ip == "" {
+		return "", errors.New("not running")
+	}
+	return f.ip, nil
+}
+
+// fakeContainer maps the ports like the docker manager, the published ports are on the host
+type fakeContainer struct {
+	fakeVm
+}
+
+func (f *fakeContainer) ServiceAddress(name string, port int) (string, int, error) {
+	if port == 22 {
+		return "127.0.0.1", 31022, nil
+	}
+	return "172.20.0.2", port, nil
+}
+
+func newManager(t *testing.T, ip string) (*Manager, *fakeTunnel) {
+	tunnel := &fakeTunnel{listeners: []p2p.P2PListenerInfoOutput{
+		{Protocol: "/x/ssh", TargetAddress: "/ip4/192.168.122.10/tcp/22"},
+		{Protocol: Protocol(2, 80), TargetAddress: "/ip4/192.168.122.11/tcp/80"},
+	}}
+	return NewManager(&fakeVm{ip: ip}, tunnel, filepath.Join(t.TempDir(), "services.json")), tunnel
+}
+
+func TestExpose(t *testing.T) {
+	m, _ := newManager(t, "192.168.122.10")
+
+	ports, err := m.Expose(1, []int{8080, 3000, 8080})
+	assert.NoError(t, err)
+	assert.Equal(t, []Port{
+		{Port: 3000, Protocol: "/x/hamster/1/3000", Target: "/ip4/192.168.122.10/tcp/3000"},
+		{Port: 8080, Protocol: "/x/hamster/1/8080", Target: "/ip4/192.168.122.10/tcp/8080"},
+	}, ports)
+
+	// exposing a port again keeps its listener
+	ports, err = m.Expose(1, []int{3000})
+	assert.NoError(t, err)
+	assert.Len(t, ports, 2)
+
+	// the ports of another order are not listed
+	assert.Equal(t, []Port{{Port: 80, Protocol: "/x/hamster/2/80", Target: "/ip4/192.168.122.11/tcp/80"}}, m.List(2))
+	assert.Equal(t, []Port{}, m.List(3))
+}
+
+func TestExposeInvalid(t *testing.T) {
+	m, _ := newManager(t, "192.168.122.10")
+	_, err := m.Expose(1, []int{0})
+	assert.ErrorIs(t, err, ErrInvalidPort)
+	_, err = m.Expose(1, []int{65536})
+	assert.ErrorIs(t, err, ErrInvalidPort)
+
+	var ports []int
+	for port := 8000; port <= 8000+MaxPorts; port++ {
+		ports = append(ports, port)
+	}
+	_, err = m.Expose(1, ports)
+	assert.ErrorIs(t, err, ErrTooManyPorts)
+	assert.Empty(t, m.List(1))
+
+	// the instance is not running
+	stopped, _ := newManager(t, "")
+	_, err = stopped.Expose(1, []int{8080})
+	assert.Error(t, err)
+}
+
+func TestExposeResolver(t *testing.T) {
+	tunnel := &fakeTunnel{}
+	m := NewManager(&fakeContainer{}, tunnel, filepath.Join(t.TempDir(), "services.json"))
+	ports, err := m.Expose(1, []int{22, 8080})
+	assert.NoError(t, err)
+	assert.Equal(t, "/ip4/127.0.0.1/tcp/31022", ports[0].Target)
+	assert.Equal(t, "/ip4/172.20.0.2/tcp/8080", ports[1].Target)
+}
+
+func TestClose(t *testing.T) {
+	m, tunnel := newManager(t, "192.168.122.10")
+	_, err := m.Expose(1, []int{3000, 8080, 9000})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, m.Close(1, []int{8080}))
+	assert.Equal(t, 0, m.Close(1, []int{8080}))
+	assert.Equal(t, 2, m.Close(1, nil))
+	assert.Empty(t, m.List(1))
+
+	// the ssh listener and the ports of the other orders stay
+	assert.Equal(t, []p2p.P2PListenerInfoOutput{
+		{Protocol: "/x/ssh", TargetAddress: "/ip4/192.168.122.10/tcp/22"},
+		{Protocol: "/x/hamster/2/80", TargetAddress: "/ip4/192.168.122.11/tcp/80"},
+	}, tunnel.listeners)
+}
+
+func TestSuspendResume(t *testing.T) {
+	m, _ := newManager(t, "192.168.122.10")
+	_, err := m.Expose(1, []int{3000, 8080})
+	assert.NoError(t, err)
+
+	m.Suspend(1)
+	assert.Empty(t, m.List(1))
+	assert.NoError(t, m.Resume(1))
+	assert.Len(t, m.List(1), 2)
+	// the suspended ports are exposed once
+	m.Close(1, nil)
+	assert.NoError(t, m.Resume(1))
+	assert.Empty(t, m.List(1))
+
+	_, err = m.Expose(1, []int{3000})
+	assert.NoError(t, err)
+	m.Suspend(1)
+	m.Forget(1)
+	assert.NoError(t, m.Resume(1))
+	assert.Empty(t, m.List(1))
+}
+
+func TestExposeRollback(t *testing.T) {
+	m, tunnel := newManager(t, "192.168.122.10")
+	_, err := m.Expose(1, []int{3000})
+	assert.NoError(t, err)
+
+	// the listeners opened before the failing port are closed, the exposed ports stay
+	tunnel.fail = Protocol(1, 9000)
+	_, err = m.Expose(1, []int{8080, 9000})
+	assert.Error(t, err)
+	assert.Equal(t, []Port{{Port: 3000, Protocol: "/x/hamster/1/3000", Target: "/ip4/192.168.122.10/tcp/3000"}}, m.List(1))
+}
+
+func TestSuspendedKept(t *testing.T) {
+	m, tunnel := newManager(t, "192.168.122.10")
+	_, err := m.Expose(1, []int{3000, 8080})
+	assert.NoError(t, err)
+	m.Suspend(1)
+
+	// the provider restarts before the order is renewed
+	restarted := NewManager(m.vm, tunnel, m.file)
+	assert.NoError(t, restarted.Resume(1))
+	assert.Len(t, restarted.List(1), 2)
+	again := NewManager(m.vm, tunnel, m.file)
+	assert.Empty(t, again.suspended)
+}
@@ -0,0 +1,278 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	keystoreFilename = "keystore.json"
+	keystoreVersion  = 1
+	kdfScrypt        = "scrypt"
+	cipherAesGcm     = "aes-256-gcm"
+
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	keyLength = 32
+	saltBytes = 32
+
+	// checkName the additional data of the blob the passphrase is verified with
+	checkName  = "keystore-check"
+	checkValue = "hamster-provider keystore"
+)
+
+var (
+	ErrKeyNotFound     = errors.New("key not found in keystore")
+	ErrWrongPassphrase = errors.New("cannot unlock keystore, wrong passphrase?")
+)
+
+// Keystore keeps secrets encrypted on disk with a key derived from a passphrase by scrypt,
+// every secret is sealed by aes-256-gcm with its name as additional data
+type Keystore struct {
+	lock    sync.Mutex
+	path    string
+	key     []byte
+	file    keystoreFile
+	secrets map[string]string
+}
+
+type keystoreFile struct {
+	Version   int       `json:"version"`
+	Kdf       string    `json:"kdf"`
+	KdfParams kdfParams `json:"kdfParams"`
+	Cipher    string    `json:"cipher"`
+	// Check a known value sealed with the key, required, so an empty keystore is unlocked with its passphrase only
+	Check *encryptedKey           `json:"check,omitempty"`
+	Keys  map[string]encryptedKey `json:"keys"`
+}
+
+type kdfParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+type encryptedKey struct {
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// DefaultPath the keystore in the config directory
+func DefaultPath(configDir string) string {
+	return filepath.Join(configDir, keystoreFilename)
+}
+
+// Exists whether the keystore file exists
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Create create an empty keystore protected by the passphrase
+func Create(path string, passphrase []byte) (*Keystore, error) {
+	if Exists(path) {
+		return nil, fmt.Errorf("keystore %s already exists", path)
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore passphrase cannot be empty")
+	}
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		path: path,
+		file: keystoreFile{
+			Version: keystoreVersion,
+			Kdf:     kdfScrypt,
+			KdfParams: kdfParams{
+				N:    scryptN,
+				R:    scryptR,
+				P:    scryptP,
+				Salt: hex.EncodeToString(salt),
+			},
+			Cipher: cipherAesGcm,
+			Keys:   map[string]encryptedKey{},
+		},
+		secrets: map[string]string{},
+	}
+	key, err := ks.file.KdfParams.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ks.key = key
+	if err = ks.seal(); err != nil {
+		return nil, err
+	}
+	return ks, ks.save()
+}
+
+// Open unlock the keystore, fails if the passphrase is wrong
+func Open(path string, passphrase []byte) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ks := &Keystore{
+		path:    path,
+		secrets: map[string]string{},
+	}
+	if err = json.Unmarshal(data, &ks.file); err != nil {
+		return nil, fmt.Errorf("failure to decode keystore: %s", err)
+	}
+	if ks.file.Version != keystoreVersion || ks.file.Kdf != kdfScrypt || ks.file.Cipher != cipherAesGcm {
+		return nil, fmt.Errorf("unsupported keystore version %d (%s, %s)", ks.file.Version, ks.file.Kdf, ks.file.Cipher)
+	}
+	if ks.file.Keys == nil {
+		ks.file.Keys = map[string]encryptedKey{}
+	}
+	ks.key, err = ks.file.KdfParams.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if ks.file.Check == nil {
+		return nil, errors.New("keystore has no passphrase check")
+	}
+	if check, err := ks.decrypt(checkName, *ks.file.Check); err != nil || check != checkValue {
+		return nil, ErrWrongPassphrase
+	}
+	for name, ek := range ks.file.Keys {
+		secret, err := ks.decrypt(name, ek)
+		if err != nil {
+			return nil, ErrWrongPassphrase
+		}
+		ks.secrets[name] = secret
+	}
+	return ks, nil
+}
+
+// seal keep the check of the passphrase in the keystore
+func (ks *Keystore) seal() error {
+	check, err := ks.encrypt(checkName, checkValue)
+	if err != nil {
+		return err
+	}
+	ks.file.Check = &check
+	return nil
+}
+
+// Get the plaintext secret
+func (ks *Keystore) Get(name string) (string, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	secret, ok := ks.secrets[name]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return secret, nil
+}
+
+// Put encrypt and save the secret
+func (ks *Keystore) Put(name string, secret string) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	if old, ok := ks.secrets[name]; ok && old == secret {
+		return nil
+	}
+	ek, err := ks.encrypt(name, secret)
+	if err != nil {
+		return err
+	}
+	ks.file.Keys[name] = ek
+	ks.secrets[name] = secret
+	return ks.save()
+}
+
+// Delete remove the secret
+func (ks *Keystore) Delete(name string) error {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	if _, ok := ks.secrets[name]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(ks.file.Keys, name)
+	delete(ks.secrets, name)
+	return ks.save()
+}
+
+func (p kdfParams) deriveKey(passphrase []byte) ([]byte, error) {
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return scrypt.Key(passphrase, salt, p.N, p.R, p.P, keyLength)
+}
+
+func (ks *Keystore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(ks.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (ks *Keystore) encrypt(name, secret string) (encryptedKey, error) {
+	aead, err := ks.aead()
+	if err != nil {
+		return encryptedKey{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return encryptedKey{}, err
+	}
+	ciphertext := aead.Seal(nil, nonce, []byte(secret), []byte(name))
+	return encryptedKey{
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(ciphertext),
+	}, nil
+}
+
+func (ks *Keystore) decrypt(name string, ek encryptedKey) (string, error) {
+	aead, err := ks.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := hex.DecodeString(ek.Nonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := hex.DecodeString(ek.Ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return "", errors.New("invalid nonce size")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// save write the keystore file atomically, readable only by the owner
+func (ks *Keystore) save() error {
+	data, err := json.MarshalIndent(ks.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
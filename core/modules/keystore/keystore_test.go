@@ -0,0 +1,58 @@
+package keystore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), keystoreFilename)
+	seed := "betray extend distance category chimney globe employ scrap armor success kiss forum"
+
+	ks, err := Create(path, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.NoError(t, ks.Put("seed", seed))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(data), "betray"))
+
+	_, err = Open(path, []byte("wrong"))
+	assert.Error(t, err)
+
+	ks, err = Open(path, []byte("passphrase"))
+	assert.NoError(t, err)
+	secret, err := ks.Get("seed")
+	assert.NoError(t, err)
+	assert.Equal(t, seed, secret)
+
+	_, err = ks.Get("p2p")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, ks.Delete("seed"))
+	_, err = ks.Get("seed")
+	assert.Error(t, err)
+}
+
+func TestEmptyKeystorePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), keystoreFilename)
+	_, err := Create(path, []byte("passphrase"))
+	assert.NoError(t, err)
+
+	// the keystore holds no key yet, the passphrase is still checked
+	_, err = Open(path, []byte("wrong"))
+	assert.Equal(t, ErrWrongPassphrase, err)
+	_, err = Open(path, []byte("passphrase"))
+	assert.NoError(t, err)
+
+	// a keystore without the check is refused, whatever the passphrase
+	ks, err := Open(path, []byte("passphrase"))
+	assert.NoError(t, err)
+	ks.file.Check = nil
+	assert.NoError(t, ks.save())
+	_, err = Open(path, []byte("passphrase"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package keystore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+const (
+	PassphraseEnv     = "HAMSTER_KEYSTORE_PASSPHRASE"
+	PassphraseFileEnv = "HAMSTER_KEYSTORE_PASSPHRASE_FILE"
+)
+
+// ReadPassphrase read the keystore passphrase, in order from the passphrase file, the
+// HAMSTER_KEYSTORE_PASSPHRASE_FILE file, the HAMSTER_KEYSTORE_PASSPHRASE env or the terminal prompt
+func ReadPassphrase(file string, confirm bool) ([]byte, error) {
+	if file == "" {
+		file = os.Getenv(PassphraseFileEnv)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read passphrase file fail: %s", err)
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return []byte(passphrase), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("keystore passphrase required, set %s or %s", PassphraseFileEnv, PassphraseEnv)
+	}
+	passphrase, err := prompt(fd, "keystore passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := prompt(fd, "repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(passphrase) {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// ReadSecret read a secret line from the terminal without echo, or from stdin when it is not a terminal
+func ReadSecret(message string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		secret, err := prompt(fd, message)
+		return string(secret), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func prompt(fd int, message string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, message)
+	defer fmt.Fprintln(os.Stderr)
+	return term.ReadPassword(fd)
+}
@@ -8,6 +8,7 @@ import (
 	chain2 "github.com/hamster-shared/hamster-provider/core/modules/chain"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
 	"github.com/hamster-shared/hamster-provider/core/modules/event"
+	"github.com/hamster-shared/hamster-provider/core/modules/template"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	log "github.com/sirupsen/logrus"
 	"time"
@@ -52,11 +53,16 @@ func (l *ChainListener) start() error {
 	if err != nil {
 		return err
 	}
+	// the templates of the catalog are advertised in the system of the resource
+	system, err := template.NewCatalog(l.cm).Advertise()
+	if err != nil {
+		return err
+	}
 	resource := chain2.ResourceInfo{
 		PeerId:     cfg.Identity.PeerID,
 		Cpu:        cfg.Vm.Cpu,
 		Memory:     cfg.Vm.Mem,
-		System:     cfg.Vm.System,
+		System:     system,
 		CpuModel:   utils.GetCpuModel(),
 		Price:      cfg.ChainRegInfo.Price,
 		ExpireTime: time.Now().AddDate(0, 0, 10),
@@ -156,8 +162,10 @@ func (l *ChainListener) dealCreateOrderSuccess(e chain2.EventResourceOrderCreate
 		// process the order
 		fmt.Println("deal order", e.OrderIndex)
 		// record the id of the processed order
-		cfg.ChainRegInfo.OrderIndex = uint64(e.OrderIndex)
-		_ = l.cm.Save(cfg)
+		_ = l.cm.Update(func(cfg *config.Config) error {
+			cfg.ChainRegInfo.OrderIndex = uint64(e.OrderIndex)
+			return nil
+		})
 		evt := &event.VmRequest{
 			Tag:       event.OPCreatedVm,
 			Cpu:       cfg.Vm.Cpu,
@@ -167,6 +175,8 @@ func (l *ChainListener) dealCreateOrderSuccess(e chain2.EventResourceOrderCreate
 			System:    cfg.Vm.System,
 			PublicKey: e.PublicKey,
 			Image:     cfg.Vm.Image,
+			// the order on chain does not carry a template, the default of the catalog is used
+			Template: cfg.Vm.Template,
 		}
 		l.eventService.Create(evt)
 
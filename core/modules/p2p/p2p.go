@@ -197,24 +197,35 @@ func (c *P2pClient) List() *P2PLsOutput {
 
 // Listen map local ports to p2p networks
 func (c *P2pClient) Listen(targetOpt string) error {
+	return c.ListenProtocol("/x/ssh", targetOpt)
+}
+
+// ListenProtocol map local ports to p2p networks under the protocol
+func (c *P2pClient) ListenProtocol(protoOpt string, targetOpt string) error {
 	log.Println("listening for connections")
 
-	protoOpt := "/x/ssh"
 	//targetOpt := fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
 	proto := protocol.ID(protoOpt)
 
 	target, err := ma.NewMultiaddr(targetOpt)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	_, err = c.P2P.ForwardRemote(context.Background(), proto, target, false)
+	if err != nil {
+		return err
+	}
 	logrus.Info("local port" + targetOpt + ",mapping to p2p network succeeded")
-	return err
+	return nil
 }
 
 // Forward map p2p network remote nodes to local ports
 func (c *P2pClient) Forward(port int, targetOpt string) error {
-	protoOpt := "/x/ssh"
+	return c.ForwardProtocol("/x/ssh", port, targetOpt)
+}
+
+// ForwardProtocol map the protocol of the p2p network remote node to local ports
+func (c *P2pClient) ForwardProtocol(protoOpt string, port int, targetOpt string) error {
 	listenOpt := fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
 	listen, err := ma.NewMultiaddr(listenOpt)
 
@@ -276,6 +287,18 @@ func (c *P2pClient) Close(target string) (int, error) {
 
 }
 
+// CloseProtocol turn off the p2p listening connections of the protocol
+func (c *P2pClient) CloseProtocol(protoOpt string) int {
+	proto := protocol.ID(protoOpt)
+	match := func(listener ipfsp2p.Listener) bool {
+		return listener.Protocol() == proto
+	}
+
+	done := c.P2P.ListenersLocal.Close(match)
+	done += c.P2P.ListenersP2P.Close(match)
+	return done
+}
+
 // Destroy: destroy and close the p2p client, including all subordinate listeners, stream objects
 func (c *P2pClient) Destroy() error {
 	for _, stream := range c.P2P.Streams.Streams {
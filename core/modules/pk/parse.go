@@ -0,0 +1,32 @@
+package pk
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"strings"
+)
+
+// ParseKey validate the OpenSSH public key, return the normalized authorized_keys line and its fingerprint,
+// options like command= and multiple keys are rejected, so the line is safe to write into authorized_keys
+func ParseKey(publicKey string) (string, string, error) {
+	publicKey = strings.TrimSpace(publicKey)
+	if strings.ContainsAny(publicKey, "\r\n") {
+		return "", "", errors.New("only one public key is allowed")
+	}
+	key, comment, options, rest, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid public key: %s", err)
+	}
+	if len(options) > 0 {
+		return "", "", errors.New("public key options are not allowed")
+	}
+	if len(rest) > 0 {
+		return "", "", errors.New("only one public key is allowed")
+	}
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if comment != "" {
+		line = line + " " + comment
+	}
+	return line, ssh.FingerprintSHA256(key), nil
+}
@@ -3,126 +3,154 @@ package pk
 import (
 	"errors"
 	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
 	"github.com/sirupsen/logrus"
 )
 
+var ErrKeyNotFound = errors.New("public key not found")
+
+// Manager 管理每个订单实例的 ssh 公钥
 type Manager struct {
 	cm *config.ConfigManager
+	vm vm.Manager
 }
 
-func NewManager(cm *config.ConfigManager) *Manager {
+func NewManager(cm *config.ConfigManager, vmManager vm.Manager) *Manager {
 	return &Manager{
 		cm: cm,
+		vm: vmManager,
 	}
 }
 
-// AddPublicKey 新增公钥
-func (p *Manager) AddPublicKey(publicKey string) error {
-
-	// 读取config文件
+// ListKeys 查询订单实例的公钥
+func (p *Manager) ListKeys(orderNo uint64) ([]config.PublicKey, error) {
 	c, err := p.cm.GetConfig()
 	if err != nil {
-		logrus.Println(err)
-		return err
+		return nil, err
 	}
-
-	// 在Keys中添加公钥
-	keys := append(c.Keys, config.PublicKey{Key: publicKey})
-	c.Keys = keys
-
-	// 现在的公钥为
-	logrus.Printf("现在的公钥为:%s", c.Keys)
-
-	// 本地保存config
-	err = p.cm.Save(c)
-	if err != nil {
-		logrus.Println(err)
-		return err
-	} else {
-		logrus.Printf("本地config更新公钥成功")
+	keys := []config.PublicKey{}
+	for _, k := range c.Keys {
+		// keys without fingerprint belong to the old global key list
+		if k.Order == orderNo && k.Fingerprint != "" {
+			keys = append(keys, k)
+		}
 	}
+	return keys, nil
+}
 
-	return nil
+// AddKey 为订单实例添加公钥并同步到实例
+func (p *Manager) AddKey(orderNo uint64, publicKey string, source config.KeySource) (*config.PublicKey, error) {
+	key, added, err := p.saveKey(orderNo, publicKey, source, false)
+	if err != nil || !added {
+		return key, err
+	}
+	return key, p.Apply(orderNo)
 }
 
-// DeletePublicKey 删除公钥
-func (p *Manager) DeletePublicKey(publicKey string) error {
-	// 读取config文件
-	c, err := p.cm.GetConfig()
+// RemoveKey 删除订单实例的公钥并同步到实例
+func (p *Manager) RemoveKey(orderNo uint64, fingerprint string) error {
+	err := p.cm.Update(func(c *config.Config) error {
+		var res []config.PublicKey
+		for _, k := range c.Keys {
+			if k.Order != orderNo || k.Fingerprint != fingerprint {
+				res = append(res, k)
+			}
+		}
+		if len(res) == len(c.Keys) {
+			return ErrKeyNotFound
+		}
+		c.Keys = res
+		return nil
+	})
 	if err != nil {
-		logrus.Println(err)
 		return err
 	}
+	logrus.Infof("order %d public key %s removed", orderNo, fingerprint)
+	return p.Apply(orderNo)
+}
 
-	ifExist := false
-	var res []config.PublicKey
+// SyncOrderKey 保存订单中租户的公钥, 替换之前订单中的公钥, 返回公钥是否有变化
+func (p *Manager) SyncOrderKey(orderNo uint64, publicKey string) (*config.PublicKey, bool, error) {
+	if publicKey == "" {
+		return nil, false, nil
+	}
+	return p.saveKey(orderNo, publicKey, config.KeySourceOrder, true)
+}
 
-	for _, k := range c.Keys {
-		if k.Key != publicKey {
-			res = append(res, k)
-		} else {
-			logrus.Println("删除公钥成功")
-			ifExist = true
+// ClearKeys 清空订单实例的公钥, 实例销毁时调用
+func (p *Manager) ClearKeys(orderNo uint64) error {
+	return p.cm.Update(func(c *config.Config) error {
+		var res []config.PublicKey
+		for _, k := range c.Keys {
+			if k.Order != orderNo {
+				res = append(res, k)
+			}
 		}
-	}
+		c.Keys = res
+		return nil
+	})
+}
 
-	c.Keys = res
-	if ifExist == false {
-		logrus.Println("要删除的公钥不存在,请重新输入")
-		return errors.New("要删除的公钥不存在,请重新输入")
+// AuthorizedKeys 订单实例的 authorized_keys 内容
+func (p *Manager) AuthorizedKeys(orderNo uint64) ([]string, error) {
+	keys, err := p.ListKeys(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, k := range keys {
+		lines = append(lines, k.Key)
 	}
+	return lines, nil
+}
 
-	// 保存config
-	err = p.cm.Save(c)
+// Apply 将保存的公钥同步到订单实例
+func (p *Manager) Apply(orderNo uint64) error {
+	lines, err := p.AuthorizedKeys(orderNo)
 	if err != nil {
-		logrus.Println(err)
 		return err
 	}
-
-	// 现在的公钥为
-	logrus.Printf("现在的公钥为:%s", c.Keys)
-
-	return nil
+	return p.vm.SetAuthorizedKeys(vm.InstanceName(orderNo), lines)
 }
 
-// QueryPublicKey 查询公钥是否存在
-func (p *Manager) QueryPublicKey(publicKey string) (bool, error) {
-	// 读取config文件
-	c, err := p.cm.GetConfig()
+// saveKey validate and save the key, replace the other keys of the source when replace is true
+func (p *Manager) saveKey(orderNo uint64, publicKey string, source config.KeySource, replace bool) (*config.PublicKey, bool, error) {
+	line, fingerprint, err := ParseKey(publicKey)
 	if err != nil {
-		logrus.Println(err)
-		return false, err
+		return nil, false, err
 	}
-
-	ifExist := false
-	for _, k := range c.Keys {
-		if k.Key == publicKey {
-			ifExist = true
-		}
-	}
-
-	if ifExist {
-		logrus.Printf("查询的公钥存在")
-		return true, nil
-	} else {
-		logrus.Printf("查询的公钥不存在")
-		return false, nil
+	key := config.PublicKey{
+		Key:         line,
+		Order:       orderNo,
+		Fingerprint: fingerprint,
+		Source:      source,
 	}
-
-}
-
-// ClearPublicKey 清空公钥列表
-func (p *Manager) ClearPublicKey() error {
-	var res []config.PublicKey
-	c, err := p.cm.GetConfig()
-	c.Keys = res
-
-	// 保存config
-	err = p.cm.Save(c)
+	changed := false
+	err = p.cm.Update(func(c *config.Config) error {
+		var res []config.PublicKey
+		exists := false
+		for _, k := range c.Keys {
+			if k.Order == orderNo && k.Fingerprint == fingerprint {
+				exists = true
+			} else if replace && k.Order == orderNo && k.Source == source {
+				changed = true
+				continue
+			}
+			res = append(res, k)
+		}
+		if !exists {
+			res = append(res, key)
+			changed = true
+		}
+		c.Keys = res
+		return nil
+	})
 	if err != nil {
-		logrus.Println(err)
-		return err
+		return nil, false, err
 	}
-
-	return nil
+	if !changed {
+		return &key, false, nil
+	}
+	logrus.Infof("order %d public key %s saved", orderNo, fingerprint)
+	return &key, true, nil
 }
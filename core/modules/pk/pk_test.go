@@ -0,0 +1,69 @@
+package pk
+
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	tenantKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDhC/DLCIYNMbgU8qQitboxKAa8bstCl8IO/uJ78xKMg tenant@host"
+	otherKey  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIBzdv7wGuheQ4/R9bWe+QuwmbZq+R1Epb6bygy+i7H7c other"
+)
+
+type fakeVm struct {
+	vm.Manager
+	keys map[string][]string
+}
+
+func (f *fakeVm) SetAuthorizedKeys(name string, keys []string) error {
+	f.keys[name] = keys
+	return nil
+}
+
+func TestParseKey(t *testing.T) {
+	line, fingerprint, err := ParseKey("  " + tenantKey + "\n")
+	assert.NoError(t, err)
+	assert.Equal(t, tenantKey, line)
+	assert.Contains(t, fingerprint, "SHA256:")
+
+	_, _, err = ParseKey("ssh-ed25519 AAAA; rm -rf /")
+	assert.Error(t, err)
+	_, _, err = ParseKey(`command="rm -rf /" ` + tenantKey)
+	assert.Error(t, err)
+	_, _, err = ParseKey(tenantKey + "\n" + otherKey)
+	assert.Error(t, err)
+}
+
+func TestManager(t *testing.T) {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{}))
+	fake := &fakeVm{keys: map[string][]string{}}
+	p := NewManager(cm, fake)
+
+	orderKey, changed, err := p.SyncOrderKey(1, tenantKey)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	_, changed, err = p.SyncOrderKey(1, tenantKey)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	added, err := p.AddKey(1, otherKey, config.KeySourceTenant)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tenantKey, otherKey}, fake.keys[vm.InstanceName(1)])
+
+	keys, err := p.ListKeys(2)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	assert.NoError(t, p.RemoveKey(1, orderKey.Fingerprint))
+	assert.Equal(t, []string{otherKey}, fake.keys[vm.InstanceName(1)])
+	assert.Equal(t, ErrKeyNotFound, p.RemoveKey(1, orderKey.Fingerprint))
+
+	assert.NoError(t, p.ClearKeys(1))
+	keys, _ = p.ListKeys(1)
+	assert.Empty(t, keys)
+	assert.NotEmpty(t, added.Fingerprint)
+}
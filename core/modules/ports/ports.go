@@ -0,0 +1,182 @@
+package ports
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultRange the host ports the ssh ports of the containers are mapped to
+const DefaultRange = "30000-39999"
+
+var ErrExhausted = errors.New("no free port left in the range")
+
+// Allocator 为订单实例分配宿主机端口: 在配置的范围内探测空闲端口, 租约按订单保存在文件中, 实例销毁时释放
+type Allocator struct {
+	file     string
+	min, max int
+	lock     sync.Mutex
+	// probe whether nothing listens on the port
+	probe func(port int) bool
+}
+
+// NewAllocator the allocator of the ports in the range like 30000-39999, the leases are kept in the file
+func NewAllocator(file, portRange string) (*Allocator, error) {
+	min, max, err := ParseRange(portRange)
+	if err != nil {
+		return nil, err
+	}
+	return &Allocator{file: file, min: min, max: max, probe: free}, nil
+}
+
+// ParseRange parse the range like 30000-39999, the default range when it is empty
+func ParseRange(portRange string) (int, int, error) {
+	if portRange == "" {
+		portRange = DefaultRange
+	}
+	parts := strings.SplitN(portRange, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	if min < 1024 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("port range %s is not within 1024-65535", portRange)
+	}
+	return min, max, nil
+}
+
+// Lease the port of the instance, a free port of the range is leased when the instance has none or when its
+// port was taken by something else while the instance was down
+func (a *Allocator) Lease(name string) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	leases, err := a.load()
+	if err != nil {
+		return 0, err
+	}
+	if port, ok := leases[name]; ok {
+		if a.probe(port) {
+			return port, nil
+		}
+		delete(leases, name)
+	}
+	leased := make(map[int]bool, len(leases))
+	for _, port := range leases {
+		leased[port] = true
+	}
+	// start at a random port, a released port is rarely handed out again at once
+	size := a.max - a.min + 1
+	start := rand.Intn(size)
+	for i := 0; i < size; i++ {
+		port := a.min + (start+i)%size
+		if leased[port] || !a.probe(port) {
+			continue
+		}
+		leases[name] = port
+		return port, a.save(leases)
+	}
+	return 0, ErrExhausted
+}
+
+// Adopt record the port the instance already uses, like a container created before the leases were kept
+func (a *Allocator) Adopt(name string, port int) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	leases, err := a.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := leases[name]; ok {
+		return nil
+	}
+	leases[name] = port
+	return a.save(leases)
+}
+
+// Port the leased port of the instance
+func (a *Allocator) Port(name string) (int, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	leases, err := a.load()
+	if err != nil {
+		return 0, false
+	}
+	port, ok := leases[name]
+	return port, ok
+}
+
+// Release give the port of the instance back
+func (a *Allocator) Release(name string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	leases, err := a.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := leases[name]; !ok {
+		return nil
+	}
+	delete(leases, name)
+	return a.save(leases)
+}
+
+// Leases the ports of the instances
+func (a *Allocator) Leases() (map[string]int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.load()
+}
+
+func (a *Allocator) load() (map[string]int, error) {
+	leases := map[string]int{}
+	data, err := os.ReadFile(a.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return leases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &leases); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+func (a *Allocator) save(leases map[string]int) error {
+	if err := os.MkdirAll(filepath.Dir(a.file), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(leases, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
+
+// free whether the port can be bound on all the addresses, as the docker port mapping does
+func free(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	_ = l.Close()
+	return true
+}
@@ -0,0 +1,96 @@
+package ports
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	min, max, err := ParseRange("")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{30000, 39999}, []int{min, max})
+	min, max, err = ParseRange("40000 - 40010")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{40000, 40010}, []int{min, max})
+	for _, r := range []string{"40000", "a-b", "80-90", "40010-40000", "60000-70000"} {
+		_, _, err = ParseRange(r)
+		assert.Error(t, err, r)
+	}
+}
+
+func TestLease(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ports.json")
+	a, err := NewAllocator(file, "40000-40002")
+	assert.NoError(t, err)
+	busy := map[int]bool{40001: true}
+	a.probe = func(port int) bool { return !busy[port] }
+
+	first, err := a.Lease("order_1")
+	assert.NoError(t, err)
+	second, err := a.Lease("order_2")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{40000, 40002}, []int{first, second})
+
+	// the lease of an instance is kept, and survives a restart
+	again, err := NewAllocator(file, "40000-40002")
+	assert.NoError(t, err)
+	again.probe = a.probe
+	port, ok := again.Port("order_1")
+	assert.True(t, ok)
+	assert.Equal(t, first, port)
+	port, err = again.Lease("order_1")
+	assert.NoError(t, err)
+	assert.Equal(t, first, port)
+
+	// the busy port is skipped and the range is used up
+	_, err = again.Lease("order_3")
+	assert.ErrorIs(t, err, ErrExhausted)
+
+	assert.NoError(t, again.Release("order_1"))
+	port, err = again.Lease("order_3")
+	assert.NoError(t, err)
+	assert.Equal(t, first, port)
+	leases, err := again.Leases()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"order_2": second, "order_3": first}, leases)
+}
+
+func TestLeaseTaken(t *testing.T) {
+	a, err := NewAllocator(filepath.Join(t.TempDir(), "ports.json"), "40000-40001")
+	assert.NoError(t, err)
+	busy := map[int]bool{40001: true}
+	a.probe = func(port int) bool { return !busy[port] }
+	port, err := a.Lease("order_1")
+	assert.NoError(t, err)
+	assert.Equal(t, 40000, port)
+
+	// something else took the port while the instance was down, the rebuilt instance moves
+	busy = map[int]bool{40000: true}
+	port, err = a.Lease("order_1")
+	assert.NoError(t, err)
+	assert.Equal(t, 40001, port)
+	leases, err := a.Leases()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"order_1": 40001}, leases)
+}
+
+func TestAdopt(t *testing.T) {
+	a, err := NewAllocator(filepath.Join(t.TempDir(), "ports.json"), "")
+	assert.NoError(t, err)
+	assert.NoError(t, a.Adopt("order_1", 31234))
+	assert.NoError(t, a.Adopt("order_1", 31235))
+	port, ok := a.Port("order_1")
+	assert.True(t, ok)
+	assert.Equal(t, 31234, port)
+}
+
+func TestFree(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	assert.False(t, free(port), fmt.Sprint(port))
+}
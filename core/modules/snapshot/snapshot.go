@@ -0,0 +1,130 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultQuota the snapshots kept per order when the vm configuration does not set a quota
+const DefaultQuota = 3
+
+// maxLabelLength the label is shown to the tenant only
+const maxLabelLength = 64
+
+var (
+	ErrQuotaExceeded = errors.New("snapshot quota exceeded, delete a snapshot first")
+	ErrDisabled      = errors.New("snapshots are disabled by the provider")
+	namePattern      = regexp.MustCompile(`^[0-9A-Za-z._-]{1,64}$`)
+)
+
+// Manager 管理订单实例的快照, 每个订单的快照数量受配额限制
+type Manager struct {
+	cm   *config.ConfigManager
+	vm   vm.Manager
+	lock sync.Mutex
+}
+
+func NewManager(cm *config.ConfigManager, vmManager vm.Manager) *Manager {
+	return &Manager{
+		cm: cm,
+		vm: vmManager,
+	}
+}
+
+// Quota 每个订单可以保留的快照数量, 0 表示禁用快照
+func (m *Manager) Quota() (int, error) {
+	c, err := m.cm.GetConfig()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c.Vm.SnapshotQuota < 0:
+		return 0, nil
+	case c.Vm.SnapshotQuota == 0:
+		return DefaultQuota, nil
+	}
+	return c.Vm.SnapshotQuota, nil
+}
+
+// List 查询订单实例的快照
+func (m *Manager) List(orderNo uint64) ([]vm.Snapshot, error) {
+	return m.vm.ListSnapshots(vm.InstanceName(orderNo))
+}
+
+// Create 创建订单实例的快照, 超出配额时返回 ErrQuotaExceeded
+func (m *Manager) Create(orderNo uint64, label string) (*vm.Snapshot, error) {
+	label, err := validateLabel(label)
+	if err != nil {
+		return nil, err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	quota, err := m.Quota()
+	if err != nil {
+		return nil, err
+	}
+	if quota == 0 {
+		return nil, ErrDisabled
+	}
+	snapshots, err := m.List(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) >= quota {
+		return nil, ErrQuotaExceeded
+	}
+	snapshot, err := m.vm.Snapshot(vm.InstanceName(orderNo), label)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("order %d snapshot %s created", orderNo, snapshot.Name)
+	return snapshot, nil
+}
+
+// Restore 将订单实例恢复到快照
+func (m *Manager) Restore(orderNo uint64, name string) error {
+	if !namePattern.MatchString(name) {
+		return vm.ErrSnapshotNotFound
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.vm.Restore(vm.InstanceName(orderNo), name); err != nil {
+		return err
+	}
+	logrus.Infof("order %d restored to snapshot %s", orderNo, name)
+	return nil
+}
+
+// Delete 删除订单实例的快照
+func (m *Manager) Delete(orderNo uint64, name string) error {
+	if !namePattern.MatchString(name) {
+		return vm.ErrSnapshotNotFound
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.vm.DeleteSnapshot(vm.InstanceName(orderNo), name); err != nil {
+		return err
+	}
+	logrus.Infof("order %d snapshot %s deleted", orderNo, name)
+	return nil
+}
+
+func validateLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if len(label) > maxLabelLength {
+		return "", fmt.Errorf("snapshot label is longer than %d bytes", maxLabelLength)
+	}
+	for _, r := range label {
+		if unicode.IsControl(r) {
+			return "", errors.New("snapshot label contains control characters")
+		}
+	}
+	return label, nil
+}
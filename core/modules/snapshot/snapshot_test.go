@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type fakeVm struct {
+	vm.Manager
+	snapshots map[string][]vm.Snapshot
+	restored  string
+}
+
+func (f *fakeVm) Snapshot(name, label string) (*vm.Snapshot, error) {
+	snapshot := vm.Snapshot{Name: strconv.Itoa(len(f.snapshots[name])), Label: label}
+	f.snapshots[name] = append(f.snapshots[name], snapshot)
+	return &snapshot, nil
+}
+
+func (f *fakeVm) ListSnapshots(name string) ([]vm.Snapshot, error) {
+	return f.snapshots[name], nil
+}
+
+func (f *fakeVm) Restore(name, snapshot string) error {
+	for _, s := range f.snapshots[name] {
+		if s.Name == snapshot {
+			f.restored = snapshot
+			return nil
+		}
+	}
+	return vm.ErrSnapshotNotFound
+}
+
+func (f *fakeVm) DeleteSnapshot(name, snapshot string) error {
+	for i, s := range f.snapshots[name] {
+		if s.Name == snapshot {
+			f.snapshots[name] = append(f.snapshots[name][:i], f.snapshots[name][i+1:]...)
+			return nil
+		}
+	}
+	return vm.ErrSnapshotNotFound
+}
+
+func newManager(t *testing.T, quota int) (*Manager, *fakeVm) {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{Vm: config.VmOption{SnapshotQuota: quota}}))
+	fake := &fakeVm{snapshots: map[string][]vm.Snapshot{}}
+	return NewManager(cm, fake), fake
+}
+
+func TestQuota(t *testing.T) {
+	m, _ := newManager(t, 2)
+	_, err := m.Create(1, " before upgrade ")
+	assert.NoError(t, err)
+	_, err = m.Create(1, "")
+	assert.NoError(t, err)
+	_, err = m.Create(1, "third")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// the quota is per order
+	_, err = m.Create(2, "other order")
+	assert.NoError(t, err)
+
+	snapshots, err := m.List(1)
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+	assert.Equal(t, "before upgrade", snapshots[0].Label)
+
+	assert.NoError(t, m.Delete(1, snapshots[0].Name))
+	_, err = m.Create(1, "third")
+	assert.NoError(t, err)
+}
+
+func TestDefaultAndDisabledQuota(t *testing.T) {
+	m, _ := newManager(t, 0)
+	quota, err := m.Quota()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultQuota, quota)
+
+	m, _ = newManager(t, -1)
+	_, err = m.Create(1, "")
+	assert.ErrorIs(t, err, ErrDisabled)
+}
+
+func TestRestoreAndDelete(t *testing.T) {
+	m, fake := newManager(t, 0)
+	snapshot, err := m.Create(1, "")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Restore(1, snapshot.Name))
+	assert.Equal(t, snapshot.Name, fake.restored)
+
+	assert.ErrorIs(t, m.Restore(2, snapshot.Name), vm.ErrSnapshotNotFound)
+	assert.ErrorIs(t, m.Restore(1, "../other"), vm.ErrSnapshotNotFound)
+	assert.ErrorIs(t, m.Delete(1, "missing"), vm.ErrSnapshotNotFound)
+}
+
+func TestLabel(t *testing.T) {
+	m, _ := newManager(t, 0)
+	_, err := m.Create(1, "line\nbreak")
+	assert.Error(t, err)
+	_, err = m.Create(1, string(make([]byte, maxLabelLength+1)))
+	assert.Error(t, err)
+}
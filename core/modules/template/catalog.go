@@ -0,0 +1,447 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/sirupsen/logrus"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultName the name of the template built from the vm configuration when the catalog is empty
+const DefaultName = "default"
+
+const (
+	// defaultDataPath the mount path of the data volume when the vm configuration does not set one
+	defaultDataPath = "/data"
+	// defaultDataSize the size of the kvm data disk in GB
+	defaultDataSize = 10
+)
+
+// maxAdvertiseLength the system field of the resource on chain is kept short
+const maxAdvertiseLength = 256
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	namePattern         = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+	sha256Pattern       = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	runtimePattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	appArmorPattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	capabilityPattern   = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+	// requiredCapabilities sshd and the setup of the tenant user need them, the containers keep them
+	requiredCapabilities = []string{"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "NET_BIND_SERVICE", "SETGID", "SETUID", "SYS_CHROOT"}
+)
+
+// Catalog 管理可供租户选择的模板, 保存在本地配置中
+type Catalog struct {
+	cm *config.ConfigManager
+}
+
+func NewCatalog(cm *config.ConfigManager) *Catalog {
+	return &Catalog{cm: cm}
+}
+
+// Validate check the name, the image and the limits of the template, the isolation settings only apply to
+// the containers of the vm type
+func Validate(t config.TemplateOption, vmType string) error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name: %s", t.Name)
+	}
+	if t.Image == "" {
+		return errors.New("template image is empty")
+	}
+	if t.Sha256 != "" && !sha256Pattern.MatchString(t.Sha256) {
+		return fmt.Errorf("invalid sha256: %s", t.Sha256)
+	}
+	if t.MaxCpu > 0 && t.MinCpu > t.MaxCpu {
+		return errors.New("template min cpu is greater than max cpu")
+	}
+	if t.MaxMem > 0 && t.MinMem > t.MaxMem {
+		return errors.New("template min memory is greater than max memory")
+	}
+	if t.MaxDisk > 0 && t.MinDisk > t.MaxDisk {
+		return errors.New("template min disk is greater than max disk")
+	}
+	if t.AccessPort < 0 || t.AccessPort > 65535 {
+		return fmt.Errorf("invalid access port: %d", t.AccessPort)
+	}
+	if !isContainer(vmType) && (t.Runtime != "" || t.Seccomp != "" || t.AppArmor != "" || len(t.CapDrop) > 0) {
+		return fmt.Errorf("runtime, seccomp, apparmor and cap drop apply to docker and podman only, not %s", vmType)
+	}
+	if t.Runtime != "" && !runtimePattern.MatchString(t.Runtime) {
+		return fmt.Errorf("invalid runtime: %s", t.Runtime)
+	}
+	if t.Seccomp != "" && t.Seccomp != "unconfined" && !path.IsAbs(t.Seccomp) {
+		return fmt.Errorf("the seccomp profile is not an absolute path: %s", t.Seccomp)
+	}
+	if t.AppArmor != "" && !appArmorPattern.MatchString(t.AppArmor) {
+		return fmt.Errorf("invalid apparmor profile: %s", t.AppArmor)
+	}
+	for _, c := range t.CapDrop {
+		if !capabilityPattern.MatchString(c) {
+			return fmt.Errorf("invalid capability: %s", c)
+		}
+		if c == "ALL" || utils.Contains(requiredCapabilities, c) {
+			return fmt.Errorf("capability %s can not be dropped, sshd and the tenant user need %s",
+				c, strings.Join(requiredCapabilities, ", "))
+		}
+	}
+	return nil
+}
+
+// Hardened whether the containers of the template are isolated beyond the docker defaults, by a sandbox
+// runtime or a confinement profile, the dropped capabilities alone are not enough
+func Hardened(t config.TemplateOption, vmType string) bool {
+	return isContainer(vmType) && ((t.Runtime != "" && t.Runtime != "runc") ||
+		(t.Seccomp != "" && t.Seccomp != "unconfined") ||
+		(t.AppArmor != "" && t.AppArmor != "unconfined"))
+}
+
+// isContainer the vm type runs the instances as containers
+func isContainer(vmType string) bool {
+	return vmType == "docker" || vmType == "podman"
+}
+
+// List 查询模板目录, 目录为空时返回由 vm 配置生成的默认模板
+func (c *Catalog) List() ([]config.TemplateOption, error) {
+	cfg, err := c.cm.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return templates(cfg), nil
+}
+
+// Get 按名称查询模板, 名称为空时返回默认模板
+func (c *Catalog) Get(name string) (*config.TemplateOption, error) {
+	cfg, err := c.cm.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return find(cfg, name)
+}
+
+// Save 添加或替换模板
+func (c *Catalog) Save(t config.TemplateOption) error {
+	err := c.cm.Update(func(cfg *config.Config) error {
+		if err := Validate(t, cfg.Vm.Type); err != nil {
+			return err
+		}
+		replaced := false
+		for i, item := range cfg.Templates {
+			if item.Name == t.Name {
+				cfg.Templates[i] = t
+				replaced = true
+			}
+		}
+		if !replaced {
+			cfg.Templates = append(cfg.Templates, t)
+		}
+		if cfg.Vm.Template == "" {
+			cfg.Vm.Template = t.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("template %s saved", t.Name)
+	return nil
+}
+
+// Remove 删除模板, 默认模板不能删除
+func (c *Catalog) Remove(name string) error {
+	err := c.cm.Update(func(cfg *config.Config) error {
+		if name == cfg.Vm.Template && len(cfg.Templates) > 1 {
+			return errors.New("the default template cannot be removed, choose another default first")
+		}
+		var res []config.TemplateOption
+		for _, item := range cfg.Templates {
+			if item.Name != name {
+				res = append(res, item)
+			}
+		}
+		if len(res) == len(cfg.Templates) {
+			return ErrTemplateNotFound
+		}
+		cfg.Templates = res
+		if len(res) == 0 {
+			cfg.Vm.Template = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("template %s removed", name)
+	return nil
+}
+
+// SetDefault 设置订单未指定模板时使用的模板
+func (c *Catalog) SetDefault(name string) error {
+	return c.cm.Update(func(cfg *config.Config) error {
+		for _, item := range cfg.Templates {
+			if item.Name == name {
+				cfg.Vm.Template = name
+				return nil
+			}
+		}
+		return ErrTemplateNotFound
+	})
+}
+
+// Resolve 生成订单使用的 vm 模板, cpu, memory 和 disk 为 0 时使用 vm 配置, 超出模板限制时返回错误
+func (c *Catalog) Resolve(name string, cpu, mem, disk uint64) (vm.Template, error) {
+	cfg, err := c.cm.GetConfig()
+	if err != nil {
+		return vm.Template{}, err
+	}
+	t, err := find(cfg, name)
+	if err != nil {
+		return vm.Template{}, err
+	}
+	if cpu == 0 {
+		cpu = cfg.Vm.Cpu
+	}
+	if mem == 0 {
+		mem = cfg.Vm.Mem
+	}
+	if disk == 0 {
+		disk = cfg.Vm.Disk
+	}
+	if err = checkLimit("cpu", cpu, t.MinCpu, t.MaxCpu); err != nil {
+		return vm.Template{}, err
+	}
+	if err = checkLimit("memory", mem, t.MinMem, t.MaxMem); err != nil {
+		return vm.Template{}, err
+	}
+	if err = checkLimit("disk", disk, t.MinDisk, t.MaxDisk); err != nil {
+		return vm.Template{}, err
+	}
+	accessPort := t.AccessPort
+	if accessPort == 0 {
+		accessPort = 22
+	}
+	dataPath, err := DataPath(cfg.Vm)
+	if err != nil {
+		return vm.Template{}, err
+	}
+	dataSize := cfg.Vm.DataSize
+	if dataSize == 0 {
+		dataSize = defaultDataSize
+	}
+	return vm.Template{
+		Name:       t.Name,
+		Cpu:        cpu,
+		Memory:     mem,
+		Disk:       disk,
+		MaxCpu:     t.MaxCpu,
+		MaxMemory:  t.MaxMem,
+		System:     t.System,
+		Image:      t.Image,
+		Sha256:     t.Sha256,
+		AccessPort: accessPort,
+		User:       TenantUser(cfg.Vm.User),
+		Packages:   cfg.Vm.Packages,
+		CpuSet:     cfg.Vm.CpuSet,
+		DataPath:   dataPath,
+		DataSize:   dataSize,
+		Runtime:    t.Runtime,
+		Seccomp:    t.Seccomp,
+		AppArmor:   t.AppArmor,
+		CapDrop:    t.CapDrop,
+	}, nil
+}
+
+// Assign resolve the template of the order like Resolve and keep it for the instance, so that the instance
+// keeps its template after a restart
+func (c *Catalog) Assign(instance, name string, cpu, mem, disk uint64) (vm.Template, error) {
+	t, err := c.Resolve(name, cpu, mem, disk)
+	if err != nil {
+		return t, err
+	}
+	return t, c.cm.Update(func(cfg *config.Config) error {
+		if cfg.Instances == nil {
+			cfg.Instances = map[string]config.InstanceTemplate{}
+		}
+		cfg.Instances[instance] = config.InstanceTemplate{Template: t.Name, Cpu: t.Cpu, Mem: t.Memory, Disk: t.Disk}
+		return nil
+	})
+}
+
+// Resized keep the size the instance was upgraded to
+func (c *Catalog) Resized(instance string, size vm.Size) error {
+	return c.cm.Update(func(cfg *config.Config) error {
+		if assigned, ok := cfg.Instances[instance]; ok {
+			assigned.Cpu, assigned.Mem, assigned.Disk = size.Cpu, size.Memory, size.Disk
+			cfg.Instances[instance] = assigned
+		}
+		return nil
+	})
+}
+
+// Unassign forget the template of the destroyed instance
+func (c *Catalog) Unassign(instance string) error {
+	return c.cm.Update(func(cfg *config.Config) error {
+		delete(cfg.Instances, instance)
+		return nil
+	})
+}
+
+// Restore set the kept templates of the instances on the manager when the daemon starts, an instance whose
+// template is gone from the catalog keeps the default template
+func (c *Catalog) Restore(m vm.Manager) {
+	cfg, err := c.cm.GetConfig()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for instance, assigned := range cfg.Instances {
+		t, err := c.Resolve(assigned.Template, assigned.Cpu, assigned.Mem, assigned.Disk)
+		if err == nil {
+			err = m.SetInstanceTemplate(instance, t)
+		}
+		if err != nil {
+			logrus.WithField("instance", instance).Errorf("restore the template %s fail: %s", assigned.Template, err)
+		}
+	}
+}
+
+// DataPath the mount path of the data volume in the instances, empty when the data volume is disabled
+func DataPath(opt config.VmOption) (string, error) {
+	switch opt.DataPath {
+	case "":
+		// the microvms have no data volume
+		if opt.Type == "firecracker" {
+			return "", nil
+		}
+		return defaultDataPath, nil
+	case "-":
+		return "", nil
+	}
+	if !path.IsAbs(opt.DataPath) || path.Clean(opt.DataPath) != opt.DataPath || opt.DataPath == "/" ||
+		strings.ContainsAny(opt.DataPath, " \t\n,:") {
+		return "", fmt.Errorf("invalid data path: %s", opt.DataPath)
+	}
+	return opt.DataPath, nil
+}
+
+// Advertise the system label registered on chain, the default template first, like
+// "Ubuntu 20.04 [ubuntu-20.04]; CentOS 7 [centos-7]", the hardened templates are marked like
+// "Ubuntu 20.04 [ubuntu-20.04-gvisor, hardened]"
+func (c *Catalog) Advertise() (string, error) {
+	cfg, err := c.cm.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	list := templates(cfg)
+	if len(list) == 1 && list[0].Name == DefaultName {
+		return list[0].System, nil
+	}
+	var labels []string
+	for _, t := range list {
+		label := fmt.Sprintf("%s [%s]", t.System, t.Name)
+		if Hardened(t, cfg.Vm.Type) {
+			label = fmt.Sprintf("%s [%s, hardened]", t.System, t.Name)
+		}
+		if t.Name == cfg.Vm.Template {
+			labels = append([]string{label}, labels...)
+		} else {
+			labels = append(labels, label)
+		}
+	}
+	return truncate(strings.Join(labels, "; "), maxAdvertiseLength), nil
+}
+
+// truncate cut the label to max bytes after the last whole template, or on a rune boundary when the first
+// template is already too long
+func truncate(label string, max int) string {
+	if len(label) <= max {
+		return label
+	}
+	if i := strings.LastIndex(label[:max+1], "; "); i > 0 {
+		return label[:i]
+	}
+	for max > 0 && !utf8.RuneStart(label[max]) {
+		max--
+	}
+	return label[:max]
+}
+
+// Prewarm download the images of all the templates one after another, so that the first order of a
+// template does not wait for its image
+func (c *Catalog) Prewarm(p vm.ImagePreparer) {
+	list, err := c.List()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, t := range list {
+		c.PrewarmTemplate(p, t)
+	}
+}
+
+// PrewarmTemplate download the image of the template
+func (c *Catalog) PrewarmTemplate(p vm.ImagePreparer, t config.TemplateOption) {
+	err := p.PrepareImage(vm.Template{
+		Name:       t.Name,
+		Image:      t.Image,
+		Sha256:     t.Sha256,
+		AccessPort: t.AccessPort,
+	})
+	if err != nil {
+		logrus.WithField("template", t.Name).Errorf("prewarm image %s fail: %s", t.Image, err)
+		return
+	}
+	logrus.WithField("template", t.Name).Infof("image %s is ready", t.Image)
+}
+
+// TenantUser the tenant user of the vm template
+func TenantUser(opt config.TenantUserOption) vm.TenantUser {
+	return vm.TenantUser{
+		Name:         opt.Name,
+		Shell:        opt.Shell,
+		Home:         opt.Home,
+		Sudo:         vm.SudoPolicy(opt.Sudo),
+		SudoCommands: opt.SudoCommands,
+	}
+}
+
+func templates(cfg *config.Config) []config.TemplateOption {
+	if len(cfg.Templates) > 0 {
+		return cfg.Templates
+	}
+	return []config.TemplateOption{{
+		Name:       DefaultName,
+		Image:      cfg.Vm.Image,
+		System:     cfg.Vm.System,
+		AccessPort: cfg.Vm.AccessPort,
+	}}
+}
+
+func find(cfg *config.Config, name string) (*config.TemplateOption, error) {
+	if name == "" {
+		name = cfg.Vm.Template
+	}
+	list := templates(cfg)
+	for i, t := range list {
+		if t.Name == name || (name == "" && i == 0) {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+func checkLimit(resource string, value, min, max uint64) error {
+	if min > 0 && value < min {
+		return fmt.Errorf("%s %d is less than the template minimum %d", resource, value, min)
+	}
+	if max > 0 && value > max {
+		return fmt.Errorf("%s %d is greater than the template maximum %d", resource, value, max)
+	}
+	return nil
+}
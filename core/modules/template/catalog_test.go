@@ -0,0 +1,166 @@
+package template
+
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/config"
+	"github.com/hamster-shared/hamster-provider/core/modules/vm"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCatalog(t *testing.T) {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{Vm: config.VmOption{
+		Cpu: 2, Mem: 4, Disk: 50, System: "Ubuntu 18", Image: "ubuntu:18.04",
+		User: config.TenantUserOption{Name: "tenant"},
+	}}))
+	c := NewCatalog(cm)
+
+	// the vm configuration is the default template of an empty catalog
+	list, err := c.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, DefaultName, list[0].Name)
+	advertise, err := c.Advertise()
+	assert.NoError(t, err)
+	assert.Equal(t, "Ubuntu 18", advertise)
+	vt, err := c.Resolve("", 0, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu:18.04", vt.Image)
+	assert.Equal(t, 22, vt.AccessPort)
+	assert.Equal(t, "tenant", vt.User.Name)
+	assert.Equal(t, "/data", vt.DataPath)
+	assert.Equal(t, uint64(10), vt.DataSize)
+
+	assert.Error(t, c.Save(config.TemplateOption{Name: "Bad Name", Image: "ubuntu:20.04"}))
+	assert.Error(t, c.Save(config.TemplateOption{Name: "ubuntu", Image: "ubuntu:20.04", MinCpu: 4, MaxCpu: 2}))
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "ubuntu-20.04", Image: "ubuntu:20.04", System: "Ubuntu 20.04", MinCpu: 1, MaxCpu: 4}))
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "centos-7", Image: "centos:7", System: "CentOS 7", AccessPort: 2222}))
+
+	advertise, err = c.Advertise()
+	assert.NoError(t, err)
+	assert.Equal(t, "Ubuntu 20.04 [ubuntu-20.04]; CentOS 7 [centos-7]", advertise)
+
+	vt, err = c.Resolve("", 2, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu-20.04", vt.Name)
+	assert.Equal(t, uint64(4), vt.Memory)
+	_, err = c.Resolve("ubuntu-20.04", 8, 0, 0)
+	assert.Error(t, err)
+	vt, err = c.Resolve("centos-7", 8, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2222, vt.AccessPort)
+	_, err = c.Resolve("debian", 0, 0, 0)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	assert.Error(t, c.Remove("ubuntu-20.04"))
+	assert.NoError(t, c.SetDefault("centos-7"))
+	assert.NoError(t, c.Remove("ubuntu-20.04"))
+	assert.ErrorIs(t, c.Remove("ubuntu-20.04"), ErrTemplateNotFound)
+	list, err = c.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	assert.Equal(t, "centos-7", list[0].Name)
+}
+
+func TestDataPath(t *testing.T) {
+	for dataPath, expected := range map[string]string{"": "/data", "-": "", "/srv/data": "/srv/data"} {
+		p, err := DataPath(config.VmOption{DataPath: dataPath})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, p)
+	}
+	p, err := DataPath(config.VmOption{Type: "firecracker"})
+	assert.NoError(t, err)
+	assert.Empty(t, p)
+	for _, dataPath := range []string{"data", "/", "/srv/../etc", "/srv/data/", "/srv/my data", "/a,b"} {
+		_, err := DataPath(config.VmOption{DataPath: dataPath})
+		assert.Error(t, err, dataPath)
+	}
+}
+
+func TestHardened(t *testing.T) {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{Vm: config.VmOption{Cpu: 1, Mem: 1, Disk: 10, Type: "docker"}}))
+	c := NewCatalog(cm)
+
+	assert.Error(t, c.Save(config.TemplateOption{Name: "gvisor", Image: "ubuntu:20.04", Runtime: "runsc --debug"}))
+	assert.Error(t, c.Save(config.TemplateOption{Name: "gvisor", Image: "ubuntu:20.04", Seccomp: "seccomp.json"}))
+	assert.Error(t, c.Save(config.TemplateOption{Name: "gvisor", Image: "ubuntu:20.04", CapDrop: []string{"net_raw"}}))
+	// sshd and the tenant user need the capabilities
+	assert.Error(t, c.Save(config.TemplateOption{Name: "gvisor", Image: "ubuntu:20.04", CapDrop: []string{"ALL"}}))
+	assert.Error(t, c.Save(config.TemplateOption{Name: "gvisor", Image: "ubuntu:20.04", CapDrop: []string{"CHOWN"}}))
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "ubuntu", Image: "ubuntu:20.04", System: "Ubuntu 20.04", Runtime: "runc"}))
+	assert.NoError(t, c.Save(config.TemplateOption{
+		Name: "ubuntu-gvisor", Image: "ubuntu:20.04", System: "Ubuntu 20.04",
+		Runtime: "runsc", AppArmor: "docker-default", CapDrop: []string{"NET_RAW", "SYS_ADMIN"},
+	}))
+	// dropping capabilities alone does not make the tier hardened
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "ubuntu-nonet", Image: "ubuntu:20.04", System: "Ubuntu 20.04", CapDrop: []string{"NET_RAW"}}))
+
+	advertise, err := c.Advertise()
+	assert.NoError(t, err)
+	assert.Equal(t, "Ubuntu 20.04 [ubuntu]; Ubuntu 20.04 [ubuntu-gvisor, hardened]; Ubuntu 20.04 [ubuntu-nonet]", advertise)
+
+	// the virtual machines do not apply the container isolation
+	kvm := config.TemplateOption{Name: "ubuntu-gvisor", Image: "ubuntu.img", Runtime: "runsc"}
+	assert.Error(t, Validate(kvm, "kvm"))
+	assert.False(t, Hardened(kvm, "kvm"))
+	assert.True(t, Hardened(kvm, "podman"))
+
+	vt, err := c.Resolve("ubuntu-gvisor", 0, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "runsc", vt.Runtime)
+	assert.Equal(t, "docker-default", vt.AppArmor)
+	assert.Equal(t, []string{"NET_RAW", "SYS_ADMIN"}, vt.CapDrop)
+}
+
+type fakeVm struct {
+	vm.Manager
+	templates map[string]vm.Template
+}
+
+func (f *fakeVm) SetInstanceTemplate(name string, t vm.Template) error {
+	f.templates[name] = t
+	return nil
+}
+
+func TestAssign(t *testing.T) {
+	cm := config.NewConfigManagerWithPath(filepath.Join(t.TempDir(), "config"))
+	assert.NoError(t, cm.Save(&config.Config{Vm: config.VmOption{Cpu: 2, Mem: 4, Disk: 50, Image: "ubuntu:18.04"}}))
+	c := NewCatalog(cm)
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "ubuntu-20.04", Image: "ubuntu:20.04", System: "Ubuntu 20.04"}))
+	assert.NoError(t, c.Save(config.TemplateOption{Name: "centos-7", Image: "centos:7", System: "CentOS 7"}))
+
+	_, err := c.Assign(vm.InstanceName(1), "centos-7", 1, 2, 20)
+	assert.NoError(t, err)
+	_, err = c.Assign(vm.InstanceName(2), "", 0, 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Resized(vm.InstanceName(1), vm.Size{Cpu: 2, Memory: 4, Disk: 40}))
+
+	// a restarted daemon sets the kept templates again
+	fake := &fakeVm{templates: map[string]vm.Template{}}
+	NewCatalog(cm).Restore(fake)
+	assert.Equal(t, "centos:7", fake.templates[vm.InstanceName(1)].Image)
+	assert.Equal(t, uint64(40), fake.templates[vm.InstanceName(1)].Disk)
+	assert.Equal(t, "ubuntu:20.04", fake.templates[vm.InstanceName(2)].Image)
+
+	assert.NoError(t, c.Unassign(vm.InstanceName(1)))
+	fake = &fakeVm{templates: map[string]vm.Template{}}
+	c.Restore(fake)
+	assert.Len(t, fake.templates, 1)
+}
+
+func TestTruncate(t *testing.T) {
+	label := "Ubuntu 20.04 [ubuntu-20.04]; CentOS 7 [centos-7]"
+	assert.Equal(t, label, truncate(label, len(label)))
+	assert.Equal(t, "Ubuntu 20.04 [ubuntu-20.04]", truncate(label, len(label)-1))
+	assert.Equal(t, "Ubuntu 20.04 [ubuntu-20.04]", truncate(label, len("Ubuntu 20.04 [ubuntu-20.04]")))
+
+	// a multi-byte rune is not cut in half
+	long := strings.Repeat("系统", 50)
+	cut := truncate(long, 256)
+	assert.True(t, utf8.ValidString(cut))
+	assert.LessOrEqual(t, len(cut), 256)
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/mem"
+)
+
+// HostResources the cpus, the memory and the free disk space of the host in bytes
+type HostResources struct {
+	Cpu             uint64
+	Memory          uint64
+	AvailableMemory uint64
+	// free space of the file system the path is on
+	FreeDisk uint64
+}
+
+// GetHostResources read the resources of the host, the free disk space is that of the file system of path
+func GetHostResources(path string) (*HostResources, error) {
+	cpus, err := cpu.Counts(true)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := mem.VirtualMemory()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return nil, err
+	}
+	return &HostResources{
+		Cpu:             uint64(cpus),
+		Memory:          memory.Total,
+		AvailableMemory: memory.Available,
+		FreeDisk:        usage.Free,
+	}, nil
+}
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
@@ -10,37 +9,123 @@ import (
 	"path/filepath"
 )
 
+// DownloadProgress called with the downloaded and the total bytes, total is -1 when unknown
+type DownloadProgress func(done, total int64)
+
+// Download download the url into destPath
 func Download(fullURLFile string, destPath string) error {
+	return DownloadResume(fullURLFile, destPath, nil)
+}
 
-	dir := filepath.Dir(destPath)
-	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
-		_ = os.MkdirAll(dir, os.ModePerm)
+// DownloadResume download the url into destPath through a .part file, an interrupted download is resumed
+// with a range request, destPath only appears once the download is complete
+func DownloadResume(fullURLFile string, destPath string, progress DownloadProgress) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+		return err
+	}
+	part := destPath + ".part"
+	file, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
 	}
 
-	// Create blank file
-	file, err := os.Create(destPath)
+	req, err := http.NewRequest(http.MethodGet, fullURLFile, nil)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 	client := http.Client{
 		CheckRedirect: func(r *http.Request, via []*http.Request) error {
 			r.URL.Opaque = r.URL.Path
 			return nil
 		},
 	}
-	// Put content on file
-	resp, err := client.Get(fullURLFile)
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
 	defer resp.Body.Close()
 
-	size, err := io.Copy(file, resp.Body)
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// the server ignored the range, start over
+		if offset > 0 {
+			log.Infof("%s does not support resume, download from the beginning", fullURLFile)
+		}
+		if err = file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		offset = 0
+		if resp.ContentLength >= 0 {
+			total = resp.ContentLength
+		}
+	case http.StatusPartialContent:
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part file already holds the whole content
+		if size, ok := contentRangeSize(resp); !ok || size != offset {
+			_ = file.Truncate(0)
+			return fmt.Errorf("download %s: the partial file does not match, retry", fullURLFile)
+		}
+		if err = file.Close(); err != nil {
+			return err
+		}
+		return os.Rename(part, destPath)
+	default:
+		return fmt.Errorf("download %s: %s", fullURLFile, resp.Status)
+	}
 
-	defer file.Close()
+	var writer io.Writer = file
+	if progress != nil {
+		progress(offset, total)
+		writer = &progressWriter{writer: file, done: offset, total: total, progress: progress}
+	}
+	size, err := io.Copy(writer, resp.Body)
+	if err != nil {
+		return fmt.Errorf("download %s: %s", fullURLFile, err)
+	}
+	if total >= 0 && offset+size != total {
+		return fmt.Errorf("download %s: incomplete, %d of %d bytes", fullURLFile, offset+size, total)
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	log.Infof("downloaded a file %s with size %d", destPath, offset+size)
+	return os.Rename(part, destPath)
+}
+
+// contentRangeSize the complete length of a `Content-Range: bytes */<size>` header
+func contentRangeSize(resp *http.Response) (int64, bool) {
+	var size int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &size); err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+type progressWriter struct {
+	writer   io.Writer
+	done     int64
+	total    int64
+	progress DownloadProgress
+}
 
-	fmt.Printf("Downloaded a file %s with size %d", destPath, size)
-	return nil
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.done += int64(n)
+	w.progress(w.done, w.total)
+	return n, err
 }
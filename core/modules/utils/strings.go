@@ -49,3 +49,12 @@ func GetRandomString(length int) string {
 	}
 	return output.String()
 }
+
+// TailLines the last n lines of the text
+func TailLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if n <= 0 || len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"strings"
+)
+
+const (
+	managedKeysBegin = "# BEGIN hamster-provider managed keys"
+	managedKeysEnd   = "# END hamster-provider managed keys"
+)
+
+// mergeAuthorizedKeys replace the provider managed block of authorized_keys with the keys,
+// the lines outside the block are added inside the instance and are kept as they are
+func mergeAuthorizedKeys(existing string, keys []string) string {
+	var lines []string
+	inBlock := false
+	for _, line := range strings.Split(existing, "\n") {
+		switch {
+		case line == managedKeysBegin:
+			inBlock = true
+		case line == managedKeysEnd:
+			inBlock = false
+		case !inBlock && line != "":
+			lines = append(lines, line)
+		}
+	}
+	if len(keys) > 0 {
+		lines = append(lines, managedKeysBegin)
+		lines = append(lines, keys...)
+		lines = append(lines, managedKeysEnd)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,19 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMergeAuthorizedKeys(t *testing.T) {
+	content := mergeAuthorizedKeys("", []string{"ssh-ed25519 AAAA a"})
+	assert.Equal(t, managedKeysBegin+"\nssh-ed25519 AAAA a\n"+managedKeysEnd+"\n", content)
+
+	// keys added inside the instance are kept
+	content = "ssh-rsa BBBB own\n" + content
+	content = mergeAuthorizedKeys(content, []string{"ssh-ed25519 AAAA a", "ssh-ed25519 CCCC b"})
+	assert.Equal(t, "ssh-rsa BBBB own\n"+managedKeysBegin+"\nssh-ed25519 AAAA a\nssh-ed25519 CCCC b\n"+managedKeysEnd+"\n", content)
+
+	content = mergeAuthorizedKeys(content, nil)
+	assert.Equal(t, "ssh-rsa BBBB own\n", content)
+}
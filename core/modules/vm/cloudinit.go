@@ -0,0 +1,229 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	cloudInitDir        = "/var/lib/hamster-provider"
+	cloudInitScript     = cloudInitDir + "/customize.sh"
+	cloudInitKeys       = cloudInitDir + "/authorized_keys"
+	cloudInitVolumeName = "cidata"
+	// dataDiskLabel the file system label of the data disk, at most 16 characters for ext4
+	dataDiskLabel  = "hamster-data"
+	dataDiskDevice = "/dev/vdb"
+)
+
+// isoTools the tools able to build the seed iso, in order of preference
+var isoTools = []string{"genisoimage", "mkisofs", "xorrisofs"}
+
+// CloudInitSeed the cloud-init NoCloud seed of a virtual machine
+type CloudInitSeed struct {
+	InstanceId     string
+	Hostname       string
+	User           TenantUser
+	AuthorizedKeys []string
+	Packages       []string
+	Network        NetworkConfig
+	DataPath       string // the data disk is formatted on the first boot and mounted there, optional
+}
+
+// NetworkConfig the network of the virtual machine, dhcp when the address is empty
+type NetworkConfig struct {
+	Address     string   // ip address with prefix, like 192.168.122.10/24
+	Gateway     string   // default gateway
+	Nameservers []string // dns servers
+}
+
+type cloudConfigFile struct {
+	Path        string `yaml:"path"`
+	Permissions string `yaml:"permissions"`
+	Content     string `yaml:"content"`
+}
+
+type cloudFsSetup struct {
+	Label      string `yaml:"label"`
+	Filesystem string `yaml:"filesystem"`
+	Device     string `yaml:"device"`
+	Partition  string `yaml:"partition"`
+	Overwrite  bool   `yaml:"overwrite"`
+}
+
+type cloudConfig struct {
+	Hostname      string            `yaml:"hostname"`
+	DisableRoot   bool              `yaml:"disable_root"`
+	SshPwauth     bool              `yaml:"ssh_pwauth"`
+	PackageUpdate bool              `yaml:"package_update,omitempty"`
+	Packages      []string          `yaml:"packages,omitempty"`
+	WriteFiles    []cloudConfigFile `yaml:"write_files"`
+	FsSetup       []cloudFsSetup    `yaml:"fs_setup,omitempty"`
+	Mounts        [][]string        `yaml:"mounts,omitempty"`
+	Runcmd        [][]string        `yaml:"runcmd"`
+	FinalMessage  string            `yaml:"final_message"`
+}
+
+type networkEthernet struct {
+	Match       map[string]string      `yaml:"match"`
+	Dhcp4       bool                   `yaml:"dhcp4"`
+	Addresses   []string               `yaml:"addresses,omitempty"`
+	Gateway4    string                 `yaml:"gateway4,omitempty"`
+	Nameservers map[string]interface{} `yaml:"nameservers,omitempty"`
+}
+
+type networkConfigV2 struct {
+	Version   int                        `yaml:"version"`
+	Ethernets map[string]networkEthernet `yaml:"ethernets"`
+}
+
+// hostname instance names like order_1 are not valid host names
+func cloudInitHostname(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// MetaData the meta-data of the seed
+func (s CloudInitSeed) MetaData() ([]byte, error) {
+	return yaml.Marshal(map[string]string{
+		"instance-id":    s.InstanceId,
+		"local-hostname": s.Hostname,
+	})
+}
+
+// UserData the user-data of the seed, the tenant user is provisioned by the same customization script as the
+// other backends, and the keys are written in the provider managed block of authorized_keys
+func (s CloudInitSeed) UserData() ([]byte, error) {
+	script, err := s.User.CustomizeScript()
+	if err != nil {
+		return nil, err
+	}
+	if script == "" {
+		// root logs in, only the ssh directory is prepared
+		script = fmt.Sprintf("#!/bin/sh\nset -e\nmkdir -p %s\nchmod 0700 %s\n", s.User.sshDir(), s.User.sshDir())
+	}
+	installKeys := fmt.Sprintf("cat %s >> %s && chmod 0600 %s && rm -f %s",
+		cloudInitKeys, s.User.authorizedKeysFile(), s.User.authorizedKeysFile(), cloudInitKeys)
+	if !s.User.IsRoot() {
+		installKeys += fmt.Sprintf(" && chown -R %s: %s", s.User.Name, s.User.sshDir())
+	}
+	cc := cloudConfig{
+		Hostname:      s.Hostname,
+		DisableRoot:   !s.User.IsRoot(),
+		SshPwauth:     false,
+		PackageUpdate: len(s.Packages) > 0,
+		Packages:      s.Packages,
+		WriteFiles: []cloudConfigFile{
+			{Path: cloudInitScript, Permissions: "0700", Content: script},
+			{Path: cloudInitKeys, Permissions: "0600", Content: mergeAuthorizedKeys("", s.AuthorizedKeys)},
+		},
+		Runcmd: [][]string{
+			{"sh", cloudInitScript},
+			{"sh", "-c", installKeys},
+		},
+		FinalMessage: "hamster-provider customization done",
+	}
+	if s.DataPath != "" {
+		// an existing file system is kept, the data survives the rebuilds of the virtual machine
+		cc.FsSetup = []cloudFsSetup{{
+			Label:      dataDiskLabel,
+			Filesystem: "ext4",
+			Device:     dataDiskDevice,
+			Partition:  "none",
+			Overwrite:  false,
+		}}
+		cc.Mounts = [][]string{{"LABEL=" + dataDiskLabel, s.DataPath, "ext4", "defaults,nofail", "0", "2"}}
+		if !s.User.IsRoot() {
+			cc.Runcmd = append(cc.Runcmd, []string{"chown", s.User.Name + ":", s.DataPath})
+		}
+	}
+	data, err := yaml.Marshal(cc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("#cloud-config\n"), data...), nil
+}
+
+// NetworkConfigData the network-config of the seed, in the version 2 format
+func (s CloudInitSeed) NetworkConfigData() ([]byte, error) {
+	eth := networkEthernet{
+		// the first ethernet of the virtual machine, named ens3 or eth0 depending on the image
+		Match: map[string]string{"name": "e*"},
+		Dhcp4: s.Network.Address == "",
+	}
+	if s.Network.Address != "" {
+		if _, _, err := net.ParseCIDR(s.Network.Address); err != nil {
+			return nil, fmt.Errorf("invalid address: %s", s.Network.Address)
+		}
+		eth.Addresses = []string{s.Network.Address}
+		if s.Network.Gateway != "" {
+			if net.ParseIP(s.Network.Gateway) == nil {
+				return nil, fmt.Errorf("invalid gateway: %s", s.Network.Gateway)
+			}
+			eth.Gateway4 = s.Network.Gateway
+		}
+	}
+	if len(s.Network.Nameservers) > 0 {
+		for _, ns := range s.Network.Nameservers {
+			if net.ParseIP(ns) == nil {
+				return nil, fmt.Errorf("invalid nameserver: %s", ns)
+			}
+		}
+		eth.Nameservers = map[string]interface{}{"addresses": s.Network.Nameservers}
+	}
+	return yaml.Marshal(networkConfigV2{
+		Version:   2,
+		Ethernets: map[string]networkEthernet{"primary": eth},
+	})
+}
+
+// WriteISO write the seed iso, labeled cidata as NoCloud requires
+func (s CloudInitSeed) WriteISO(file string) error {
+	tool, err := findIsoTool()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cidata")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]func() ([]byte, error){
+		"meta-data":      s.MetaData,
+		"user-data":      s.UserData,
+		"network-config": s.NetworkConfigData,
+	}
+	args := []string{"-output", file, "-volid", cloudInitVolumeName, "-joliet", "-rock"}
+	for _, name := range []string{"user-data", "meta-data", "network-config"} {
+		data, err := files[name]()
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return err
+		}
+		args = append(args, filepath.Join(dir, name))
+	}
+	if err = os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	output, err := exec.Command(tool, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %s", tool, err, output)
+	}
+	return nil
+}
+
+func findIsoTool() (string, error) {
+	for _, tool := range isoTools {
+		if p, err := exec.LookPath(tool); err == nil {
+			return p, nil
+		}
+	}
+	return "", errors.New("cannot build the cloud-init seed, install genisoimage")
+}
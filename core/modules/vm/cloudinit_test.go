@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCloudInitSeed(t *testing.T) {
+	seed := CloudInitSeed{
+		InstanceId:     "order_1",
+		Hostname:       cloudInitHostname("order_1"),
+		User:           TenantUser{Name: "tenant", Sudo: SudoAll},
+		AuthorizedKeys: []string{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIG tenant@host"},
+		Packages:       []string{"htop"},
+	}
+
+	meta, err := seed.MetaData()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(meta), "instance-id: order_1"))
+	assert.True(t, strings.Contains(string(meta), "local-hostname: order-1"))
+
+	user, err := seed.UserData()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(user), "#cloud-config\n"))
+	assert.True(t, strings.Contains(string(user), "disable_root: true"))
+	assert.True(t, strings.Contains(string(user), "- htop"))
+	assert.True(t, strings.Contains(string(user), "useradd -m -d /home/tenant"))
+	assert.True(t, strings.Contains(string(user), "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIG tenant@host"))
+	assert.True(t, strings.Contains(string(user), "chown -R tenant: /home/tenant/.ssh"))
+	assert.False(t, strings.Contains(string(user), "fs_setup"))
+
+	seed.DataPath = "/data"
+	user, err = seed.UserData()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(user), "device: /dev/vdb"))
+	assert.True(t, strings.Contains(string(user), "overwrite: false"))
+	assert.True(t, strings.Contains(string(user), "- LABEL=hamster-data\n  - /data"))
+	assert.True(t, strings.Contains(string(user), "- chown\n  - 'tenant:'\n  - /data"))
+
+	network, err := seed.NetworkConfigData()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(network), "dhcp4: true"))
+
+	seed.Network = NetworkConfig{Address: "192.168.122.10/24", Gateway: "192.168.122.1", Nameservers: []string{"1.1.1.1"}}
+	network, err = seed.NetworkConfigData()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(network), "dhcp4: false"))
+	assert.True(t, strings.Contains(string(network), "gateway4: 192.168.122.1"))
+
+	seed.Network.Address = "192.168.122.10"
+	_, err = seed.NetworkConfigData()
+	assert.Error(t, err)
+
+	seed.User = TenantUser{Name: "bad;name"}
+	_, err = seed.UserData()
+	assert.Error(t, err)
+}
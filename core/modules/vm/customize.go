@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SudoPolicy what the tenant user may run with sudo
+type SudoPolicy string
+
+const (
+	SudoNone     SudoPolicy = "none"     // no sudo
+	SudoAll      SudoPolicy = "all"      // any command without password
+	SudoCommands SudoPolicy = "commands" // only the listed commands without password
+)
+
+const (
+	defaultShell = "/bin/bash"
+	sudoersFile  = "/etc/sudoers.d/hamster-tenant"
+)
+
+var (
+	userNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	pathPattern     = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+	commandPattern  = regexp.MustCompile(`^/[A-Za-z0-9._/-]*( [A-Za-z0-9._/*-]+)*$`)
+)
+
+// TenantUser the account the tenant logs in with, root when the name is empty
+type TenantUser struct {
+	Name         string
+	Shell        string
+	Home         string
+	Sudo         SudoPolicy
+	SudoCommands []string
+}
+
+// IsRoot whether the tenant logs in as root
+func (u TenantUser) IsRoot() bool {
+	return u.Name == "" || u.Name == "root"
+}
+
+// LoginName the login name of the tenant
+func (u TenantUser) LoginName() string {
+	if u.IsRoot() {
+		return "root"
+	}
+	return u.Name
+}
+
+// HomeDir the home directory of the tenant
+func (u TenantUser) HomeDir() string {
+	switch {
+	case u.IsRoot():
+		return "/root"
+	case u.Home != "":
+		return path.Clean(u.Home)
+	default:
+		return "/home/" + u.Name
+	}
+}
+
+func (u TenantUser) shell() string {
+	if u.Shell == "" {
+		return defaultShell
+	}
+	return u.Shell
+}
+
+func (u TenantUser) sshDir() string {
+	return u.HomeDir() + "/.ssh"
+}
+
+func (u TenantUser) authorizedKeysFile() string {
+	return u.sshDir() + "/authorized_keys"
+}
+
+// Validate the values are written into the provisioning script and sudoers, so only safe characters are allowed
+func (u TenantUser) Validate() error {
+	if u.IsRoot() {
+		return nil
+	}
+	if !userNamePattern.MatchString(u.Name) {
+		return fmt.Errorf("invalid user name: %s", u.Name)
+	}
+	if !pathPattern.MatchString(u.shell()) {
+		return fmt.Errorf("invalid shell: %s", u.Shell)
+	}
+	if !pathPattern.MatchString(u.HomeDir()) || u.HomeDir() == "/" {
+		return fmt.Errorf("invalid home directory: %s", u.Home)
+	}
+	switch u.Sudo {
+	case "", SudoNone, SudoAll:
+	case SudoCommands:
+		if len(u.SudoCommands) == 0 {
+			return fmt.Errorf("sudo commands are required by the %s policy", SudoCommands)
+		}
+		for _, c := range u.SudoCommands {
+			if !commandPattern.MatchString(c) {
+				return fmt.Errorf("invalid sudo command: %s", c)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown sudo policy: %s", u.Sudo)
+	}
+	return nil
+}
+
+// sudoers the sudoers rule of the tenant, empty when sudo is not allowed
+func (u TenantUser) sudoers() string {
+	switch u.Sudo {
+	case SudoAll:
+		return fmt.Sprintf("%s ALL=(ALL) NOPASSWD: ALL\n", u.Name)
+	case SudoCommands:
+		return fmt.Sprintf("%s ALL=(ALL) NOPASSWD: %s\n", u.Name, strings.Join(u.SudoCommands, ", "))
+	default:
+		return ""
+	}
+}
+
+// CustomizeScript the guest customization step shared by all the backends, it provisions the tenant user,
+// its sudo policy and its ssh directory, the script is empty when the tenant logs in as root
+func (u TenantUser) CustomizeScript() (string, error) {
+	if err := u.Validate(); err != nil {
+		return "", err
+	}
+	if u.IsRoot() {
+		return "", nil
+	}
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	fmt.Fprintf(&b, "if ! id -u %s >/dev/null 2>&1; then\n", u.Name)
+	b.WriteString("  if command -v useradd >/dev/null 2>&1; then\n")
+	fmt.Fprintf(&b, "    useradd -m -d %s -s %s %s\n", u.HomeDir(), u.shell(), u.Name)
+	b.WriteString("  else\n")
+	fmt.Fprintf(&b, "    adduser -D -h %s -s %s %s\n", u.HomeDir(), u.shell(), u.Name)
+	b.WriteString("  fi\nfi\n")
+	fmt.Fprintf(&b, "mkdir -p %s\n", u.sshDir())
+	fmt.Fprintf(&b, "chmod 0700 %s\n", u.sshDir())
+	fmt.Fprintf(&b, "chown -R %s: %s\n", u.Name, u.sshDir())
+	if rule := u.sudoers(); rule != "" {
+		b.WriteString("mkdir -p /etc/sudoers.d\n")
+		fmt.Fprintf(&b, "printf '%%s\\n' '%s' > %s\n", strings.TrimSuffix(rule, "\n"), sudoersFile)
+		fmt.Fprintf(&b, "chmod 0440 %s\n", sudoersFile)
+	} else {
+		fmt.Fprintf(&b, "rm -f %s\n", sudoersFile)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestTenantUser(t *testing.T) {
+	root := TenantUser{}
+	assert.Equal(t, "/root/.ssh/authorized_keys", root.authorizedKeysFile())
+	script, err := root.CustomizeScript()
+	assert.NoError(t, err)
+	assert.Empty(t, script)
+
+	user := TenantUser{Name: "tenant", Sudo: SudoCommands, SudoCommands: []string{"/usr/bin/systemctl restart nginx"}}
+	assert.Equal(t, "/home/tenant/.ssh/authorized_keys", user.authorizedKeysFile())
+	script, err = user.CustomizeScript()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(script, "useradd -m -d /home/tenant -s /bin/bash tenant"))
+	assert.True(t, strings.Contains(script, "tenant ALL=(ALL) NOPASSWD: /usr/bin/systemctl restart nginx"))
+
+	user.Sudo = SudoNone
+	script, _ = user.CustomizeScript()
+	assert.True(t, strings.Contains(script, "rm -f "+sudoersFile))
+
+	assert.Error(t, TenantUser{Name: "bad;name"}.Validate())
+	assert.Error(t, TenantUser{Name: "tenant", Shell: "/bin/sh;reboot"}.Validate())
+	assert.Error(t, TenantUser{Name: "tenant", Home: "/"}.Validate())
+	assert.Error(t, TenantUser{Name: "tenant", Sudo: SudoCommands}.Validate())
+	assert.Error(t, TenantUser{Name: "tenant", Sudo: SudoCommands, SudoCommands: []string{"/bin/sh 'x'"}}.Validate())
+}
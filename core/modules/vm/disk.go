@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// diskInfo the part of `qemu-img info` the provider reads
+type diskInfo struct {
+	Format          string `json:"format"`
+	VirtualSize     uint64 `json:"virtual-size"`
+	BackingFilename string `json:"backing-filename"`
+}
+
+func qemuImg(args ...string) ([]byte, error) {
+	output, err := exec.Command("qemu-img", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("qemu-img %s: %s: %s", args[0], err, output)
+	}
+	return output, nil
+}
+
+// readDiskInfo query the format, the size and the backing file of the disk
+func readDiskInfo(file string) (*diskInfo, error) {
+	output, err := qemuImg("info", "--output=json", file)
+	if err != nil {
+		return nil, err
+	}
+	var info diskInfo
+	if err = json.Unmarshal(output, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// createOverlay create a copy-on-write qcow2 disk on top of the base image and grow it to size GB,
+// the disk keeps the size of the base image when size is 0 or smaller than the base image
+func createOverlay(base, overlay string, size uint64) error {
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return err
+	}
+	info, err := readDiskInfo(base)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(overlay), os.ModePerm); err != nil {
+		return err
+	}
+	if _, err = qemuImg("create", "-f", "qcow2", "-F", info.Format, "-b", base, overlay); err != nil {
+		return err
+	}
+	if bytes := size << 30; bytes > info.VirtualSize {
+		if _, err = qemuImg("resize", overlay, fmt.Sprintf("%d", bytes)); err != nil {
+			_ = os.Remove(overlay)
+			return err
+		}
+	}
+	return nil
+}
+
+// createDataDisk create an empty qcow2 data disk of size GB, an existing disk is kept with its data
+func createDataDisk(file string, size uint64) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	_, err := qemuImg("create", "-f", "qcow2", file, fmt.Sprintf("%dG", size))
+	return err
+}
+
+// growDisk grow the disk to size GB, a disk already of the size is left as it is
+func growDisk(file string, size uint64) error {
+	info, err := readDiskInfo(file)
+	if err != nil {
+		return err
+	}
+	bytes := size << 30
+	if bytes < info.VirtualSize {
+		return fmt.Errorf("%w: %d GB is smaller than %d bytes", ErrShrinkDisk, size, info.VirtualSize)
+	}
+	if bytes == info.VirtualSize {
+		return nil
+	}
+	_, err = qemuImg("resize", file, fmt.Sprintf("%d", bytes))
+	return err
+}
@@ -1,57 +1,131 @@
 package vm
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
+	"github.com/hamster-shared/hamster-provider/core/modules/ports"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"os"
-	"os/exec"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type DockerManager struct {
-	template *Template
-	//access port
-	accessPort int
+	// templates of the instances
+	templates instanceTemplates
 	// docker client
 	cli *client.Client
 	// context
 	ctx context.Context
-
-	// image
-	image string
+	// provider home, the volumes of the snapshots are saved in it
+	home string
+	// pulls are deduplicated and reported through the image cache
+	cache *cache.ImageCache
+	// credentials of the private registries
+	registries []RegistryAuth
+	// the host ports the access ports of the containers are mapped to
+	ports *ports.Allocator
+	lock  sync.RWMutex
 }
 
-func NewDockerManager(t Template) (*DockerManager, error) {
+const (
+	// helperImage the image of the short lived containers that wipe and empty the volumes
+	helperImage = "busybox:stable"
+	helperMount = "/volume"
+	// wipeVolumeScript overwrite the regular files with zeros before removing them, like wipeFile
+	wipeVolumeScript = "find " + helperMount + " -type f -exec shred -n 0 -z -u {} + && " + emptyVolumeScript
+	// emptyVolumeScript remove the content of the volume, the hidden files included
+	emptyVolumeScript = "rm -rf " + helperMount + "/* " + helperMount + "/.[!.]* " + helperMount + "/..?*"
+
+	templateLabel   = "hamster.template"
+	accessPortLabel = "hamster.access-port"
+	orderLabel      = "hamster.order"
+)
+
+func NewDockerManager(t Template, imageCache *cache.ImageCache) (*DockerManager, error) {
 	cli, err := client.NewClientWithOpts(client.WithVersion("1.38"))
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
+	return newContainerManager(cli, t, imageCache)
+}
+
+// newContainerManager the manager of the containers of the docker compatible api the client is connected to
+func newContainerManager(cli *client.Client, t Template, imageCache *cache.ImageCache) (*DockerManager, error) {
+	homedir, _ := os.UserHomeDir()
+	if imageCache == nil {
+		imageCache = cache.NewImageCache(homedir+"/.hamster-provider/cache", 0)
+	}
+	allocator, err := ports.NewAllocator(homedir+"/.hamster-provider/ports.json", ports.DefaultRange)
+	if err != nil {
+		return nil, err
+	}
 	manager := &DockerManager{
-		cli: cli,
-		ctx: context.Background(),
+		cli:   cli,
+		ctx:   context.Background(),
+		home:  homedir + "/.hamster-provider",
+		cache: imageCache,
+		ports: allocator,
 	}
 	err = manager.SetTemplate(t)
 	return manager, err
 }
 
+// SetPorts set the allocator of the host ports, like one of the configured range
+func (d *DockerManager) SetPorts(allocator *ports.Allocator) {
+	d.ports = allocator
+}
+
 func (d *DockerManager) SetTemplate(t Template) error {
-	d.template = &t
-	d.image = t.Image
-	d.accessPort = 22
+	if err := t.User.Validate(); err != nil {
+		return err
+	}
+	d.templates.setDefault(withAccessPort(t))
+	return nil
+}
+
+func (d *DockerManager) SetInstanceTemplate(name string, t Template) error {
+	if err := t.User.Validate(); err != nil {
+		return err
+	}
+	d.templates.set(name, withAccessPort(t))
 	return nil
 }
 
+// SetRegistries set the credentials used to pull the images of the private registries
+func (d *DockerManager) SetRegistries(auths []RegistryAuth) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.registries = auths
+}
+
+// PrepareImage pull the image of the template if it is not present
+func (d *DockerManager) PrepareImage(t Template) error {
+	_, err := d.ensureImage(t)
+	return err
+}
+
 func (d *DockerManager) Status(name string) (*Status, error) {
 	containers, err := d.cli.ContainerList(d.ctx, types.ContainerListOptions{
 		All:     true,
@@ -117,44 +191,41 @@ func (d *DockerManager) GetIp(name string) (string, error) {
 	return "127.0.0.1", nil
 }
 
+// GetAccessPort the host port leased to the container, the lease of a container created before the
+// leases were kept is taken from its port mapping
 func (d *DockerManager) GetAccessPort(name string) int {
+	if port, ok := d.ports.Port(name); ok {
+		return port
+	}
 	inspect, err := d.cli.ContainerInspect(d.ctx, name)
 	if err != nil {
 		return 0
 	}
+	accessPort := d.templates.get(name).AccessPort
+	if label, ok := inspect.Config.Labels[accessPortLabel]; ok {
+		accessPort, _ = strconv.Atoi(label)
+	}
 	portMap := inspect.NetworkSettings.Ports
-	port, _ := nat.NewPort("tcp", strconv.Itoa(d.accessPort))
+	port, _ := nat.NewPort("tcp", strconv.Itoa(accessPort))
 	arrays := portMap[port]
 	if len(arrays) > 0 {
 		hostPort, _ := strconv.Atoi(arrays[0].HostPort)
+		if err = d.ports.Adopt(name, hostPort); err != nil {
+			log.WithField("instance", name).Errorf("record the port lease fail: %s", err)
+		}
 		return hostPort
 	}
 	return 0
 }
 
 func (d *DockerManager) Create(name string) (string, error) {
+	t := d.templates.get(name)
 
-	// view all images
-	imageLists, err := d.cli.ImageList(d.ctx, types.ImageListOptions{
-		All:     true,
-		Filters: filters.NewArgs(filters.Arg("reference", d.image)),
-	})
+	image, err := d.ensureImage(*t)
 	if err != nil {
 		log.Println(err)
 		return "", err
 	}
-	if len(imageLists) == 0 {
-		// pull image
-		out, err := d.cli.ImagePull(d.ctx, d.image, types.ImagePullOptions{})
-		if err != nil {
-			log.Println(err)
-			return "", err
-		}
-		_, err = io.Copy(os.Stdout, out)
-		if err != nil {
-			return "", err
-		}
-	}
 
 	// determine whether there is a repeated start
 	status, err := d.Status(name)
@@ -169,10 +240,34 @@ func (d *DockerManager) Create(name string) (string, error) {
 		}
 	}
 
-	port, err := nat.NewPort("tcp", strconv.Itoa(d.accessPort))
+	// the data volume outlives the container, a rebuilt container finds the data of the order
+	var mounts []mount.Mount
+	if t.DataPath != "" {
+		dataVolume, err := d.ensureDataVolume(name)
+		if err != nil {
+			return "", err
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: dataVolume, Target: t.DataPath})
+	}
+
+	security, err := securityOpt(t)
+	if err != nil {
+		return "", err
+	}
+	// a rebuilt container keeps the port of the order while it is free
+	hostPort, err := d.ports.Lease(name)
+	if err != nil {
+		return "", err
+	}
+
+	port, err := nat.NewPort("tcp", strconv.Itoa(t.AccessPort))
+	if err != nil {
+		d.releasePort(name)
+		return "", err
+	}
 	// create a container
 	resp, err := d.cli.ContainerCreate(d.ctx, &container.Config{
-		Image: d.image, //image name
+		Image: image, //image name, pinned to the digest of the template
 		//Tty:        true,
 		//OpenStdin:  true,
 		//Cmd:        []string{cmd},
@@ -180,17 +275,25 @@ func (d *DockerManager) Create(name string) (string, error) {
 		ExposedPorts: nat.PortSet{
 			port: struct{}{}, //docker container open port
 		},
+		Labels: map[string]string{
+			templateLabel:   t.Name,
+			accessPortLabel: strconv.Itoa(t.AccessPort),
+		},
 	},
 		&container.HostConfig{
-
+			Mounts:      mounts,
+			Runtime:     t.Runtime,
+			SecurityOpt: security,
+			CapDrop:     t.CapDrop,
+			// NanoCPUs sets the cfs quota of the container, CPUCount is only honoured by docker on windows
 			Resources: container.Resources{
-				CPUCount: int64(d.template.Cpu),
-				Memory:   int64(d.template.Memory << 30),
+				NanoCPUs: int64(t.Cpu) * 1e9,
+				Memory:   int64(t.Memory << 30),
 			},
 			PortBindings: nat.PortMap{
 				port: []nat.PortBinding{
 					{
-						HostPort: strconv.Itoa(utils.RandomPort()),
+						HostPort: strconv.Itoa(hostPort),
 					},
 				},
 			},
@@ -198,6 +301,7 @@ func (d *DockerManager) Create(name string) (string, error) {
 
 	if err != nil {
 		log.Println(err)
+		d.releasePort(name)
 		return resp.ID, err
 	}
 
@@ -206,6 +310,73 @@ func (d *DockerManager) Create(name string) (string, error) {
 	return resp.ID, err
 }
 
+// releasePort give the port back when the container of the instance was not created
+func (d *DockerManager) releasePort(name string) {
+	if err := d.ports.Release(name); err != nil {
+		log.WithField("instance", name).Errorf("release the port lease fail: %s", err)
+	}
+}
+
+// ensureImage pull the image of the template if it is not present, return the image reference,
+// pinned to the digest of the template
+func (d *DockerManager) ensureImage(t Template) (string, error) {
+	image, err := PinImage(t.Image, t.Sha256)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = d.cli.ImageInspectWithRaw(d.ctx, image)
+	if err == nil || !client.IsErrNotFound(err) {
+		return image, err
+	}
+	// concurrent orders of the same image wait for one pull
+	err = d.cache.Do("docker://"+image, func(report utils.DownloadProgress) error {
+		return d.pullImage(image, report)
+	})
+	return image, err
+}
+
+// pullImage pull the image with the credentials of its registry and report the bytes of all its layers
+func (d *DockerManager) pullImage(image string, report utils.DownloadProgress) error {
+	d.lock.RLock()
+	auth, err := findRegistryAuth(d.registries, image)
+	d.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	registryAuth, err := encodeRegistryAuth(auth)
+	if err != nil {
+		return err
+	}
+	out, err := d.cli.ImagePull(d.ctx, image, types.ImagePullOptions{RegistryAuth: registryAuth})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	layers := map[string]*jsonmessage.JSONProgress{}
+	decoder := json.NewDecoder(out)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err = decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("pull %s: %s", image, msg.Error.Message)
+		}
+		if msg.ID == "" || msg.Progress == nil || msg.Progress.Total <= 0 {
+			continue
+		}
+		layers[msg.ID] = msg.Progress
+		var done, total int64
+		for _, p := range layers {
+			done += p.Current
+			total += p.Total
+		}
+		report(done, total)
+	}
+}
+
 // StartContainer running containers in the background
 func (d *DockerManager) Start(name string) error {
 	status, err := d.Status(name)
@@ -250,7 +421,18 @@ func (d *DockerManager) CreateAndStartAndInjectionPublicKey(name, publicKey stri
 		}
 		time.Sleep(time.Second * 3)
 	}
-	err = d.InjectionPublicKey(name, publicKey)
+	status, err := d.Status(name)
+	if err != nil {
+		return id, err
+	}
+	if err = d.customize(name, status.id); err != nil {
+		return id, err
+	}
+	var keys []string
+	if publicKey != "" {
+		keys = append(keys, publicKey)
+	}
+	err = d.SetAuthorizedKeys(name, keys)
 	return id, err
 }
 
@@ -304,37 +486,421 @@ func (d *DockerManager) Shutdown(name string) error {
 	}
 }
 
-// Destroy delete container
+// Destroy delete the container with its snapshots, data volume and networks, the parts already gone are
+// skipped so a failed destruction can be run again
 func (d *DockerManager) Destroy(name string) error {
-	status, err := d.Status(name)
+	id, err := d.containerID(name)
 	if err != nil {
 		return err
 	}
-	id := status.id
+	if id != "" {
+		err = d.cli.ContainerRemove(d.ctx, id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	d.templates.remove(name)
+	if err = d.deleteSnapshots(name); err != nil {
+		return err
+	}
+	if err = d.removeDataVolume(name); err != nil {
+		return err
+	}
+	if err = d.removeNetworks(name); err != nil {
+		return err
+	}
+	return d.ports.Release(name)
+}
 
+// Residue the container, snapshots, data volume and networks of the instance that still exist
+func (d *DockerManager) Residue(name string) ([]string, error) {
+	var residue []string
+	id, err := d.containerID(name)
+	if err != nil {
+		return nil, err
+	}
 	if id != "" {
-		return d.cli.ContainerRemove(d.ctx, status.id, types.ContainerRemoveOptions{Force: true})
-	} else {
-		return errors.New("container id is invalid")
+		residue = append(residue, "container "+id)
+	}
+	snapshots, err := d.ListSnapshots(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		residue = append(residue, "image "+snapshotImage(name, snapshot.Name))
+	}
+	if _, err = os.Stat(filepath.Join(d.home, "snapshots", name)); err == nil {
+		residue = append(residue, "directory "+filepath.Join(d.home, "snapshots", name))
+	}
+	_, err = d.cli.VolumeInspect(d.ctx, dataVolumeName(name))
+	if err == nil {
+		residue = append(residue, "volume "+dataVolumeName(name))
+	} else if !client.IsErrNotFound(err) {
+		return nil, err
+	}
+	networks, err := d.orderNetworks(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		residue = append(residue, "network "+n.Name)
+	}
+	if port, ok := d.ports.Port(name); ok {
+		residue = append(residue, "port lease "+strconv.Itoa(port))
+	}
+	return residue, nil
+}
+
+// InstanceSize the cpu and memory limits of the container, the disk of the template
+func (d *DockerManager) InstanceSize(name string) (Size, error) {
+	id, err := d.containerID(name)
+	if err != nil {
+		return Size{}, err
+	}
+	if id == "" {
+		return Size{}, errors.New("container not exists")
+	}
+	info, err := d.cli.ContainerInspect(d.ctx, id)
+	if err != nil {
+		return Size{}, err
+	}
+	t := d.templates.get(name)
+	size := Size{Cpu: t.Cpu, Memory: t.Memory, Disk: t.Disk}
+	if info.HostConfig.NanoCPUs > 0 {
+		size.Cpu = uint64(info.HostConfig.NanoCPUs / 1e9)
+	}
+	if info.HostConfig.Memory > 0 {
+		size.Memory = uint64(info.HostConfig.Memory >> 30)
+	}
+	return size, nil
+}
+
+// Resize update the cpu and memory limits of the running container, the containers have no disk quota,
+// the disk is only recorded in the template of the instance
+func (d *DockerManager) Resize(name string, size Size) error {
+	current, err := d.InstanceSize(name)
+	if err != nil {
+		return err
+	}
+	t := *d.templates.get(name)
+	if err = checkResize(t, current, size); err != nil {
+		return err
+	}
+	id, err := d.containerID(name)
+	if err != nil {
+		return err
+	}
+	memory := int64(size.Memory << 30)
+	_, err = d.cli.ContainerUpdate(d.ctx, id, container.UpdateConfig{
+		Resources: container.Resources{
+			NanoCPUs: int64(size.Cpu) * 1e9,
+			Memory:   memory,
+			// the swap limit docker gives a container created with a memory limit
+			MemorySwap: memory * 2,
+		},
+	})
+	if err != nil {
+		return err
 	}
+	t.Cpu, t.Memory, t.Disk = size.Cpu, size.Memory, size.Disk
+	d.templates.set(name, t)
+	return nil
+}
+
+// containerID the id of the container named exactly as the instance, empty when it does not exist
+func (d *DockerManager) containerID(name string) (string, error) {
+	containers, err := d.cli.ContainerList(d.ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	if err != nil {
+		return "", err
+	}
+	// the name filter matches substrings, order_1 also finds order_12
+	for _, c := range containers {
+		for _, n := range c.Names {
+			if strings.TrimPrefix(n, "/") == name {
+				return c.ID, nil
+			}
+		}
+	}
+	return "", nil
 }
 
-// InjectionPublicKey add the public key to the container
-func (d *DockerManager) InjectionPublicKey(name, publicKey string) error {
+// existingContainerID the id of the container named exactly as the instance, an error when it does not exist
+func (d *DockerManager) existingContainerID(name string) (string, error) {
+	id, err := d.containerID(name)
+	if err == nil && id == "" {
+		err = errors.New("container not exists")
+	}
+	return id, err
+}
+
+// orderNetworks the networks created for the instance, labelled with its name
+func (d *DockerManager) orderNetworks(name string) ([]types.NetworkResource, error) {
+	return d.cli.NetworkList(d.ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", orderLabel+"="+name)),
+	})
+}
+
+// removeNetworks remove the networks created for the instance
+func (d *DockerManager) removeNetworks(name string) error {
+	networks, err := d.orderNetworks(name)
+	if err != nil {
+		return err
+	}
+	for _, n := range networks {
+		if err = d.cli.NetworkRemove(d.ctx, n.ID); err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDataVolume create the data volume of the order, an existing volume is kept with its data
+func (d *DockerManager) ensureDataVolume(name string) (string, error) {
+	v, err := d.cli.VolumeCreate(d.ctx, volume.VolumeCreateBody{
+		Name:   dataVolumeName(name),
+		Labels: map[string]string{orderLabel: name},
+	})
+	return v.Name, err
+}
+
+// removeDataVolume wipe the files of the data volume in a helper container and remove it, the volume is kept
+// when the wipe fails, so the destruction is retried and its receipt is not verified
+func (d *DockerManager) removeDataVolume(name string) error {
+	v, err := d.cli.VolumeInspect(d.ctx, dataVolumeName(name))
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = d.runHelper(v.Name, wipeVolumeScript); err != nil {
+		return fmt.Errorf("wipe data volume %s: %w", v.Name, err)
+	}
+	return d.cli.VolumeRemove(d.ctx, v.Name, true)
+}
+
+// runHelper run the shell script in a helper container with the volume mounted at helperMount and wait for
+// it, the volumes are reached through the docker api, the provider needs no access to /var/lib/docker
+func (d *DockerManager) runHelper(volume, script string) error {
+	image, err := d.ensureImage(Template{Image: helperImage})
+	if err != nil {
+		return err
+	}
+	resp, err := d.cli.ContainerCreate(d.ctx, &container.Config{
+		Image: image,
+		Cmd:   []string{"sh", "-c", script},
+	}, &container.HostConfig{
+		NetworkMode: "none",
+		Mounts:      []mount.Mount{{Type: mount.TypeVolume, Source: volume, Target: helperMount}},
+	}, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = d.cli.ContainerRemove(d.ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+	if err = d.cli.ContainerStart(d.ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+	statusCh, errCh := d.cli.ContainerWait(d.ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err = <-errCh:
+		return err
+	case status := <-statusCh:
+		if status.Error != nil {
+			return errors.New(status.Error.Message)
+		}
+		if status.StatusCode != 0 {
+			return fmt.Errorf("helper container exited with %d", status.StatusCode)
+		}
+		return nil
+	}
+}
+
+// ExportData copy the data volume out of the stopped container as a tar stream
+func (d *DockerManager) ExportData(name string, w io.Writer) error {
+	id, err := d.existingContainerID(name)
+	if err != nil {
+		return err
+	}
+	info, err := d.cli.ContainerInspect(d.ctx, id)
+	if err != nil {
+		return err
+	}
+	if info.State != nil && info.State.Running {
+		return errors.New("the container is still running")
+	}
+	for _, m := range info.Mounts {
+		if m.Name != dataVolumeName(name) {
+			continue
+		}
+		reader, _, err := d.cli.CopyFromContainer(d.ctx, id, m.Destination)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(w, reader)
+		return err
+	}
+	return ErrNoData
+}
+
+// DataFormat the export holds the files of the data volume
+func (d *DockerManager) DataFormat() string {
+	return DataFiles
+}
+
+func dataVolumeName(name string) string {
+	return name + "-data"
+}
 
+// SetAuthorizedKeys replace the provider managed keys of the container, the keys are copied
+// into the container as a file and never pass through a shell
+func (d *DockerManager) SetAuthorizedKeys(name string, keys []string) error {
 	status, err := d.Status(name)
+	if err != nil {
+		return err
+	}
 	if !status.IsRunning() {
 		return errors.New("invalid container status")
 	}
+	user := d.templates.get(name).User
+	existing, err := d.readFile(status.id, user.authorizedKeysFile())
+	if err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	err = d.writeFile(status.id, user.authorizedKeysFile(), mergeAuthorizedKeys(existing, keys))
+	if err != nil || user.IsRoot() {
+		return err
+	}
+	return d.exec(status.id, "chown", "-R", user.Name+":", user.sshDir())
+}
+
+// customize run the guest customization script in the container
+func (d *DockerManager) customize(name, id string) error {
+	script, err := d.templates.get(name).User.CustomizeScript()
+	if err != nil || script == "" {
+		return err
+	}
+	return d.exec(id, "sh", "-c", script)
+}
+
+// exec run the command in the container and wait for it to exit, the command is not run by a shell
+func (d *DockerManager) exec(id string, cmd ...string) error {
+	resp, err := d.cli.ContainerExecCreate(d.ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
 	if err != nil {
 		return err
 	}
-	id := status.id
-	if id != "" {
-		cmd := fmt.Sprintf("echo %s  > /root/.ssh/authorized_keys", publicKey)
-		command := exec.Command("docker", "exec", id, "bash", "-c", cmd)
-		return command.Run()
-	} else {
-		return errors.New("container status is invalid")
+	attach, err := d.cli.ContainerExecAttach(d.ctx, resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return err
 	}
+	defer attach.Close()
+	var out strings.Builder
+	if _, err = stdcopy.StdCopy(&out, &out, attach.Reader); err != nil {
+		return err
+	}
+	inspect, err := d.cli.ContainerExecInspect(d.ctx, resp.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%s exit with code %d: %s", cmd[0], inspect.ExitCode, out.String())
+	}
+	return nil
+}
+
+// readFile read a regular file of the container
+func (d *DockerManager) readFile(id, file string) (string, error) {
+	reader, _, err := d.cli.CopyFromContainer(d.ctx, id, file)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	if _, err = tr.Next(); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(tr)
+	return string(data), err
+}
+
+// writeFile write a file only readable by its owner, its directory is created when missing
+func (d *DockerManager) writeFile(id, file, content string) error {
+	dir := path.Dir(file)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     path.Base(dir) + "/",
+		Mode:     0700,
+	})
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Base(dir) + "/" + path.Base(file),
+		Mode:     0600,
+		Size:     int64(len(content)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = tw.Write([]byte(content)); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return d.cli.CopyToContainer(d.ctx, id, path.Dir(dir), &buf, types.CopyToContainerOptions{})
+}
+
+// List list the order containers managed by docker
+func (d *DockerManager) List() ([]string, error) {
+	containers, err := d.cli.ContainerList(d.ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", instanceNamePrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, c := range containers {
+		for _, name := range c.Names {
+			if _, ok := ParseInstanceName(name); ok {
+				names = append(names, strings.TrimPrefix(name, "/"))
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// ConsoleLog the last tail lines of the container output
+func (d *DockerManager) ConsoleLog(name string, tail int) (string, error) {
+	status, err := d.Status(name)
+	if err != nil {
+		return "", err
+	}
+	out, err := d.cli.ContainerLogs(d.ctx, status.id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(tail),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	var buf strings.Builder
+	_, err = stdcopy.StdCopy(&buf, &buf, out)
+	return buf.String(), err
 }
@@ -0,0 +1,299 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotRepository the repository of the committed snapshot images, tagged with the snapshot name
+const snapshotRepository = "hamster-snapshots"
+
+// Snapshot commit the container as an image and save the content of its volumes
+func (d *DockerManager) Snapshot(name, label string) (*Snapshot, error) {
+	id, err := d.existingContainerID(name)
+	if err != nil {
+		return nil, err
+	}
+	inspect, err := d.cli.ContainerInspect(d.ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := newSnapshotName()
+	// a commit would silently move the tag of a snapshot taken in the same second
+	if _, _, err = d.cli.ImageInspectWithRaw(d.ctx, snapshotImage(name, snapshot)); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", snapshot)
+	}
+	dir := d.snapshotDir(name, snapshot)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	for _, m := range inspect.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+		if err = d.saveVolume(id, m.Destination, filepath.Join(dir, volumeArchive(m.Destination))); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	_, err = d.cli.ContainerCommit(d.ctx, id, types.ContainerCommitOptions{
+		Reference: snapshotImage(name, snapshot),
+		Comment:   label,
+		Pause:     true,
+	})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return d.snapshot(name, snapshot)
+}
+
+// ListSnapshots the snapshot images of the container
+func (d *DockerManager) ListSnapshots(name string) ([]Snapshot, error) {
+	images, err := d.cli.ImageList(d.ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", snapshotRepository+"/"+name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	prefix := snapshotRepository + "/" + name + ":"
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if !strings.HasPrefix(tag, prefix) {
+				continue
+			}
+			snapshot, err := d.snapshot(name, strings.TrimPrefix(tag, prefix))
+			if err != nil {
+				return nil, err
+			}
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// Restore replace the container with one created from the snapshot image, the named volumes are
+// emptied and filled with their saved content. The old container and the content of its volumes are
+// kept until the new container is ready, a failed restore puts them back
+func (d *DockerManager) Restore(name, snapshot string) error {
+	image := snapshotImage(name, snapshot)
+	if _, _, err := d.cli.ImageInspectWithRaw(d.ctx, image); client.IsErrNotFound(err) {
+		return ErrSnapshotNotFound
+	} else if err != nil {
+		return err
+	}
+	id, err := d.existingContainerID(name)
+	if err != nil {
+		return err
+	}
+	inspect, err := d.cli.ContainerInspect(d.ctx, id)
+	if err != nil {
+		return err
+	}
+	running := inspect.State != nil && inspect.State.Running
+	var volumes []types.MountPoint
+	for _, m := range inspect.Mounts {
+		if m.Type == mount.TypeVolume {
+			volumes = append(volumes, m)
+		}
+	}
+	// the named volumes are shared by the old and the new container, the anonymous ones are not
+	named := map[string]bool{}
+	for _, m := range inspect.HostConfig.Mounts {
+		if m.Type == mount.TypeVolume && m.Source != "" {
+			named[m.Source] = true
+		}
+	}
+
+	// the old container gives the name and the ports up, the content of its volumes is saved for a rollback
+	if running {
+		if err = d.cli.ContainerStop(d.ctx, id, nil); err != nil {
+			return err
+		}
+	}
+	rollbackDir := filepath.Join(d.home, "snapshots", name, ".rollback")
+	rollback := func(newId string, restored []types.MountPoint) {
+		if newId != "" {
+			_ = d.cli.ContainerRemove(d.ctx, newId, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		}
+		for _, m := range restored {
+			if !named[m.Name] {
+				continue
+			}
+			if err := d.emptyVolume(m.Name); err == nil {
+				err = d.restoreVolume(id, m.Destination, filepath.Join(rollbackDir, volumeArchive(m.Destination)))
+			}
+			if err != nil {
+				log.WithField("instance", name).Errorf("roll the volume %s back fail: %s", m.Name, err)
+			}
+		}
+		_ = d.cli.ContainerRename(d.ctx, id, name)
+		if running {
+			_ = d.cli.ContainerStart(d.ctx, id, types.ContainerStartOptions{})
+		}
+		_ = os.RemoveAll(rollbackDir)
+	}
+	if err = os.MkdirAll(rollbackDir, 0700); err != nil {
+		rollback("", nil)
+		return err
+	}
+	for _, m := range volumes {
+		if !named[m.Name] {
+			continue
+		}
+		if err = d.saveVolume(id, m.Destination, filepath.Join(rollbackDir, volumeArchive(m.Destination))); err != nil {
+			rollback("", nil)
+			return err
+		}
+	}
+	if err = d.cli.ContainerRename(d.ctx, id, name+"-pre-restore"); err != nil {
+		rollback("", nil)
+		return err
+	}
+
+	// the anonymous volumes of the new container are created empty, the named volumes are shared
+	cfg := inspect.Config
+	cfg.Image = image
+	resp, err := d.cli.ContainerCreate(d.ctx, cfg, inspect.HostConfig, nil, nil, name)
+	if err != nil {
+		rollback("", nil)
+		return err
+	}
+	dir := d.snapshotDir(name, snapshot)
+	for i, m := range volumes {
+		if named[m.Name] {
+			if err = d.emptyVolume(m.Name); err != nil {
+				rollback(resp.ID, volumes[:i+1])
+				return err
+			}
+		}
+		if err = d.restoreVolume(resp.ID, m.Destination, filepath.Join(dir, volumeArchive(m.Destination))); err != nil {
+			rollback(resp.ID, volumes[:i+1])
+			return err
+		}
+	}
+
+	// the restore succeeded, the old container goes with its anonymous volumes
+	if err = d.cli.ContainerRemove(d.ctx, id, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+		log.WithField("instance", name).Errorf("remove the replaced container fail: %s", err)
+	}
+	_ = os.RemoveAll(rollbackDir)
+	if running {
+		return d.cli.ContainerStart(d.ctx, resp.ID, types.ContainerStartOptions{})
+	}
+	return nil
+}
+
+// DeleteSnapshot remove the snapshot image and the saved volumes
+func (d *DockerManager) DeleteSnapshot(name, snapshot string) error {
+	_, err := d.cli.ImageRemove(d.ctx, snapshotImage(name, snapshot), types.ImageRemoveOptions{Force: true, PruneChildren: true})
+	if client.IsErrNotFound(err) {
+		return ErrSnapshotNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(d.snapshotDir(name, snapshot))
+}
+
+// deleteSnapshots remove all the snapshots of the container
+func (d *DockerManager) deleteSnapshots(name string) error {
+	snapshots, err := d.ListSnapshots(name)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if err = d.DeleteSnapshot(name, snapshot.Name); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(d.home, "snapshots", name))
+}
+
+func (d *DockerManager) snapshot(name, snapshot string) (*Snapshot, error) {
+	inspect, _, err := d.cli.ImageInspectWithRaw(d.ctx, snapshotImage(name, snapshot))
+	if err != nil {
+		return nil, err
+	}
+	created, _ := time.Parse(time.RFC3339Nano, inspect.Created)
+	size := inspect.Size
+	files, _ := os.ReadDir(d.snapshotDir(name, snapshot))
+	for _, f := range files {
+		if info, err := f.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return &Snapshot{
+		Name:    snapshot,
+		Label:   inspect.Comment,
+		Created: created.UTC(),
+		Size:    size,
+	}, nil
+}
+
+// saveVolume save the volume content of the container as a tar file
+func (d *DockerManager) saveVolume(id, destination, file string) error {
+	reader, _, err := d.cli.CopyFromContainer(d.ctx, id, destination)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, reader); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restoreVolume copy the saved volume content into the container
+func (d *DockerManager) restoreVolume(id, destination, file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		// the volume is newer than the snapshot
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return d.cli.CopyToContainer(d.ctx, id, path.Dir(destination), f, types.CopyToContainerOptions{})
+}
+
+// emptyVolume remove the content of the named volume in a helper container, the volume is kept since
+// the replaced container still uses it
+func (d *DockerManager) emptyVolume(name string) error {
+	return d.runHelper(name, emptyVolumeScript)
+}
+
+func (d *DockerManager) snapshotDir(name, snapshot string) string {
+	return filepath.Join(d.home, "snapshots", name, snapshot)
+}
+
+func snapshotImage(name, snapshot string) string {
+	return fmt.Sprintf("%s/%s:%s", snapshotRepository, name, snapshot)
+}
+
+// volumeArchive the file name of the saved volume mounted at the destination
+func volumeArchive(destination string) string {
+	return strings.ReplaceAll(strings.Trim(destination, "/"), "/", "_") + ".tar"
+}
@@ -26,13 +26,13 @@ func getTemplate() Template {
 }
 
 func TestSetTemplate(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, client)
 }
 
 func TestCreate(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 
 	assert.NoError(t, err)
 
@@ -52,7 +52,7 @@ func TestCreate(t *testing.T) {
 
 func TestStart(t *testing.T) {
 
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.Create(containerName)
@@ -70,7 +70,7 @@ func TestStart(t *testing.T) {
 }
 
 func TestCreateAndStart(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.CreateAndStart(containerName)
@@ -85,7 +85,7 @@ func TestCreateAndStart(t *testing.T) {
 }
 
 func TestCreateAndStartAndInjectionPublicKey(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.CreateAndStartAndInjectionPublicKey(containerName, publicKey)
@@ -100,7 +100,7 @@ func TestCreateAndStartAndInjectionPublicKey(t *testing.T) {
 }
 
 func TestStop(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.CreateAndStart(containerName)
@@ -116,7 +116,7 @@ func TestStop(t *testing.T) {
 }
 
 func TestReboot(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 	id, err := client.Create(containerName)
 	defer clean(id)
@@ -130,7 +130,7 @@ func TestReboot(t *testing.T) {
 }
 
 func TestShutdown(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.CreateAndStart(containerName)
@@ -150,7 +150,7 @@ func TestShutdown(t *testing.T) {
 }
 
 func TestDestroy(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	_, err = client.Create(containerName)
@@ -164,7 +164,7 @@ func TestDestroy(t *testing.T) {
 }
 
 func TestStatus(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.Create(containerName)
@@ -191,7 +191,7 @@ func TestStatus(t *testing.T) {
 }
 
 func TestGetIp(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.Create(containerName)
@@ -205,7 +205,7 @@ func TestGetIp(t *testing.T) {
 }
 
 func TestGetPort(t *testing.T) {
-	client, err := NewDockerManager(getTemplate())
+	client, err := NewDockerManager(getTemplate(), nil)
 	assert.NoError(t, err)
 
 	id, err := client.CreateAndStart(containerName)
@@ -218,7 +218,7 @@ func TestGetPort(t *testing.T) {
 }
 
 func clean(id string) {
-	client, _ := NewDockerManager(getTemplate())
+	client, _ := NewDockerManager(getTemplate(), nil)
 	err := client.cli.ContainerRemove(client.ctx, id, types.ContainerRemoveOptions{
 		Force: true,
 	})
@@ -0,0 +1,296 @@
+package vm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// DomainSpec the virtual machine a libvirt domain is generated from
+type DomainSpec struct {
+	Name       string
+	Vcpus      uint
+	Memory     uint64 // MiB
+	MaxVcpus   uint   // vcpus and memory the domain can grow to while running, no headroom when not greater
+	MaxMemory  uint64 // MiB
+	CpuSet     []uint // host cpus the vcpus are pinned to in turn, no pinning when empty
+	Sockets    uint   // cpu topology, one socket with a core per vcpu when empty
+	Cores      uint
+	Threads    uint
+	Disk       string // qcow2 system disk
+	DataDisk   string // qcow2 data disk kept for the whole agreement, optional
+	Seed       string // cloud-init seed iso, optional
+	Network    string // libvirt network, default when empty
+	ConsoleLog string // file the serial console is written to
+	VncListen  string // address vnc listens on, localhost when empty
+}
+
+type domainXML struct {
+	XMLName  xml.Name         `xml:"domain"`
+	Type     string           `xml:"type,attr"`
+	Name     string           `xml:"name"`
+	Memory   domainMemory     `xml:"memory"`
+	Current  *domainMemory    `xml:"currentMemory,omitempty"`
+	Vcpu     domainVcpu       `xml:"vcpu"`
+	CpuTune  *domainCpuTune   `xml:"cputune,omitempty"`
+	OS       domainOS         `xml:"os"`
+	Features domainFeatures   `xml:"features"`
+	Cpu      domainCpu        `xml:"cpu"`
+	OnCrash  string           `xml:"on_crash"`
+	Devices  domainDeviceList `xml:"devices"`
+}
+
+type domainMemory struct {
+	Unit  string `xml:"unit,attr"`
+	Value uint64 `xml:",chardata"`
+}
+
+type domainVcpu struct {
+	Placement string `xml:"placement,attr"`
+	Current   uint   `xml:"current,attr,omitempty"`
+	Value     uint   `xml:",chardata"`
+}
+
+type domainCpuTune struct {
+	VcpuPin []domainVcpuPin `xml:"vcpupin"`
+}
+
+type domainVcpuPin struct {
+	Vcpu   uint   `xml:"vcpu,attr"`
+	CpuSet string `xml:"cpuset,attr"`
+}
+
+type domainOS struct {
+	Type domainOSType `xml:"type"`
+	Boot domainBoot   `xml:"boot"`
+}
+
+type domainOSType struct {
+	Arch  string `xml:"arch,attr"`
+	Value string `xml:",chardata"`
+}
+
+type domainBoot struct {
+	Dev string `xml:"dev,attr"`
+}
+
+type domainFeatures struct {
+	ACPI struct{} `xml:"acpi"`
+	APIC struct{} `xml:"apic"`
+}
+
+type domainCpu struct {
+	Mode     string         `xml:"mode,attr"`
+	Topology domainTopology `xml:"topology"`
+}
+
+type domainTopology struct {
+	Sockets uint `xml:"sockets,attr"`
+	Cores   uint `xml:"cores,attr"`
+	Threads uint `xml:"threads,attr"`
+}
+
+type domainDeviceList struct {
+	Disks      []domainDisk      `xml:"disk"`
+	Interfaces []domainInterface `xml:"interface"`
+	Serials    []domainChardev   `xml:"serial"`
+	Consoles   []domainChardev   `xml:"console"`
+	Channels   []domainChannel   `xml:"channel"`
+	Graphics   []domainGraphics  `xml:"graphics"`
+}
+
+type domainDisk struct {
+	Type     string           `xml:"type,attr"`
+	Device   string           `xml:"device,attr"`
+	Driver   domainDiskDriver `xml:"driver"`
+	Source   domainSource     `xml:"source"`
+	Target   domainDiskTarget `xml:"target"`
+	ReadOnly *struct{}        `xml:"readonly,omitempty"`
+}
+
+type domainDiskDriver struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type domainSource struct {
+	File    string `xml:"file,attr,omitempty"`
+	Path    string `xml:"path,attr,omitempty"`
+	Network string `xml:"network,attr,omitempty"`
+}
+
+type domainDiskTarget struct {
+	Dev string `xml:"dev,attr"`
+	Bus string `xml:"bus,attr"`
+}
+
+type domainInterface struct {
+	Type   string       `xml:"type,attr"`
+	Source domainSource `xml:"source"`
+	Model  domainModel  `xml:"model"`
+}
+
+type domainModel struct {
+	Type string `xml:"type,attr"`
+}
+
+type domainChardev struct {
+	Type   string           `xml:"type,attr"`
+	Source *domainSource    `xml:"source,omitempty"`
+	Target domainCharTarget `xml:"target"`
+}
+
+type domainCharTarget struct {
+	Type string `xml:"type,attr,omitempty"`
+	Name string `xml:"name,attr,omitempty"`
+	Port *uint  `xml:"port,attr,omitempty"`
+}
+
+type domainChannel struct {
+	Type   string           `xml:"type,attr"`
+	Target domainCharTarget `xml:"target"`
+}
+
+type domainGraphics struct {
+	Type     string `xml:"type,attr"`
+	Port     int    `xml:"port,attr"`
+	AutoPort string `xml:"autoport,attr"`
+	Listen   string `xml:"listen,attr"`
+}
+
+// maxVcpus the vcpus the domain is defined with, those above Vcpus are offline until they are plugged
+func (s DomainSpec) maxVcpus() uint {
+	if s.MaxVcpus > s.Vcpus {
+		return s.MaxVcpus
+	}
+	return s.Vcpus
+}
+
+// topology the sockets, cores and threads of the maximum vcpus
+func (s DomainSpec) topology() (domainTopology, error) {
+	vcpus := s.maxVcpus()
+	t := domainTopology{Sockets: s.Sockets, Cores: s.Cores, Threads: s.Threads}
+	if t.Sockets == 0 && t.Cores == 0 && t.Threads == 0 {
+		return domainTopology{Sockets: 1, Cores: vcpus, Threads: 1}, nil
+	}
+	if t.Sockets == 0 {
+		t.Sockets = 1
+	}
+	if t.Threads == 0 {
+		t.Threads = 1
+	}
+	if t.Cores == 0 {
+		t.Cores = vcpus / (t.Sockets * t.Threads)
+	}
+	if t.Sockets*t.Cores*t.Threads != vcpus {
+		return t, fmt.Errorf("cpu topology %d sockets, %d cores, %d threads does not match %d vcpus",
+			t.Sockets, t.Cores, t.Threads, vcpus)
+	}
+	return t, nil
+}
+
+// XML generate the libvirt domain definition
+func (s DomainSpec) XML() (string, error) {
+	if s.Name == "" {
+		return "", errors.New("domain name is empty")
+	}
+	if s.Vcpus == 0 || s.Memory == 0 {
+		return "", errors.New("domain cpu and memory must be greater than 0")
+	}
+	if s.Disk == "" {
+		return "", errors.New("domain disk is empty")
+	}
+	topology, err := s.topology()
+	if err != nil {
+		return "", err
+	}
+	network := s.Network
+	if network == "" {
+		network = "default"
+	}
+	listen := s.VncListen
+	if listen == "" {
+		listen = "127.0.0.1"
+	}
+
+	d := domainXML{
+		Type:    "kvm",
+		Name:    s.Name,
+		Memory:  domainMemory{Unit: "MiB", Value: s.Memory},
+		Vcpu:    domainVcpu{Placement: "static", Value: s.maxVcpus()},
+		OS:      domainOS{Type: domainOSType{Arch: "x86_64", Value: "hvm"}, Boot: domainBoot{Dev: "hd"}},
+		Cpu:     domainCpu{Mode: "host-passthrough", Topology: topology},
+		OnCrash: "restart",
+	}
+	if s.maxVcpus() > s.Vcpus {
+		d.Vcpu.Current = s.Vcpus
+	}
+	// the balloon gives the guest its memory, it can be raised up to the maximum
+	if s.MaxMemory > s.Memory {
+		d.Memory.Value = s.MaxMemory
+		d.Current = &domainMemory{Unit: "MiB", Value: s.Memory}
+	}
+	if len(s.CpuSet) > 0 {
+		d.CpuTune = &domainCpuTune{}
+		for i := uint(0); i < s.maxVcpus(); i++ {
+			d.CpuTune.VcpuPin = append(d.CpuTune.VcpuPin, domainVcpuPin{
+				Vcpu:   i,
+				CpuSet: strconv.FormatUint(uint64(s.CpuSet[int(i)%len(s.CpuSet)]), 10),
+			})
+		}
+	}
+
+	devices := &d.Devices
+	devices.Disks = append(devices.Disks, domainDisk{
+		Type:   "file",
+		Device: "disk",
+		Driver: domainDiskDriver{Name: "qemu", Type: "qcow2"},
+		Source: domainSource{File: s.Disk},
+		Target: domainDiskTarget{Dev: "vda", Bus: "virtio"},
+	})
+	if s.DataDisk != "" {
+		devices.Disks = append(devices.Disks, domainDisk{
+			Type:   "file",
+			Device: "disk",
+			Driver: domainDiskDriver{Name: "qemu", Type: "qcow2"},
+			Source: domainSource{File: s.DataDisk},
+			Target: domainDiskTarget{Dev: "vdb", Bus: "virtio"},
+		})
+	}
+	if s.Seed != "" {
+		devices.Disks = append(devices.Disks, domainDisk{
+			Type:     "file",
+			Device:   "cdrom",
+			Driver:   domainDiskDriver{Name: "qemu", Type: "raw"},
+			Source:   domainSource{File: s.Seed},
+			Target:   domainDiskTarget{Dev: "sda", Bus: "sata"},
+			ReadOnly: &struct{}{},
+		})
+	}
+	devices.Interfaces = append(devices.Interfaces, domainInterface{
+		Type:   "network",
+		Source: domainSource{Network: network},
+		Model:  domainModel{Type: "virtio"},
+	})
+	port := uint(0)
+	serial := domainChardev{Type: "pty", Target: domainCharTarget{Port: &port}}
+	if s.ConsoleLog != "" {
+		serial = domainChardev{Type: "file", Source: &domainSource{Path: s.ConsoleLog}, Target: domainCharTarget{Port: &port}}
+	}
+	devices.Serials = append(devices.Serials, serial)
+	console := serial
+	console.Target = domainCharTarget{Type: "serial", Port: &port}
+	devices.Consoles = append(devices.Consoles, console)
+	devices.Channels = append(devices.Channels, domainChannel{
+		Type:   "unix",
+		Target: domainCharTarget{Type: "virtio", Name: "org.qemu.guest_agent.0"},
+	})
+	devices.Graphics = append(devices.Graphics, domainGraphics{Type: "vnc", Port: -1, AutoPort: "yes", Listen: listen})
+
+	data, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
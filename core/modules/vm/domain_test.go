@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestDomainSpecXML(t *testing.T) {
+	spec := DomainSpec{
+		Name:       "order_1",
+		Vcpus:      4,
+		Memory:     2048,
+		CpuSet:     []uint{2, 3},
+		Disk:       "/data/orders/order_1.qcow2",
+		DataDisk:   "/data/orders/order_1-data.qcow2",
+		Seed:       "/data/orders/order_1-seed.iso",
+		ConsoleLog: "/data/orders/order_1.console.log",
+	}
+	domain, err := spec.XML()
+	assert.NoError(t, err)
+	for _, s := range []string{
+		`<domain type="kvm">`,
+		`<name>order_1</name>`,
+		`<memory unit="MiB">2048</memory>`,
+		`<vcpu placement="static">4</vcpu>`,
+		`<vcpupin vcpu="0" cpuset="2"></vcpupin>`,
+		`<vcpupin vcpu="3" cpuset="3"></vcpupin>`,
+		`<topology sockets="1" cores="4" threads="1"></topology>`,
+		`<source file="/data/orders/order_1.qcow2"></source>`,
+		`<target dev="vda" bus="virtio"></target>`,
+		`<source file="/data/orders/order_1-data.qcow2"></source>`,
+		`<target dev="vdb" bus="virtio"></target>`,
+		`<source file="/data/orders/order_1-seed.iso"></source>`,
+		`<source network="default"></source>`,
+		`<model type="virtio"></model>`,
+		`<serial type="file">`,
+		`<source path="/data/orders/order_1.console.log"></source>`,
+		`<target type="virtio" name="org.qemu.guest_agent.0"></target>`,
+		`<graphics type="vnc" port="-1" autoport="yes" listen="127.0.0.1"></graphics>`,
+	} {
+		assert.True(t, strings.Contains(domain, s), s)
+	}
+	assert.False(t, strings.Contains(domain, "0.0.0.0"))
+
+	spec.CpuSet = nil
+	spec.Sockets, spec.Threads = 2, 2
+	domain, err = spec.XML()
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(domain, "cputune"))
+	assert.True(t, strings.Contains(domain, `<topology sockets="2" cores="1" threads="2"></topology>`))
+
+	spec.Cores = 2
+	_, err = spec.XML()
+	assert.Error(t, err)
+
+	_, err = DomainSpec{Name: "order_1", Vcpus: 1, Memory: 1024}.XML()
+	assert.Error(t, err)
+}
+
+func TestDomainSpecHeadroom(t *testing.T) {
+	spec := DomainSpec{
+		Name:      "order_1",
+		Vcpus:     2,
+		Memory:    2048,
+		MaxVcpus:  8,
+		MaxMemory: 16384,
+		CpuSet:    []uint{2, 3},
+		Disk:      "/data/orders/order_1.qcow2",
+	}
+	domain, err := spec.XML()
+	assert.NoError(t, err)
+	for _, s := range []string{
+		`<memory unit="MiB">16384</memory>`,
+		`<currentMemory unit="MiB">2048</currentMemory>`,
+		`<vcpu placement="static" current="2">8</vcpu>`,
+		`<vcpupin vcpu="7" cpuset="3"></vcpupin>`,
+		`<topology sockets="1" cores="8" threads="1"></topology>`,
+	} {
+		assert.True(t, strings.Contains(domain, s), s)
+	}
+
+	// a maximum below the size is ignored
+	spec.MaxVcpus, spec.MaxMemory = 1, 1024
+	domain, err = spec.XML()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(domain, `<vcpu placement="static">2</vcpu>`))
+	assert.True(t, strings.Contains(domain, `<memory unit="MiB">2048</memory>`))
+	assert.False(t, strings.Contains(domain, "currentMemory"))
+}
@@ -0,0 +1,47 @@
+package vm
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrNoData the instance was created without a data volume
+var ErrNoData = errors.New("the instance has no data volume")
+
+const (
+	// DataFiles the export holds the files of the data volume
+	DataFiles = "files"
+	// DataQcow2 the export holds the data disk as a qcow2 image, read it with qemu-nbd or convert it with qemu-img
+	DataQcow2 = "qcow2"
+)
+
+// tarFile write the file as the single entry of a tar stream
+func tarFile(w io.Writer, file, entry string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoData
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = entry
+	tw := tar.NewWriter(w)
+	if err = tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(tw, f, header.Size); err != nil {
+		return err
+	}
+	return tw.Close()
+}
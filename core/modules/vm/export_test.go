@@ -0,0 +1,36 @@
+package vm
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "order_1-data.qcow2")
+	assert.NoError(t, os.WriteFile(file, []byte("disk content"), 0600))
+
+	var buf bytes.Buffer
+	assert.NoError(t, tarFile(&buf, file, "data.qcow2"))
+
+	tr := tar.NewReader(&buf)
+	header, err := tr.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "data.qcow2", header.Name)
+	content, err := io.ReadAll(tr)
+	assert.NoError(t, err)
+	assert.Equal(t, "disk content", string(content))
+	_, err = tr.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestTarFileMissing(t *testing.T) {
+	var buf bytes.Buffer
+	err := tarFile(&buf, filepath.Join(t.TempDir(), "missing.qcow2"), "data.qcow2")
+	assert.ErrorIs(t, err, ErrNoData)
+	assert.Zero(t, buf.Len())
+}
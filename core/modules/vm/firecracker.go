@@ -0,0 +1,755 @@
+package vm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/archive"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcDefaultSubnet = "172.30.0.0/16"
+	// fcDefaultInit the init of the rootfs images of the firecracker guides, it mounts the overlay over the root
+	fcDefaultInit = "/sbin/overlay-init"
+	// fcDefaultDisk the size of the overlay in GB when the template has no disk size
+	fcDefaultDisk = 10
+)
+
+var (
+	// fcReadyTimeout the api of a launched firecracker process is waited for
+	fcReadyTimeout = 5 * time.Second
+	// fcStopTimeout the firecracker process is killed when the guest has not shut down in time
+	fcStopTimeout = 30 * time.Second
+
+	errFcSnapshot = errors.New("snapshots are not supported by the firecracker virtualization")
+	errFcUser     = errors.New("tenant users are not supported by the firecracker virtualization, leave vm.user.name empty")
+	errFcData     = errors.New("data volumes are not supported by the firecracker virtualization, set vm.dataPath to -")
+)
+
+// FirecrackerOptions the firecracker binary, the guest kernel and the network of the microvms
+type FirecrackerOptions struct {
+	Binary string // firecracker in the PATH when empty
+	Kernel string // uncompressed guest kernel
+	Subnet string // the /30 networks of the taps are taken from it, 172.30.0.0/16 when empty
+	Init   string // init the guest boots, it mounts the overlay over the root, /sbin/overlay-init when empty
+}
+
+// FirecrackerManager firecracker microvm 管理: 每个实例一个 firecracker 进程, 模板的根文件系统只读挂载,
+// 写入保存在实例自己的 overlay 盘, 实例通过 tap 网卡访问, 公钥通过 MMDS 提供给实例.
+// 限制: firecracker 进程不经过 jailer, 以 daemon 的用户运行; tap 没有 NAT, 实例只能访问宿主机;
+// 不支持租户用户和数据卷, 租户以 root 登录
+type FirecrackerManager struct {
+	home      string
+	binary    string
+	kernel    string
+	init      string
+	subnet    *net.IPNet
+	templates instanceTemplates
+	images    *imageStore
+	cache     *cache.ImageCache
+	// the host side operations, replaced in the tests
+	launch  func(binary, socket, console string) (int, error)
+	command func(name string, args ...string) error
+	kill    func(pid int) error
+	lock    sync.Mutex
+}
+
+// microVM the settings of an instance, the firecracker process is configured from them on every start
+type microVM struct {
+	Cpu        uint64   `json:"cpu"`
+	Memory     uint64   `json:"memory"`
+	Rootfs     string   `json:"rootfs"`  // base image, mounted read only
+	Network    int      `json:"network"` // index of the /30 network of the tap in the subnet
+	AccessPort int      `json:"accessPort"`
+	Keys       []string `json:"keys"`
+}
+
+func NewFirecrackerManager(t Template, imageCache *cache.ImageCache, opts FirecrackerOptions) (*FirecrackerManager, error) {
+	if opts.Binary == "" {
+		opts.Binary = "firecracker"
+	}
+	binary, err := exec.LookPath(opts.Binary)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(opts.Kernel); err != nil {
+		return nil, fmt.Errorf("guest kernel: %w", err)
+	}
+	if opts.Init != "" && !path.IsAbs(opts.Init) {
+		return nil, fmt.Errorf("guest init is not an absolute path: %s", opts.Init)
+	}
+	homedir, _ := os.UserHomeDir()
+	if imageCache == nil {
+		imageCache = cache.NewImageCache(homedir+"/.hamster-provider/cache", 0)
+	}
+	manager, err := newFirecrackerManager(homedir+"/.hamster-provider", binary, opts.Kernel, opts.Subnet, imageCache)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Init != "" {
+		manager.init = opts.Init
+	}
+	err = manager.SetTemplate(t)
+	return manager, err
+}
+
+func newFirecrackerManager(home, binary, kernel, subnet string, imageCache *cache.ImageCache) (*FirecrackerManager, error) {
+	if subnet == "" {
+		subnet = fcDefaultSubnet
+	}
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, err
+	}
+	if ones, bits := network.Mask.Size(); bits != 32 || ones > 30 {
+		return nil, fmt.Errorf("subnet %s is not an ipv4 network larger than /30", subnet)
+	}
+	return &FirecrackerManager{
+		home:    home,
+		binary:  binary,
+		kernel:  kernel,
+		init:    fcDefaultInit,
+		subnet:  network,
+		images:  newImageStore(home + "/images"),
+		cache:   imageCache,
+		launch:  launchFirecracker,
+		command: runCommand,
+		kill:    killProcess,
+	}, nil
+}
+
+func (f *FirecrackerManager) SetTemplate(t Template) error {
+	if err := checkFcTemplate(t); err != nil {
+		return err
+	}
+	t = withAccessPort(t)
+	if err := f.prepareImage(&t); err != nil {
+		return err
+	}
+	f.templates.setDefault(t)
+	return f.collectImages()
+}
+
+func (f *FirecrackerManager) SetInstanceTemplate(name string, t Template) error {
+	if err := checkFcTemplate(t); err != nil {
+		return err
+	}
+	t = withAccessPort(t)
+	if err := f.prepareImage(&t); err != nil {
+		return err
+	}
+	f.templates.set(name, t)
+	return nil
+}
+
+// checkFcTemplate reject the settings of the template the microvms can not apply
+func checkFcTemplate(t Template) error {
+	if !t.User.IsRoot() {
+		return errFcUser
+	}
+	if t.DataPath != "" {
+		return errFcData
+	}
+	return nil
+}
+
+// PrepareImage download the root filesystem of the template
+func (f *FirecrackerManager) PrepareImage(t Template) error {
+	return f.prepareImage(&t)
+}
+
+// prepareImage fetch the ext4 root filesystem of the template from the cache and keep it as a base image, named
+// after the url and the checksum like the kvm base images
+func (f *FirecrackerManager) prepareImage(t *Template) error {
+	if _, err := os.Stat(f.images.Path(baseImageName(t))); err == nil {
+		return nil
+	}
+	file, err := f.cache.Fetch(cache.Source{Url: t.Image, Sha256: t.Sha256})
+	if err != nil {
+		return err
+	}
+	if archive.IsArchive(file) {
+		if err = os.MkdirAll(f.images.Path(""), os.ModePerm); err != nil {
+			return err
+		}
+		return extractImage(file, imageFileName(t), f.images.Path(baseImageName(t)))
+	}
+	return f.images.Import(file, baseImageName(t))
+}
+
+// collectImages remove the base images no instance uses, except those of the templates
+func (f *FirecrackerManager) collectImages() error {
+	var keep []string
+	for _, t := range f.templates.all() {
+		keep = append(keep, baseImageName(t))
+	}
+	_, err := f.images.Collect(keep...)
+	return err
+}
+
+// Create create the overlay of the instance and take a network for its tap
+func (f *FirecrackerManager) Create(name string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, err := f.create(name)
+	return name, err
+}
+
+func (f *FirecrackerManager) create(name string) (*microVM, error) {
+	if m, err := f.load(name); err == nil {
+		return m, nil
+	}
+	t := f.templates.get(name)
+	if t == nil {
+		return nil, errors.New("the instance has no template")
+	}
+	if err := f.prepareImage(t); err != nil {
+		return nil, err
+	}
+	network, err := f.allocateNetwork()
+	if err != nil {
+		return nil, err
+	}
+	m := &microVM{
+		Cpu:        t.Cpu,
+		Memory:     t.Memory,
+		Rootfs:     baseImageName(t),
+		Network:    network,
+		AccessPort: t.AccessPort,
+	}
+	if t.PublicKey != "" {
+		m.Keys = []string{t.PublicKey}
+	}
+	if err = os.MkdirAll(f.dir(name), 0700); err != nil {
+		return nil, err
+	}
+	err = f.createOverlay(name, t.Disk)
+	if err == nil {
+		err = f.images.Acquire(m.Rootfs, name)
+	}
+	if err == nil {
+		err = f.save(name, m)
+	}
+	if err != nil {
+		_ = os.RemoveAll(f.dir(name))
+		return nil, err
+	}
+	return m, nil
+}
+
+// createOverlay the writable ext4 disk the guest lays over the read only root filesystem
+func (f *FirecrackerManager) createOverlay(name string, size uint64) error {
+	if size == 0 {
+		size = fcDefaultDisk
+	}
+	file, err := os.OpenFile(f.overlayFile(name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = file.Truncate(int64(size << 30))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return f.command("mkfs.ext4", "-q", "-F", f.overlayFile(name))
+}
+
+// Start launch the firecracker process of the instance, configure the microvm and boot it
+func (f *FirecrackerManager) Start(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.start(name)
+}
+
+func (f *FirecrackerManager) start(name string) error {
+	m, err := f.load(name)
+	if err != nil {
+		return err
+	}
+	client := newFcClient(f.socket(name))
+	if info, err := client.info(); err == nil {
+		if info.State != "Not started" {
+			return nil
+		}
+		// a process left unconfigured by a failed start
+		if err = f.killProcess(name); err != nil {
+			return err
+		}
+	}
+	if err = f.setupTap(m.Network); err != nil {
+		return err
+	}
+	_ = os.Remove(f.socket(name))
+	pid, err := f.launch(f.binary, f.socket(name), f.consoleFile(name))
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(f.pidFile(name), []byte(strconv.Itoa(pid)), 0600); err != nil {
+		log.WithField("instance", name).Errorf("save firecracker pid fail: %s", err)
+	}
+	err = f.waitReady(client)
+	if err == nil {
+		err = f.configure(client, name, m)
+	}
+	if err == nil {
+		err = client.action("InstanceStart")
+	}
+	if err != nil {
+		if killErr := f.killProcess(name); killErr != nil {
+			log.WithField("instance", name).Errorf("kill firecracker fail: %s", killErr)
+		}
+		return err
+	}
+	log.WithField("instance", name).Info("microvm started")
+	return nil
+}
+
+func (f *FirecrackerManager) waitReady(client *fcClient) error {
+	deadline := time.Now().Add(fcReadyTimeout)
+	for {
+		_, err := client.info()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("firecracker api not ready: %w", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// configure the machine, the drives, the network and the metadata of the microvm before it boots,
+// the root filesystem is vda and the overlay vdb
+func (f *FirecrackerManager) configure(client *fcClient, name string, m *microVM) error {
+	host, guest := f.addresses(m.Network)
+	requests := []struct {
+		path string
+		body interface{}
+	}{
+		{"/machine-config", fcMachineConfig{VcpuCount: m.Cpu, MemSizeMib: m.Memory << 10}},
+		{"/boot-source", fcBootSource{KernelImagePath: f.kernel, BootArgs: bootArgs(host, guest, f.init)}},
+		{"/drives/rootfs", fcDrive{DriveId: "rootfs", PathOnHost: f.images.Path(m.Rootfs), IsRootDevice: true, IsReadOnly: true}},
+		{"/drives/overlay", fcDrive{DriveId: "overlay", PathOnHost: f.overlayFile(name)}},
+		{"/network-interfaces/eth0", fcNetworkInterface{IfaceId: "eth0", GuestMac: guestMac(guest), HostDevName: tapName(m.Network)}},
+		{"/mmds/config", fcMmdsConfig{Version: "V2", NetworkInterfaces: []string{"eth0"}}},
+		{"/mmds", mmdsData(name, m)},
+	}
+	for _, r := range requests {
+		if err := client.put(r.path, r.body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FirecrackerManager) CreateAndStart(name string) (string, error) {
+	return f.CreateAndStartAndInjectionPublicKey(name, "")
+}
+
+// CreateAndStartAndInjectionPublicKey the key is served to the guest through the MMDS
+func (f *FirecrackerManager) CreateAndStartAndInjectionPublicKey(name, publicKey string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, err := f.create(name)
+	if err != nil {
+		return "", err
+	}
+	if publicKey != "" && !utils.Contains(m.Keys, publicKey) {
+		m.Keys = append(m.Keys, publicKey)
+		if err = f.save(name, m); err != nil {
+			return "", err
+		}
+	}
+	return name, f.start(name)
+}
+
+// Stop ask the guest to shut down, the firecracker process exits with it
+func (f *FirecrackerManager) Stop(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.stop(name)
+}
+
+func (f *FirecrackerManager) stop(name string) error {
+	client := newFcClient(f.socket(name))
+	info, err := client.info()
+	if err != nil {
+		// no process serves the api, the microvm is not running
+		_ = os.Remove(f.pidFile(name))
+		return nil
+	}
+	if info.State == "Running" {
+		if err = client.action("SendCtrlAltDel"); err != nil {
+			log.WithField("instance", name).Errorf("shut down the microvm fail: %s", err)
+		}
+		for deadline := time.Now().Add(fcStopTimeout); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+			if _, err = client.info(); err != nil {
+				_ = os.Remove(f.pidFile(name))
+				_ = os.Remove(f.socket(name))
+				return nil
+			}
+		}
+		log.WithField("instance", name).Warn("the microvm did not shut down in time, kill it")
+	}
+	return f.killProcess(name)
+}
+
+// killProcess kill the firecracker process that still serves the api of the instance
+func (f *FirecrackerManager) killProcess(name string) error {
+	data, err := os.ReadFile(f.pidFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	if err = f.kill(pid); err != nil {
+		return err
+	}
+	_ = os.Remove(f.pidFile(name))
+	_ = os.Remove(f.socket(name))
+	return nil
+}
+
+// Reboot firecracker has no reset, the microvm is shut down and booted again
+func (f *FirecrackerManager) Reboot(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.stop(name); err != nil {
+		return err
+	}
+	return f.start(name)
+}
+
+func (f *FirecrackerManager) Shutdown(name string) error {
+	return f.Stop(name)
+}
+
+// Destroy stop the microvm and remove its tap and its overlay
+func (f *FirecrackerManager) Destroy(name string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err := f.stop(name); err != nil {
+		return err
+	}
+	if m, err := f.load(name); err == nil {
+		if err = f.removeTap(m.Network); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(f.dir(name)); err != nil {
+		return err
+	}
+	if _, err := f.images.Release(name); err != nil {
+		return err
+	}
+	f.templates.remove(name)
+	return f.collectImages()
+}
+
+// Residue the process, the tap and the files of the instance that still exist
+func (f *FirecrackerManager) Residue(name string) ([]string, error) {
+	var residue []string
+	if _, err := newFcClient(f.socket(name)).info(); err == nil {
+		residue = append(residue, "firecracker process "+name)
+	}
+	if m, err := f.load(name); err == nil && tapExists(tapName(m.Network)) {
+		residue = append(residue, "tap "+tapName(m.Network))
+	}
+	if _, err := os.Stat(f.dir(name)); err == nil {
+		residue = append(residue, "directory "+f.dir(name))
+	}
+	return residue, nil
+}
+
+// SetAuthorizedKeys replace the keys served through the MMDS, the guest reads them again on its next poll
+func (f *FirecrackerManager) SetAuthorizedKeys(name string, keys []string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, err := f.load(name)
+	if err != nil {
+		return err
+	}
+	m.Keys = keys
+	if err = f.save(name, m); err != nil {
+		return err
+	}
+	client := newFcClient(f.socket(name))
+	if info, err := client.info(); err != nil || info.State == "Not started" {
+		// the keys are put into the MMDS on the next start
+		return nil
+	}
+	return client.put("/mmds", mmdsData(name, m))
+}
+
+func (f *FirecrackerManager) Status(name string) (*Status, error) {
+	if _, err := f.load(name); err != nil {
+		return &Status{}, errors.New("instance not exists")
+	}
+	status := 0
+	if info, err := newFcClient(f.socket(name)).info(); err == nil {
+		switch info.State {
+		case "Running":
+			status = 1
+		case "Paused":
+			status = 2
+		}
+	}
+	return &Status{id: name, status: status}, nil
+}
+
+// GetIp the guest address on the tap, reachable from the host
+func (f *FirecrackerManager) GetIp(name string) (string, error) {
+	m, err := f.load(name)
+	if err != nil {
+		return "", err
+	}
+	_, guest := f.addresses(m.Network)
+	return guest.String(), nil
+}
+
+func (f *FirecrackerManager) GetAccessPort(name string) int {
+	m, err := f.load(name)
+	if err != nil {
+		return 0
+	}
+	return m.AccessPort
+}
+
+func (f *FirecrackerManager) List() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(f.home, "firecracker"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, ok := ParseInstanceName(e.Name()); ok && e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (f *FirecrackerManager) ConsoleLog(name string, tail int) (string, error) {
+	data, err := os.ReadFile(f.consoleFile(name))
+	if err != nil {
+		return "", err
+	}
+	return utils.TailLines(string(data), tail), nil
+}
+
+func (f *FirecrackerManager) Snapshot(name, label string) (*Snapshot, error) {
+	return nil, errFcSnapshot
+}
+
+func (f *FirecrackerManager) ListSnapshots(name string) ([]Snapshot, error) {
+	return nil, nil
+}
+
+func (f *FirecrackerManager) Restore(name, snapshot string) error {
+	return errFcSnapshot
+}
+
+func (f *FirecrackerManager) DeleteSnapshot(name, snapshot string) error {
+	return errFcSnapshot
+}
+
+// allocateNetwork the first /30 network of the subnet no instance uses, the caller holds the lock
+func (f *FirecrackerManager) allocateNetwork() (int, error) {
+	names, err := f.List()
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, name := range names {
+		if m, err := f.load(name); err == nil {
+			used[m.Network] = true
+		}
+	}
+	ones, bits := f.subnet.Mask.Size()
+	for i := 0; i < (1<<(bits-ones))/4; i++ {
+		if !used[i] {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no free network left in %s", f.subnet)
+}
+
+// addresses the host address of the tap and the guest address of the network
+func (f *FirecrackerManager) addresses(network int) (net.IP, net.IP) {
+	base := binary.BigEndian.Uint32(f.subnet.IP.To4()) + uint32(network)*4
+	host, guest := make(net.IP, 4), make(net.IP, 4)
+	binary.BigEndian.PutUint32(host, base+1)
+	binary.BigEndian.PutUint32(guest, base+2)
+	return host, guest
+}
+
+func (f *FirecrackerManager) setupTap(network int) error {
+	tap := tapName(network)
+	if tapExists(tap) {
+		return nil
+	}
+	host, _ := f.addresses(network)
+	for _, args := range [][]string{
+		{"tuntap", "add", "dev", tap, "mode", "tap"},
+		{"addr", "add", host.String() + "/30", "dev", tap},
+		{"link", "set", tap, "up"},
+	} {
+		if err := f.command("ip", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FirecrackerManager) removeTap(network int) error {
+	tap := tapName(network)
+	if !tapExists(tap) {
+		return nil
+	}
+	return f.command("ip", "link", "del", tap)
+}
+
+func (f *FirecrackerManager) load(name string) (*microVM, error) {
+	data, err := os.ReadFile(f.configFile(name))
+	if err != nil {
+		return nil, err
+	}
+	var m microVM
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (f *FirecrackerManager) save(name string, m *microVM) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f.configFile(name), data, 0600)
+}
+
+func (f *FirecrackerManager) dir(name string) string {
+	return filepath.Join(f.home, "firecracker", name)
+}
+
+func (f *FirecrackerManager) socket(name string) string {
+	return filepath.Join(f.dir(name), "api.sock")
+}
+
+func (f *FirecrackerManager) configFile(name string) string {
+	return filepath.Join(f.dir(name), "microvm.json")
+}
+
+func (f *FirecrackerManager) pidFile(name string) string {
+	return filepath.Join(f.dir(name), "firecracker.pid")
+}
+
+func (f *FirecrackerManager) overlayFile(name string) string {
+	return filepath.Join(f.dir(name), "overlay.ext4")
+}
+
+func (f *FirecrackerManager) consoleFile(name string) string {
+	return filepath.Join(f.dir(name), "console.log")
+}
+
+func tapName(network int) string {
+	return fmt.Sprintf("fctap%d", network)
+}
+
+func tapExists(tap string) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/net", tap))
+	return err == nil
+}
+
+// bootArgs the serial console, the static address of the guest and the init that mounts the overlay disk
+func bootArgs(host, guest net.IP, init string) string {
+	return fmt.Sprintf("console=ttyS0 reboot=k panic=1 pci=off ip=%s::%s:255.255.255.252::eth0:off overlay_root=vdb init=%s", guest, host, init)
+}
+
+// guestMac the mac address carries the guest address, as the firecracker guides do
+func guestMac(guest net.IP) string {
+	ip := guest.To4()
+	return fmt.Sprintf("06:00:%02x:%02x:%02x:%02x", ip[0], ip[1], ip[2], ip[3])
+}
+
+// mmdsData the metadata the guest reads from 169.254.169.254, the keys in the layout of the ec2 metadata
+func mmdsData(name string, m *microVM) map[string]interface{} {
+	keys := map[string]interface{}{}
+	for i, key := range m.Keys {
+		keys[strconv.Itoa(i)] = map[string]string{"openssh-key": key}
+	}
+	return map[string]interface{}{
+		"latest": map[string]interface{}{
+			"meta-data": map[string]interface{}{
+				"instance-id":    name,
+				"local-hostname": name,
+				"public-keys":    keys,
+			},
+		},
+	}
+}
+
+// launchFirecracker start the firecracker process serving the api on the socket, the serial console is
+// written to the console file
+func launchFirecracker(binary, socket, console string) (int, error) {
+	out, err := os.OpenFile(console, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(binary, "--api-sock", socket)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err = cmd.Start(); err != nil {
+		_ = out.Close()
+		return 0, err
+	}
+	// reap the process when the microvm exits
+	go func() {
+		_ = cmd.Wait()
+		_ = out.Close()
+	}()
+	return cmd.Process.Pid, nil
+}
+
+func runCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", name, strings.Join(args, " "), err, output)
+	}
+	return nil
+}
+
+func killProcess(pid int) error {
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
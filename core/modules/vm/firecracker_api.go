@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// fcClient the api of a firecracker process, served over its unix socket
+type fcClient struct {
+	http *http.Client
+}
+
+func newFcClient(socket string) *fcClient {
+	return &fcClient{http: &http.Client{
+		Timeout: 10 * time.Second,
+		// a client is made for each call, its connections are not kept
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}}
+}
+
+type fcInstanceInfo struct {
+	Id    string `json:"id"`
+	State string `json:"state"` // Not started, Running, Paused
+}
+
+type fcMachineConfig struct {
+	VcpuCount  uint64 `json:"vcpu_count"`
+	MemSizeMib uint64 `json:"mem_size_mib"`
+}
+
+type fcBootSource struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	BootArgs        string `json:"boot_args"`
+}
+
+type fcDrive struct {
+	DriveId      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+type fcNetworkInterface struct {
+	IfaceId     string `json:"iface_id"`
+	GuestMac    string `json:"guest_mac"`
+	HostDevName string `json:"host_dev_name"`
+}
+
+type fcMmdsConfig struct {
+	Version           string   `json:"version"`
+	NetworkInterfaces []string `json:"network_interfaces"`
+}
+
+type fcAction struct {
+	ActionType string `json:"action_type"` // InstanceStart, SendCtrlAltDel
+}
+
+type fcFault struct {
+	FaultMessage string `json:"fault_message"`
+}
+
+func (c *fcClient) info() (*fcInstanceInfo, error) {
+	var info fcInstanceInfo
+	if err := c.do(http.MethodGet, "/", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *fcClient) put(path string, body interface{}) error {
+	return c.do(http.MethodPut, path, body, nil)
+}
+
+func (c *fcClient) action(actionType string) error {
+	return c.put("/actions", fcAction{ActionType: actionType})
+}
+
+func (c *fcClient) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	// the host is ignored, the requests go to the socket
+	req, err := http.NewRequest(method, "http://localhost"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var fault fcFault
+		_ = json.NewDecoder(resp.Body).Decode(&fault)
+		return fmt.Errorf("firecracker %s %s: %s %s", method, path, resp.Status, fault.FaultMessage)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package vm
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFirecracker serves the firecracker api on the socket of the instance, the microvm "exits" when
+// it is asked to shut down unless ignoreShutdown
+type fakeFirecracker struct {
+	lock           sync.Mutex
+	state          string
+	puts           map[string]json.RawMessage
+	ignoreShutdown bool
+	listener       net.Listener
+}
+
+func startFakeFirecracker(t *testing.T, socket string) *fakeFirecracker {
+	listener, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	fake := &fakeFirecracker{state: "Not started", puts: map[string]json.RawMessage{}, listener: listener}
+	server := &http.Server{Handler: fake}
+	server.SetKeepAlivesEnabled(false)
+	go func() { _ = server.Serve(listener) }()
+	return fake
+}
+
+func (f *fakeFirecracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if r.Method == http.MethodGet && r.URL.Path == "/" {
+		_ = json.NewEncoder(w).Encode(fcInstanceInfo{Id: "anonymous-instance", State: f.state})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"fault_message":"unsupported"}`))
+		return
+	}
+	f.puts[r.URL.Path] = body
+	if r.URL.Path == "/actions" {
+		var action fcAction
+		_ = json.Unmarshal(body, &action)
+		switch action.ActionType {
+		case "InstanceStart":
+			f.state = "Running"
+		case "SendCtrlAltDel":
+			if !f.ignoreShutdown {
+				_ = f.listener.Close()
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeFirecracker) put(path string, v interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_ = json.Unmarshal(f.puts[path], v)
+}
+
+func newTestFirecracker(t *testing.T) (*FirecrackerManager, map[string]*fakeFirecracker, *[]string) {
+	home := t.TempDir()
+	manager, err := newFirecrackerManager(home, "firecracker", "/boot/vmlinux", "", nil)
+	assert.NoError(t, err)
+	fakes := map[string]*fakeFirecracker{}
+	var commands []string
+	manager.launch = func(binary, socket, console string) (int, error) {
+		fakes[filepath.Base(filepath.Dir(socket))] = startFakeFirecracker(t, socket)
+		return 4242, nil
+	}
+	manager.command = func(name string, args ...string) error {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil
+	}
+	manager.kill = func(pid int) error {
+		for _, fake := range fakes {
+			_ = fake.listener.Close()
+		}
+		return nil
+	}
+
+	// the base image is in place, nothing is downloaded
+	template := Template{Cpu: 2, Memory: 1, Disk: 1, Image: "https://example.com/ubuntu-20.04.ext4.tar.gz"}
+	image := manager.images.Path(baseImageName(&template))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(image), 0700))
+	assert.NoError(t, os.WriteFile(image, []byte("rootfs"), 0600))
+	assert.NoError(t, manager.SetTemplate(template))
+	t.Cleanup(func() {
+		for _, fake := range fakes {
+			_ = fake.listener.Close()
+		}
+	})
+	return manager, fakes, &commands
+}
+
+func TestFirecrackerLifecycle(t *testing.T) {
+	manager, fakes, commands := newTestFirecracker(t)
+	name := InstanceName(3)
+
+	_, err := manager.CreateAndStartAndInjectionPublicKey(name, "ssh-ed25519 AAAA tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"mkfs.ext4 -q -F " + manager.overlayFile(name),
+		"ip tuntap add dev fctap0 mode tap",
+		"ip addr add 172.30.0.1/30 dev fctap0",
+		"ip link set fctap0 up",
+	}, *commands)
+
+	fake := fakes[name]
+	var machine fcMachineConfig
+	fake.put("/machine-config", &machine)
+	assert.Equal(t, fcMachineConfig{VcpuCount: 2, MemSizeMib: 1024}, machine)
+	var rootfs, overlay fcDrive
+	fake.put("/drives/rootfs", &rootfs)
+	fake.put("/drives/overlay", &overlay)
+	assert.True(t, rootfs.IsRootDevice && rootfs.IsReadOnly)
+	assert.Equal(t, manager.images.Path(baseImageName(&Template{Image: "https://example.com/ubuntu-20.04.ext4.tar.gz"})), rootfs.PathOnHost)
+	assert.Equal(t, manager.overlayFile(name), overlay.PathOnHost)
+	assert.False(t, overlay.IsReadOnly)
+	var nic fcNetworkInterface
+	fake.put("/network-interfaces/eth0", &nic)
+	assert.Equal(t, fcNetworkInterface{IfaceId: "eth0", GuestMac: "06:00:ac:1e:00:02", HostDevName: "fctap0"}, nic)
+	var boot fcBootSource
+	fake.put("/boot-source", &boot)
+	assert.Contains(t, boot.BootArgs, "ip=172.30.0.2::172.30.0.1:255.255.255.252::eth0:off")
+	assert.Contains(t, boot.BootArgs, "init=/sbin/overlay-init")
+	var mmds map[string]map[string]map[string]interface{}
+	fake.put("/mmds", &mmds)
+	assert.Equal(t, map[string]interface{}{"0": map[string]interface{}{"openssh-key": "ssh-ed25519 AAAA tenant"}},
+		mmds["latest"]["meta-data"]["public-keys"])
+
+	status, err := manager.Status(name)
+	assert.NoError(t, err)
+	assert.True(t, status.IsRunning())
+	ip, err := manager.GetIp(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.30.0.2", ip)
+	assert.Equal(t, 22, manager.GetAccessPort(name))
+	names, err := manager.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{name}, names)
+
+	// the keys of the running microvm are replaced in the MMDS
+	assert.NoError(t, manager.SetAuthorizedKeys(name, []string{"ssh-ed25519 BBBB other"}))
+	fake.put("/mmds", &mmds)
+	assert.Equal(t, map[string]interface{}{"0": map[string]interface{}{"openssh-key": "ssh-ed25519 BBBB other"}},
+		mmds["latest"]["meta-data"]["public-keys"])
+
+	assert.NoError(t, manager.Stop(name))
+	status, err = manager.Status(name)
+	assert.NoError(t, err)
+	assert.False(t, status.IsRunning())
+
+	assert.NoError(t, manager.Destroy(name))
+	residue, err := manager.Residue(name)
+	assert.NoError(t, err)
+	assert.Empty(t, residue)
+	_, err = manager.Status(name)
+	assert.Error(t, err)
+}
+
+func TestFirecrackerTemplate(t *testing.T) {
+	manager, _, _ := newTestFirecracker(t)
+	image := "https://example.com/ubuntu-20.04.ext4.tar.gz"
+	// the microvms can not create the tenant user or mount a data volume
+	assert.ErrorIs(t, manager.SetTemplate(Template{Image: image, User: TenantUser{Name: "tenant"}}), errFcUser)
+	assert.ErrorIs(t, manager.SetInstanceTemplate(InstanceName(3), Template{Image: image, DataPath: "/data"}), errFcData)
+	assert.NoError(t, manager.SetTemplate(Template{Image: image, User: TenantUser{Name: "root"}}))
+}
+
+func TestFirecrackerNetworks(t *testing.T) {
+	manager, _, _ := newTestFirecracker(t)
+
+	for _, orderNo := range []uint64{1, 2, 3} {
+		_, err := manager.Create(InstanceName(orderNo))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, manager.Destroy(InstanceName(2)))
+	// the network of a destroyed instance is taken again
+	_, err := manager.Create(InstanceName(4))
+	assert.NoError(t, err)
+
+	for orderNo, want := range map[uint64]string{1: "172.30.0.2", 3: "172.30.0.10", 4: "172.30.0.6"} {
+		ip, err := manager.GetIp(InstanceName(orderNo))
+		assert.NoError(t, err)
+		assert.Equal(t, want, ip)
+	}
+}
+
+func TestFirecrackerStopTimeout(t *testing.T) {
+	manager, fakes, _ := newTestFirecracker(t)
+	fcStopTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { fcStopTimeout = 30 * time.Second })
+	name := InstanceName(5)
+
+	_, err := manager.CreateAndStart(name)
+	assert.NoError(t, err)
+	fakes[name].lock.Lock()
+	fakes[name].ignoreShutdown = true
+	fakes[name].lock.Unlock()
+
+	// the guest ignores the shutdown, the process is killed
+	assert.NoError(t, manager.Stop(name))
+	_, err = os.Stat(manager.pidFile(name))
+	assert.True(t, os.IsNotExist(err))
+	status, err := manager.Status(name)
+	assert.NoError(t, err)
+	assert.False(t, status.IsRunning())
+}
+
+func TestFirecrackerSubnet(t *testing.T) {
+	_, err := newFirecrackerManager(t.TempDir(), "firecracker", "/boot/vmlinux", "10.0.0.0/31", nil)
+	assert.Error(t, err)
+	manager, err := newFirecrackerManager(t.TempDir(), "firecracker", "/boot/vmlinux", "10.8.0.0/24", nil)
+	assert.NoError(t, err)
+	host, guest := manager.addresses(2)
+	assert.Equal(t, "10.8.0.9", host.String())
+	assert.Equal(t, "10.8.0.10", guest.String())
+}
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/archive"
+	"os"
+	"path/filepath"
+)
+
+// extractImage extract the image archive into dst, the file named image, or the only file of the archive, is the image
+func extractImage(file, image, dst string) error {
+	staging := dst + ".extract"
+	defer os.RemoveAll(staging)
+	files, err := archive.Extract(file, staging, archive.Options{})
+	if err != nil {
+		return err
+	}
+	var found string
+	for _, f := range files {
+		if filepath.Base(f) == image {
+			found = f
+			break
+		}
+	}
+	if found == "" && len(files) == 1 {
+		found = files[0]
+	}
+	if found == "" {
+		return fmt.Errorf("image %s not found in %s", image, filepath.Base(file))
+	}
+	return os.Rename(found, dst)
+}
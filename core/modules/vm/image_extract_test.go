@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTarGz(t *testing.T, file string, names ...string) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, name := range names {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 5, Typeflag: tar.TypeReg}))
+		_, _ = tw.Write([]byte("qcow2"))
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gw.Close())
+	assert.NoError(t, os.WriteFile(file, buf.Bytes(), 0644))
+}
+
+func TestExtractImage(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "0123-ubuntu.qcow2.tar.gz")
+	dst := filepath.Join(dir, "ubuntu.qcow2")
+
+	writeTarGz(t, file, "image/README", "image/ubuntu.qcow2")
+	assert.NoError(t, extractImage(file, "ubuntu.qcow2", dst))
+	_, err := os.Stat(dst)
+	assert.NoError(t, err)
+	_, err = os.Stat(dst + ".extract")
+	assert.True(t, os.IsNotExist(err))
+
+	// the only file of the archive is the image, whatever its name
+	assert.NoError(t, os.Remove(dst))
+	writeTarGz(t, file, "disk.img")
+	assert.NoError(t, extractImage(file, "ubuntu.qcow2", dst))
+
+	assert.NoError(t, os.Remove(dst))
+	writeTarGz(t, file, "a.img", "b.img")
+	assert.Error(t, extractImage(file, "ubuntu.qcow2", dst))
+}
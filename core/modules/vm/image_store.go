@@ -0,0 +1,174 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/hamster-shared/hamster-provider/core/modules/archive"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const imageRefsFile = "refs.json"
+
+// baseImageName the name of the base image of the template in the store, prefixed with a hash of the url and the
+// checksum, so the images of the same file name do not share a base image and a changed checksum is fetched again
+func baseImageName(t *Template) string {
+	sum := sha256.Sum256([]byte(t.Image + "#" + strings.ToLower(t.Sha256)))
+	return hex.EncodeToString(sum[:])[:12] + "-" + imageFileName(t)
+}
+
+// imageFileName the file name of the image of the template without the archive extension
+func imageFileName(t *Template) string {
+	return archive.TrimExtension(path.Base(t.Image))
+}
+
+// imageStore the base images shared by the overlay disks of the orders, every overlay holds a reference
+// to its base image, and the images no order references are removed by Collect
+type imageStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newImageStore(dir string) *imageStore {
+	return &imageStore{dir: dir}
+}
+
+// Path the path of the base image in the store
+func (s *imageStore) Path(image string) string {
+	return filepath.Join(s.dir, image)
+}
+
+// Import place the downloaded file in the store as the base image, the file is hard linked when possible,
+// so removing it from the download cache does not affect the disks backed by the image
+func (s *imageStore) Import(file, image string) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Link(file, s.Path(image)); err == nil {
+		return nil
+	}
+	tmp := s.Path(image) + ".tmp"
+	if _, err := utils.Copy(file, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.Path(image))
+}
+
+// Acquire record that the instance uses the base image
+func (s *imageStore) Acquire(image, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, n := range refs[image] {
+		if n == name {
+			return nil
+		}
+	}
+	refs[image] = append(refs[image], name)
+	return s.save(refs)
+}
+
+// Release drop the references of the instance, return the images no longer used by any order
+func (s *imageStore) Release(name string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var unused []string
+	for image, names := range refs {
+		var res []string
+		for _, n := range names {
+			if n != name {
+				res = append(res, n)
+			}
+		}
+		if len(res) == len(names) {
+			continue
+		}
+		if len(res) == 0 {
+			delete(refs, image)
+			unused = append(unused, image)
+		} else {
+			refs[image] = res
+		}
+	}
+	return unused, s.save(refs)
+}
+
+// Refs the instances using the base image
+func (s *imageStore) Refs(image string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return refs[image], nil
+}
+
+// Collect remove the files of the store no order references, the files of keep are the images of the
+// current template and stay for the next orders
+func (s *imageStore) Collect(keep ...string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var removed []string
+	for _, entry := range entries {
+		file := entry.Name()
+		if file == imageRefsFile || len(refs[file]) > 0 || utils.Contains(keep, file) {
+			continue
+		}
+		if err = os.RemoveAll(s.Path(file)); err != nil {
+			return removed, err
+		}
+		log.Infof("base image %s is not used by any order, removed", file)
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+func (s *imageStore) load() (map[string][]string, error) {
+	refs := map[string][]string{}
+	data, err := os.ReadFile(s.Path(imageRefsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return refs, json.Unmarshal(data, &refs)
+}
+
+func (s *imageStore) save(refs map[string][]string) error {
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path(imageRefsFile), data, 0600)
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestImageStore(t *testing.T) {
+	store := newImageStore(t.TempDir())
+	for _, image := range []string{"old.qcow2", "new.qcow2", "new.qcow2.tar.gz"} {
+		assert.NoError(t, os.WriteFile(store.Path(image), []byte(image), 0600))
+	}
+
+	assert.NoError(t, store.Acquire("old.qcow2", "order_1"))
+	assert.NoError(t, store.Acquire("old.qcow2", "order_2"))
+	assert.NoError(t, store.Acquire("old.qcow2", "order_2"))
+	refs, err := store.Refs("old.qcow2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"order_1", "order_2"}, refs)
+
+	removed, err := store.Collect("new.qcow2.tar.gz", "new.qcow2")
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+
+	unused, err := store.Release("order_1")
+	assert.NoError(t, err)
+	assert.Empty(t, unused)
+	unused, err = store.Release("order_2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.qcow2"}, unused)
+
+	removed, err = store.Collect("new.qcow2.tar.gz", "new.qcow2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.qcow2"}, removed)
+	_, err = os.Stat(store.Path("new.qcow2"))
+	assert.NoError(t, err)
+	_, err = os.Stat(store.Path(imageRefsFile))
+	assert.NoError(t, err)
+}
+
+func TestBaseImageName(t *testing.T) {
+	a := &Template{Image: "https://a.example.com/ubuntu.qcow2.tar.gz", Sha256: "ab"}
+	b := &Template{Image: "https://b.example.com/ubuntu.qcow2.tar.gz", Sha256: "ab"}
+	assert.True(t, strings.HasSuffix(baseImageName(a), "-ubuntu.qcow2"))
+	// the same file name of another url is another base image
+	assert.NotEqual(t, baseImageName(a), baseImageName(b))
+	// a changed checksum is fetched again
+	assert.NotEqual(t, baseImageName(a), baseImageName(&Template{Image: a.Image, Sha256: "cd"}))
+	assert.Equal(t, baseImageName(a), baseImageName(&Template{Image: a.Image, Sha256: "AB"}))
+}
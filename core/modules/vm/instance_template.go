@@ -0,0 +1,55 @@
+package vm
+
+import "sync"
+
+// instanceTemplates the template each instance is created from, the instances without a template,
+// like those created before the daemon restarted, use the default template
+type instanceTemplates struct {
+	mu    sync.RWMutex
+	def   *Template
+	items map[string]*Template
+}
+
+func (s *instanceTemplates) setDefault(t Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.def = &t
+}
+
+func (s *instanceTemplates) set(name string, t Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		s.items = map[string]*Template{}
+	}
+	s.items[name] = &t
+}
+
+func (s *instanceTemplates) get(name string) *Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if t, ok := s.items[name]; ok {
+		return t
+	}
+	return s.def
+}
+
+func (s *instanceTemplates) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, name)
+}
+
+// all the default template and the templates of the instances
+func (s *instanceTemplates) all() []*Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []*Template
+	if s.def != nil {
+		res = append(res, s.def)
+	}
+	for _, t := range s.items {
+		res = append(res, t)
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NewPodmanManager the container manager over the docker compatible api of podman, the containers run without
+// a root daemon. socket is the api socket or its url, the socket of the podman service of the user when empty
+func NewPodmanManager(t Template, imageCache *cache.ImageCache, socket string) (*DockerManager, error) {
+	if socket == "" {
+		socket = PodmanSocket()
+	}
+	host := podmanHost(socket)
+	if path := strings.TrimPrefix(host, "unix://"); path != host {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("podman api socket not found, start it with `systemctl --user enable --now podman.socket`: %w", err)
+		}
+	}
+	// podman does not serve the old api version the docker client is pinned to
+	cli, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return newContainerManager(cli, t, imageCache)
+}
+
+// PodmanSocket the api socket of the podman service of the current user
+func PodmanSocket() string {
+	return podmanSocket(os.Getuid(), os.Getenv("XDG_RUNTIME_DIR"))
+}
+
+func podmanSocket(uid int, runtimeDir string) string {
+	if uid == 0 {
+		return "/run/podman/podman.sock"
+	}
+	if runtimeDir == "" {
+		runtimeDir = fmt.Sprintf("/run/user/%d", uid)
+	}
+	return filepath.Join(runtimeDir, "podman", "podman.sock")
+}
+
+func podmanHost(socket string) string {
+	if strings.Contains(socket, "://") {
+		return socket
+	}
+	return "unix://" + socket
+}
@@ -0,0 +1,23 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestPodmanSocket(t *testing.T) {
+	assert.Equal(t, "/run/podman/podman.sock", podmanSocket(0, "/run/user/0"))
+	assert.Equal(t, "/run/user/1000/podman/podman.sock", podmanSocket(1000, ""))
+	assert.Equal(t, "/tmp/xdg/podman/podman.sock", podmanSocket(1000, "/tmp/xdg"))
+}
+
+func TestPodmanHost(t *testing.T) {
+	assert.Equal(t, "unix:///run/podman/podman.sock", podmanHost("/run/podman/podman.sock"))
+	assert.Equal(t, "tcp://127.0.0.1:8888", podmanHost("tcp://127.0.0.1:8888"))
+}
+
+func TestNewPodmanManagerNoSocket(t *testing.T) {
+	_, err := NewPodmanManager(Template{}, nil, filepath.Join(t.TempDir(), "podman.sock"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/opencontainers/go-digest"
+	"strings"
+)
+
+// dockerHub the registry of the images without a domain
+const dockerHub = "docker.io"
+
+// RegistryAuth the credentials of a private docker registry
+type RegistryAuth struct {
+	Server        string // registry host, like registry.example.com:5000
+	Username      string
+	Password      string
+	IdentityToken string // used instead of the password when set
+}
+
+// PinImage pin the image to the sha256 digest, like ubuntu@sha256:..., the image is returned unchanged
+// when the digest is empty
+func PinImage(image, sha256 string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	if sha256 == "" {
+		return image, nil
+	}
+	d, err := digest.Parse("sha256:" + strings.TrimPrefix(sha256, "sha256:"))
+	if err != nil {
+		return "", fmt.Errorf("invalid digest %s: %w", sha256, err)
+	}
+	if digested, ok := named.(reference.Digested); ok && digested.Digest() != d {
+		return "", fmt.Errorf("image %s is pinned to another digest than %s", image, d)
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), d)
+	if err != nil {
+		return "", err
+	}
+	return reference.FamiliarString(pinned), nil
+}
+
+// registryServer the normalized registry host, docker hub is docker.io
+func registryServer(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+	switch server {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHub
+	}
+	return server
+}
+
+// findRegistryAuth the credentials of the registry the image is pulled from
+func findRegistryAuth(auths []RegistryAuth, image string) (*RegistryAuth, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	server := registryServer(reference.Domain(named))
+	for i, auth := range auths {
+		if registryServer(auth.Server) == server {
+			return &auths[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// encodeRegistryAuth the X-Registry-Auth header of the docker api
+func encodeRegistryAuth(auth *RegistryAuth) (string, error) {
+	if auth == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(types.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		IdentityToken: auth.IdentityToken,
+		ServerAddress: auth.Server,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,65 @@
+package vm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testDigest = "6a1bc9e1a3b8e6b8e5c8e0e9c0d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c9d8"
+
+func TestPinImage(t *testing.T) {
+	image, err := PinImage("ubuntu:20.04", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu:20.04", image)
+
+	image, err = PinImage("ubuntu:20.04", testDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, "ubuntu@sha256:"+testDigest, image)
+
+	image, err = PinImage("registry.example.com:5000/team/app@sha256:"+testDigest, testDigest)
+	assert.NoError(t, err)
+	assert.Equal(t, "registry.example.com:5000/team/app@sha256:"+testDigest, image)
+
+	_, err = PinImage("ubuntu@sha256:"+testDigest, strings.Repeat("0", 64))
+	assert.Error(t, err)
+	_, err = PinImage("ubuntu", "abc")
+	assert.Error(t, err)
+	_, err = PinImage("Ubuntu", "")
+	assert.Error(t, err)
+}
+
+func TestFindRegistryAuth(t *testing.T) {
+	auths := []RegistryAuth{
+		{Server: "https://index.docker.io/v1/", Username: "hub"},
+		{Server: "registry.example.com:5000", Username: "private"},
+	}
+	auth, err := findRegistryAuth(auths, "ubuntu:20.04")
+	assert.NoError(t, err)
+	assert.Equal(t, "hub", auth.Username)
+
+	auth, err = findRegistryAuth(auths, "registry.example.com:5000/team/app:1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "private", auth.Username)
+
+	auth, err = findRegistryAuth(auths, "ghcr.io/team/app")
+	assert.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestEncodeRegistryAuth(t *testing.T) {
+	encoded, err := encodeRegistryAuth(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, encoded)
+
+	encoded, err = encodeRegistryAuth(&RegistryAuth{Server: "registry.example.com", Username: "user", Password: "secret"})
+	assert.NoError(t, err)
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	assert.NoError(t, err)
+	var config types.AuthConfig
+	assert.NoError(t, json.Unmarshal(data, &config))
+	assert.Equal(t, types.AuthConfig{Username: "user", Password: "secret", ServerAddress: "registry.example.com"}, config)
+}
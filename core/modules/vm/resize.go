@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+)
+
+// hostReservedMemory the memory in GB left to the host and the provider
+const hostReservedMemory = 1
+
+var (
+	// ErrShrinkDisk the disks of the instances only grow, the file systems in them are not shrunk
+	ErrShrinkDisk = errors.New("the disk can not be shrunk")
+	// ErrInsufficientCapacity the host can not give the instance the requested size
+	ErrInsufficientCapacity = errors.New("insufficient host capacity")
+	// ErrTemplateLimit the requested size is beyond the maxCpu/maxMem of the template of the instance
+	ErrTemplateLimit = errors.New("beyond the template limit")
+)
+
+// Size the cpus, the memory in GB and the disk in GB of an instance
+type Size struct {
+	Cpu    uint64 `json:"cpu"`
+	Memory uint64 `json:"memory"`
+	Disk   uint64 `json:"disk"`
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%d cpu, %d GB memory, %d GB disk", s.Cpu, s.Memory, s.Disk)
+}
+
+// checkResize the requested size is complete, does not shrink the disk and stays in the limits of the template
+func checkResize(t Template, current, size Size) error {
+	if size.Cpu == 0 || size.Memory == 0 {
+		return errors.New("cpu and memory must be greater than 0")
+	}
+	if size.Disk < current.Disk {
+		return fmt.Errorf("%w: %d GB is smaller than %d GB", ErrShrinkDisk, size.Disk, current.Disk)
+	}
+	if t.MaxCpu > 0 && size.Cpu > t.MaxCpu {
+		return fmt.Errorf("%w: %d cpu requested, the template %s allows %d", ErrTemplateLimit, size.Cpu, t.Name, t.MaxCpu)
+	}
+	if t.MaxMemory > 0 && size.Memory > t.MaxMemory {
+		return fmt.Errorf("%w: %d GB memory requested, the template %s allows %d GB", ErrTemplateLimit, size.Memory, t.Name, t.MaxMemory)
+	}
+	return nil
+}
+
+// headroom the maximum the instance can grow to, capped at the size of the host
+func headroom(max, host uint64) uint64 {
+	if max > host {
+		return host
+	}
+	return max
+}
+
+// CheckCapacity whether the host can grow the instance from the current to the requested size, the growth
+// of the memory and the disk must be available on the host
+func CheckCapacity(host *utils.HostResources, current, size Size) error {
+	if size.Cpu > host.Cpu {
+		return fmt.Errorf("%w: %d cpu requested, the host has %d", ErrInsufficientCapacity, size.Cpu, host.Cpu)
+	}
+	if total := host.Memory >> 30; size.Memory+hostReservedMemory > total {
+		return fmt.Errorf("%w: %d GB memory requested, the host has %d GB", ErrInsufficientCapacity, size.Memory, total)
+	}
+	if size.Memory > current.Memory {
+		if grow, available := size.Memory-current.Memory, host.AvailableMemory>>30; grow > available {
+			return fmt.Errorf("%w: %d GB more memory requested, %d GB is available", ErrInsufficientCapacity, grow, available)
+		}
+	}
+	if size.Disk > current.Disk {
+		if grow, free := size.Disk-current.Disk, host.FreeDisk>>30; grow > free {
+			return fmt.Errorf("%w: %d GB more disk requested, %d GB is free", ErrInsufficientCapacity, grow, free)
+		}
+	}
+	return nil
+}
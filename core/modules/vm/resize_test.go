@@ -0,0 +1,43 @@
+package vm
+
+import (
+	"github.com/hamster-shared/hamster-provider/core/modules/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckResize(t *testing.T) {
+	current := Size{Cpu: 2, Memory: 4, Disk: 50}
+	assert.NoError(t, checkResize(Template{}, current, Size{Cpu: 1, Memory: 2, Disk: 50}))
+	assert.NoError(t, checkResize(Template{}, current, Size{Cpu: 4, Memory: 8, Disk: 100}))
+	assert.ErrorIs(t, checkResize(Template{}, current, Size{Cpu: 4, Memory: 8, Disk: 40}), ErrShrinkDisk)
+	assert.Error(t, checkResize(Template{}, current, Size{Cpu: 0, Memory: 8, Disk: 50}))
+
+	limited := Template{Name: "small", MaxCpu: 4, MaxMemory: 8}
+	assert.NoError(t, checkResize(limited, current, Size{Cpu: 4, Memory: 8, Disk: 50}))
+	assert.ErrorIs(t, checkResize(limited, current, Size{Cpu: 6, Memory: 8, Disk: 50}), ErrTemplateLimit)
+	assert.ErrorIs(t, checkResize(limited, current, Size{Cpu: 4, Memory: 16, Disk: 50}), ErrTemplateLimit)
+}
+
+func TestHeadroom(t *testing.T) {
+	assert.Equal(t, uint64(4), headroom(4, 8))
+	assert.Equal(t, uint64(8), headroom(16, 8))
+}
+
+func TestCheckCapacity(t *testing.T) {
+	host := &utils.HostResources{Cpu: 8, Memory: 16 << 30, AvailableMemory: 6 << 30, FreeDisk: 100 << 30}
+	current := Size{Cpu: 2, Memory: 4, Disk: 50}
+
+	assert.NoError(t, CheckCapacity(host, current, Size{Cpu: 8, Memory: 10, Disk: 150}))
+	// shrinking needs nothing from the host
+	assert.NoError(t, CheckCapacity(host, current, Size{Cpu: 1, Memory: 2, Disk: 50}))
+
+	for _, size := range []Size{
+		{Cpu: 9, Memory: 4, Disk: 50},
+		{Cpu: 2, Memory: 16, Disk: 50},
+		{Cpu: 2, Memory: 11, Disk: 50},
+		{Cpu: 2, Memory: 4, Disk: 151},
+	} {
+		assert.ErrorIs(t, CheckCapacity(host, current, size), ErrInsufficientCapacity, size.String())
+	}
+}
@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// securityOpt the seccomp and apparmor options of the container of the template, the seccomp profile is
+// sent to the docker daemon as its content, like the docker cli does
+func securityOpt(t *Template) ([]string, error) {
+	var opts []string
+	switch t.Seccomp {
+	case "":
+	case "unconfined":
+		opts = append(opts, "seccomp=unconfined")
+	default:
+		data, err := os.ReadFile(t.Seccomp)
+		if err != nil {
+			return nil, fmt.Errorf("read seccomp profile: %w", err)
+		}
+		var profile bytes.Buffer
+		if err = json.Compact(&profile, data); err != nil {
+			return nil, fmt.Errorf("invalid seccomp profile %s: %w", t.Seccomp, err)
+		}
+		opts = append(opts, "seccomp="+profile.String())
+	}
+	if t.AppArmor != "" {
+		opts = append(opts, "apparmor="+t.AppArmor)
+	}
+	return opts, nil
+}
@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurityOpt(t *testing.T) {
+	opts, err := securityOpt(&Template{})
+	assert.NoError(t, err)
+	assert.Empty(t, opts)
+
+	profile := filepath.Join(t.TempDir(), "seccomp.json")
+	assert.NoError(t, os.WriteFile(profile, []byte("{\n  \"defaultAction\": \"SCMP_ACT_ERRNO\"\n}\n"), 0600))
+	opts, err = securityOpt(&Template{Seccomp: profile, AppArmor: "docker-default"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "apparmor=docker-default"}, opts)
+
+	opts, err = securityOpt(&Template{Seccomp: "unconfined"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"seccomp=unconfined"}, opts)
+
+	assert.NoError(t, os.WriteFile(profile, []byte("not json"), 0600))
+	_, err = securityOpt(&Template{Seccomp: profile})
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"sort"
+	"strconv"
+)
+
+// ServiceAddress the address the port of the container is reached at from the host, the published
+// host port when the port is mapped, the address of the container in its networks otherwise
+func (d *DockerManager) ServiceAddress(name string, port int) (string, int, error) {
+	inspect, err := d.cli.ContainerInspect(d.ctx, name)
+	if err != nil {
+		return "", 0, err
+	}
+	return containerServiceAddress(inspect, port)
+}
+
+func containerServiceAddress(inspect types.ContainerJSON, port int) (string, int, error) {
+	if inspect.NetworkSettings == nil {
+		return "", 0, fmt.Errorf("container %s has no network", inspect.Name)
+	}
+	containerPort, err := nat.NewPort("tcp", strconv.Itoa(port))
+	if err != nil {
+		return "", 0, err
+	}
+	for _, binding := range inspect.NetworkSettings.Ports[containerPort] {
+		if hostPort, err := strconv.Atoi(binding.HostPort); err == nil && hostPort > 0 {
+			return "127.0.0.1", hostPort, nil
+		}
+	}
+	if ip := inspect.NetworkSettings.IPAddress; ip != "" {
+		return ip, port, nil
+	}
+	// the container of an order with its own networks is not in the default bridge
+	names := make([]string, 0, len(inspect.NetworkSettings.Networks))
+	for n := range inspect.NetworkSettings.Networks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if settings := inspect.NetworkSettings.Networks[n]; settings != nil && settings.IPAddress != "" {
+			return settings.IPAddress, port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("container %s has no address, is it running", inspect.Name)
+}
@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestContainerServiceAddress(t *testing.T) {
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{Name: "/order_1"},
+		NetworkSettings: &types.NetworkSettings{
+			NetworkSettingsBase: types.NetworkSettingsBase{Ports: nat.PortMap{
+				"22/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "31022"}},
+			}},
+			Networks: map[string]*network.EndpointSettings{
+				"order_1-backend": {IPAddress: "172.20.0.2"},
+				"order_1-app":     {IPAddress: "172.21.0.2"},
+			},
+		},
+	}
+
+	// the published port is reached on the host
+	ip, port, err := containerServiceAddress(inspect, 22)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip)
+	assert.Equal(t, 31022, port)
+
+	ip, port, err = containerServiceAddress(inspect, 8080)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.21.0.2", ip)
+	assert.Equal(t, 8080, port)
+
+	inspect.NetworkSettings.DefaultNetworkSettings.IPAddress = "172.17.0.5"
+	ip, _, err = containerServiceAddress(inspect, 8080)
+	assert.NoError(t, err)
+	assert.Equal(t, "172.17.0.5", ip)
+
+	inspect.NetworkSettings.DefaultNetworkSettings.IPAddress = ""
+	inspect.NetworkSettings.Networks = nil
+	_, _, err = containerServiceAddress(inspect, 8080)
+	assert.Error(t, err)
+}
@@ -0,0 +1,21 @@
+package vm
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot a saved state of an instance
+type Snapshot struct {
+	Name    string    `json:"name"`  // generated from the creation time, like 20220105093000
+	Label   string    `json:"label"` // given by the tenant
+	Created time.Time `json:"created"`
+	Size    int64     `json:"size"` // bytes, 0 when unknown
+}
+
+// newSnapshotName the name of a new snapshot
+func newSnapshotName() string {
+	return time.Now().UTC().Format("20060102150405")
+}
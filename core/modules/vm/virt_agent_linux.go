@@ -0,0 +1,139 @@
+//go:build libvirt
+
+package vm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	libvirt "github.com/libvirt/libvirt-go"
+	"time"
+)
+
+// guest agent protocol, the qemu-guest-agent must be installed in the image
+
+type agentRequest struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type agentFileRead struct {
+	Count  int    `json:"count"`
+	BufB64 string `json:"buf-b64"`
+	Eof    bool   `json:"eof"`
+}
+
+type agentExecStatus struct {
+	Exited   bool `json:"exited"`
+	ExitCode int  `json:"exitcode"`
+}
+
+// agentCommand run the guest agent command and decode its return value into result
+func agentCommand(d *libvirt.Domain, execute string, arguments interface{}, result interface{}) error {
+	cmd, err := json.Marshal(agentRequest{Execute: execute, Arguments: arguments})
+	if err != nil {
+		return err
+	}
+	resp, err := d.QemuAgentCommand(string(cmd), libvirt.DOMAIN_QEMU_AGENT_COMMAND_DEFAULT, 0)
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal([]byte(resp), &struct {
+		Return interface{} `json:"return"`
+	}{Return: result})
+}
+
+// agentExec run the program in the guest and wait for it to exit
+func agentExec(d *libvirt.Domain, path string, args ...string) error {
+	var pid struct {
+		Pid int `json:"pid"`
+	}
+	err := agentCommand(d, "guest-exec", map[string]interface{}{"path": path, "arg": args}, &pid)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 30; i++ {
+		var status agentExecStatus
+		if err = agentCommand(d, "guest-exec-status", map[string]int{"pid": pid.Pid}, &status); err != nil {
+			return err
+		}
+		if status.Exited {
+			if status.ExitCode != 0 {
+				return fmt.Errorf("%s exit with code %d", path, status.ExitCode)
+			}
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("%s does not exit in time", path)
+}
+
+func agentReadFile(d *libvirt.Domain, file string) (string, error) {
+	var handle int
+	err := agentCommand(d, "guest-file-open", map[string]string{"path": file, "mode": "r"}, &handle)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = agentCommand(d, "guest-file-close", map[string]int{"handle": handle}, nil)
+	}()
+	var content []byte
+	for {
+		var read agentFileRead
+		err = agentCommand(d, "guest-file-read", map[string]int{"handle": handle, "count": 65536}, &read)
+		if err != nil {
+			return "", err
+		}
+		data, err := base64.StdEncoding.DecodeString(read.BufB64)
+		if err != nil {
+			return "", err
+		}
+		content = append(content, data...)
+		if read.Eof || read.Count == 0 {
+			return string(content), nil
+		}
+	}
+}
+
+func agentWriteFile(d *libvirt.Domain, file string, content string) error {
+	var handle int
+	err := agentCommand(d, "guest-file-open", map[string]string{"path": file, "mode": "w"}, &handle)
+	if err != nil {
+		return err
+	}
+	err = agentCommand(d, "guest-file-write", map[string]interface{}{
+		"handle":  handle,
+		"buf-b64": base64.StdEncoding.EncodeToString([]byte(content)),
+	}, nil)
+	closeErr := agentCommand(d, "guest-file-close", map[string]int{"handle": handle}, nil)
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// setAuthorizedKeysByAgent edit authorized_keys of the running virtual machine
+func setAuthorizedKeysByAgent(d *libvirt.Domain, user TenantUser, keys []string) error {
+	if err := agentCommand(d, "guest-ping", nil, nil); err != nil {
+		return errors.New("guest agent is not available: " + err.Error())
+	}
+	if err := agentExec(d, "mkdir", "-p", "-m", "0700", user.sshDir()); err != nil {
+		return err
+	}
+	// the file is missing on a fresh image
+	existing, _ := agentReadFile(d, user.authorizedKeysFile())
+	if err := agentWriteFile(d, user.authorizedKeysFile(), mergeAuthorizedKeys(existing, keys)); err != nil {
+		return err
+	}
+	if err := agentExec(d, "chmod", "0600", user.authorizedKeysFile()); err != nil {
+		return err
+	}
+	if user.IsRoot() {
+		return nil
+	}
+	return agentExec(d, "chown", "-R", user.Name+":", user.sshDir())
+}
@@ -1,3 +1,5 @@
+//go:build libvirt
+
 package vm
 
 // dependency
@@ -8,114 +10,205 @@ package vm
 import (
 	"errors"
 	"fmt"
-	"github.com/docker/docker/pkg/fileutils"
+	"github.com/hamster-shared/hamster-provider/core/modules/archive"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	libvirt "github.com/libvirt/libvirt-go"
 	log "github.com/sirupsen/logrus"
+	"io"
 	"os"
-	"os/exec"
-	"path"
 	"strconv"
-	"strings"
 	"time"
 )
 
+// shutdownTimeout the guest is powered off when it has not shut down in time
+const shutdownTimeout = 2 * time.Minute
+
 // VirtManager virtual machine management client
 type VirtManager struct {
-	conn       *libvirt.Connect
-	home       string
-	template   *Template
-	accessPort int
+	conn      *libvirt.Connect
+	home      string
+	templates instanceTemplates
+	images    *imageStore
+	cache     *cache.ImageCache
 }
 
-// NewVirtManager create virtManager
-func NewVirtManager(t Template) (*VirtManager, error) {
+// NewVirtManager create virtManager, the images are downloaded through the cache
+func NewVirtManager(t Template, imageCache *cache.ImageCache) (*VirtManager, error) {
 	conn, err := libvirt.NewConnect("qemu:///system")
 	homedir, err := os.UserHomeDir()
+	if imageCache == nil {
+		imageCache = cache.NewImageCache(homedir+"/.hamster-provider/cache", 0)
+	}
 	manager := &VirtManager{
-		conn: conn,
-		home: homedir + "/.hamster-provider",
+		conn:   conn,
+		home:   homedir + "/.hamster-provider",
+		images: newImageStore(homedir + "/.hamster-provider/images"),
+		cache:  imageCache,
 	}
 	err = manager.SetTemplate(t)
 	return manager, err
 }
 
 func (v *VirtManager) SetTemplate(t Template) error {
-	v.template = &t
-	v.accessPort = 22
-	baeImage := fmt.Sprintf("%s/%s", v.home, path.Base(v.template.Image))
-	if _, err := os.Stat(baeImage); errors.Is(err, os.ErrNotExist) {
-		log.Info("start download template")
-
-		// download file and rename
-		err = utils.Download(v.template.Image, baeImage)
-		if err != nil {
-			log.Error("download template fail")
-			return err
-		}
+	if err := t.User.Validate(); err != nil {
+		return err
+	}
+	t = withAccessPort(t)
+	if err := v.prepareImage(&t); err != nil {
+		return err
+	}
+	v.templates.setDefault(t)
 
+	// the images of the previous templates are removed once their orders are gone
+	return v.collectImages()
+}
+
+func (v *VirtManager) SetInstanceTemplate(name string, t Template) error {
+	if err := t.User.Validate(); err != nil {
+		return err
+	}
+	t = withAccessPort(t)
+	if err := v.prepareImage(&t); err != nil {
+		return err
 	}
+	v.templates.set(name, t)
+	return nil
+}
 
-	if _, err := os.Stat(v.getBaseImagePath()); errors.Is(err, os.ErrNotExist) {
-		if strings.HasSuffix(baeImage, ".tar.gz") {
-			file, err := os.Open(baeImage)
-			if err != nil {
-				log.Error("download template fail")
-				return err
-			}
-			return utils.UnTar(file, v.home)
+// PrepareImage download the base image of the template, an unused base image is removed again when
+// an order is destroyed, while the download stays in the cache
+func (v *VirtManager) PrepareImage(t Template) error {
+	return v.prepareImage(&t)
+}
+
+// prepareImage fetch the image of the template from the cache and extract it as a base image, the base image is
+// named after the url and the checksum of the template, so it was verified against the checksum when it exists
+func (v *VirtManager) prepareImage(t *Template) error {
+	if _, err := os.Stat(v.getBaseImagePath(t)); err == nil {
+		return nil
+	}
+	log.Info("start download template")
+	file, err := v.cache.Fetch(cache.Source{Url: t.Image, Sha256: t.Sha256})
+	if err != nil {
+		log.Error("download template fail")
+		return err
+	}
+	if archive.IsArchive(file) {
+		if err = os.MkdirAll(v.images.Path(""), os.ModePerm); err != nil {
+			return err
 		}
+		return extractImage(file, imageFileName(t), v.getBaseImagePath(t))
 	}
+	return v.images.Import(file, baseImageName(t))
+}
 
-	return nil
+// collectImages remove the base images no order uses, except those of the templates
+func (v *VirtManager) collectImages() error {
+	var keep []string
+	for _, t := range v.templates.all() {
+		keep = append(keep, baseImageName(t))
+	}
+	_, err := v.images.Collect(keep...)
+	return err
 }
 
 func (v *VirtManager) getCopyDiskFile(name string) string {
-	return fmt.Sprintf("%s/orders/%s_%s", v.home, name, v.getBaseImageName())
+	return fmt.Sprintf("%s/orders/%s.qcow2", v.home, name)
 }
 
-func (v *VirtManager) getBaseImageName() string {
-	imageName := path.Base(v.template.Image)
-	if strings.HasSuffix(imageName, ".tar.gz") {
-		imageName = strings.ReplaceAll(imageName, ".tar.gz", "")
-	}
-	return imageName
+// getDataDiskFile the data disk lives as long as the agreement, the virtual machine may be rebuilt on it
+func (v *VirtManager) getDataDiskFile(name string) string {
+	return fmt.Sprintf("%s/orders/%s-data.qcow2", v.home, name)
+}
+
+// instanceFiles the files kept for the virtual machine under orders/, the data disk first
+func (v *VirtManager) instanceFiles(name string) []string {
+	return []string{v.getDataDiskFile(name), v.getCopyDiskFile(name), v.getSeedFile(name), v.getConsoleLogFile(name)}
+}
+
+func (v *VirtManager) getSeedFile(name string) string {
+	return fmt.Sprintf("%s/orders/%s-seed.iso", v.home, name)
+}
+
+func (v *VirtManager) getConsoleLogFile(name string) string {
+	return fmt.Sprintf("%s/orders/%s.console.log", v.home, name)
+}
+
+func (v *VirtManager) getBaseImagePath(t *Template) string {
+	return v.images.Path(baseImageName(t))
 }
 
-func (v *VirtManager) getBaseImagePath() string {
-	return v.home + "/" + v.getBaseImageName()
+// prepareDisk create the disk of the virtual machine as an overlay of the base image
+func (v *VirtManager) prepareDisk(name string, t *Template) error {
+	if _, err := os.Stat(v.getCopyDiskFile(name)); errors.Is(err, os.ErrNotExist) {
+		if err = createOverlay(v.getBaseImagePath(t), v.getCopyDiskFile(name), t.Disk); err != nil {
+			return err
+		}
+	}
+	return v.images.Acquire(baseImageName(t), name)
 }
 
 // Create create
 func (v *VirtManager) Create(name string) (string, error) {
-	log.Info("start the virtual machine")
-	//xml, err := v.newXml()
-	//if err != nil {
-	//	return err
-	//}
-	//log.Info(xml)
-	//domain, err := v.conn.DomainDefineXML(xml)
-	//defer domain.Free()
+	return v.create(name, nil)
+}
 
-	if _, err := os.Stat(v.getCopyDiskFile(name)); errors.Is(err, os.ErrNotExist) {
-		_ = os.MkdirAll(path.Dir(v.getCopyDiskFile(name)), os.ModePerm)
+// create prepare the disk, build the cloud-init seed with the keys and define the domain
+func (v *VirtManager) create(name string, keys []string) (string, error) {
+	log.Info("start the virtual machine")
 
-		fmt.Println("cp", v.getBaseImagePath(), v.getCopyDiskFile(name))
-		cmd := exec.Command("cp", v.getBaseImagePath(), v.getCopyDiskFile(name))
-		err := cmd.Run()
-		if err != nil {
-			fmt.Println("Execute Command failed:" + err.Error())
+	t := v.templates.get(name)
+	if err := v.prepareDisk(name, t); err != nil {
+		return name, err
+	}
+	var dataDisk string
+	if t.DataPath != "" {
+		dataDisk = v.getDataDiskFile(name)
+		if err := createDataDisk(dataDisk, t.DataSize); err != nil {
+			return name, err
 		}
 	}
 
-	fmt.Println("virt-install", "--virt-type", "kvm", "--name", name, "--vcpus", fmt.Sprintf("%d", v.template.Cpu), "--ram", fmt.Sprintf("%d", v.template.Memory<<10), "--disk", fmt.Sprintf("path=%s", v.getCopyDiskFile(name)), "--network", "network=default", "--graphics", "vnc,listen=0.0.0.0", "--noautoconsole", "--boot", "hd")
-	cmd := exec.Command("virt-install", "--virt-type", "kvm", "--name", name, "--vcpus", fmt.Sprintf("%d", v.template.Cpu), "--ram", fmt.Sprintf("%d", v.template.Memory<<10), "--disk", fmt.Sprintf("path=%s", v.getCopyDiskFile(name)), "--network", "network=default", "--graphics", "vnc,listen=0.0.0.0", "--noautoconsole", "--boot", "hd")
+	seed := CloudInitSeed{
+		InstanceId:     name,
+		Hostname:       cloudInitHostname(name),
+		User:           t.User,
+		AuthorizedKeys: keys,
+		Packages:       t.Packages,
+		DataPath:       t.DataPath,
+	}
+	if err := seed.WriteISO(v.getSeedFile(name)); err != nil {
+		return name, err
+	}
 
-	err := cmd.Run()
+	spec := DomainSpec{
+		Name:       name,
+		Vcpus:      uint(t.Cpu),
+		Memory:     t.Memory << 10,
+		CpuSet:     t.CpuSet,
+		Disk:       v.getCopyDiskFile(name),
+		DataDisk:   dataDisk,
+		Seed:       v.getSeedFile(name),
+		ConsoleLog: v.getConsoleLogFile(name),
+	}
+	// the virtual machine can be upgraded up to the maximum of its template without a restart, within the size
+	// of the host
+	if t.MaxCpu > 0 || t.MaxMemory > 0 {
+		if host, err := utils.GetHostResources(v.home); err == nil {
+			spec.MaxVcpus = uint(headroom(t.MaxCpu, host.Cpu))
+			spec.MaxMemory = headroom(t.MaxMemory<<10, host.Memory>>20)
+		}
+	}
+	domainXml, err := spec.XML()
 	if err != nil {
-		fmt.Println("Execute Command failed:" + err.Error())
+		return name, err
 	}
-	return name, err
+	d, err := v.conn.DomainDefineXML(domainXml)
+	if err != nil {
+		return name, err
+	}
+	return name, d.Free()
 }
 
 // Start start the virtual machine
@@ -154,17 +247,18 @@ func (v *VirtManager) CreateAndStart(name string) (string, error) {
 
 func (v *VirtManager) CreateAndStartAndInjectionPublicKey(name, publicKey string) (string, error) {
 
-	// injection public key
-	err := v.InjectionPublicKey(name, publicKey)
-	if err != nil {
-		return "", err
+	// the keys are written by the cloud-init seed on the first boot
+	var keys []string
+	if publicKey != "" {
+		keys = append(keys, publicKey)
 	}
-
-	// create a virtual machine
-	id, err := v.CreateAndStart(name)
+	id, err := v.create(name, keys)
 	if err != nil {
 		return id, err
 	}
+	if err = v.Start(name); err != nil {
+		return id, err
+	}
 
 	// wait for the virtual machine to start successfully
 	for {
@@ -230,51 +324,182 @@ func (v *VirtManager) Shutdown(name string) error {
 	return d.ShutdownFlags(libvirt.DOMAIN_SHUTDOWN_ACPI_POWER_BTN)
 }
 
-// Destroy destroy the virtual machine
+// Destroy destroy and undefine the virtual machine, remove its disks and release its base image, a virtual
+// machine already undefined only has its disks removed so a failed destruction can be run again
 func (v *VirtManager) Destroy(name string) error {
 	d, err := v.conn.LookupDomainByName(name)
+	if lverr, ok := err.(libvirt.Error); ok && lverr.Code == libvirt.ERR_NO_DOMAIN {
+		return v.removeDisk(name)
+	}
 	if err != nil {
 		return err
 	}
-	defer func(dom *libvirt.Domain) {
-		err := dom.Free()
-		if err != nil {
-			log.Error("free libvirt.Domain fail")
+	defer freeDomain(d)
+	if active, _ := d.IsActive(); active {
+		if err = d.Destroy(); err != nil {
+			return err
 		}
-	}(d)
-	return d.Destroy()
+	}
+	// the internal snapshots are removed with the overlay
+	if err = d.UndefineFlags(libvirt.DOMAIN_UNDEFINE_SNAPSHOTS_METADATA); err != nil {
+		return err
+	}
+	return v.removeDisk(name)
 }
 
-// InjectionPublicKey injection publickey (The timing of vm implementation and docker implementation are different)
-func (v *VirtManager) InjectionPublicKey(name, publicKey string) error {
-
-	publicKeyFileName := fmt.Sprintf("/tmp/%s.pub", utils.GetRandomString(10))
+// InstanceSize the vcpus and the memory of the domain and the size of its system disk
+func (v *VirtManager) InstanceSize(name string) (Size, error) {
+	d, err := v.conn.LookupDomainByName(name)
+	if err != nil {
+		return Size{}, err
+	}
+	defer freeDomain(d)
+	info, err := d.GetInfo()
+	if err != nil {
+		return Size{}, err
+	}
+	disk, err := readDiskInfo(v.getCopyDiskFile(name))
+	if err != nil {
+		return Size{}, err
+	}
+	return Size{Cpu: uint64(info.NrVirtCpu), Memory: info.Memory >> 20, Disk: disk.VirtualSize >> 30}, nil
+}
 
-	err := fileutils.CreateIfNotExists(publicKeyFileName, false)
+// Resize plug vcpus, move the balloon and grow the system disk of the running virtual machine, the change is
+// also saved in its definition. The vcpus and the memory can not exceed the maximum the domain was defined with,
+// the partition in the grown disk is extended by cloud-init on the next boot or by the tenant
+func (v *VirtManager) Resize(name string, size Size) error {
+	current, err := v.InstanceSize(name)
 	if err != nil {
 		return err
 	}
-	file, err := os.OpenFile(publicKeyFileName, os.O_WRONLY, os.ModePerm)
-	_, err = file.WriteString(publicKey)
+	t := *v.templates.get(name)
+	if err = checkResize(t, current, size); err != nil {
+		return err
+	}
+	d, err := v.conn.LookupDomainByName(name)
 	if err != nil {
 		return err
 	}
-	err = file.Close()
+	defer freeDomain(d)
+	active, err := d.IsActive()
 	if err != nil {
 		return err
 	}
-	fmt.Println("virt-customize", "-a", v.getCopyDiskFile(name), "--ssh-inject", fmt.Sprintf("root:file:%s", publicKeyFileName))
-	cmd := exec.Command("virt-customize", "-a", v.getCopyDiskFile(name), "--ssh-inject", fmt.Sprintf("root:file:%s", publicKeyFileName))
-	output, err := cmd.CombinedOutput()
+	vcpuFlags, memoryFlags := libvirt.DOMAIN_VCPU_CONFIG, libvirt.DOMAIN_MEM_CONFIG
+	if active {
+		vcpuFlags |= libvirt.DOMAIN_VCPU_LIVE
+		memoryFlags |= libvirt.DOMAIN_MEM_LIVE
+	}
+	if size.Cpu != current.Cpu {
+		if err = d.SetVcpusFlags(uint(size.Cpu), vcpuFlags); err != nil {
+			return err
+		}
+	}
+	if size.Memory != current.Memory {
+		if err = d.SetMemoryFlags(size.Memory<<20, memoryFlags); err != nil {
+			return err
+		}
+	}
+	if size.Disk > current.Disk {
+		if active {
+			err = d.BlockResize("vda", size.Disk<<30, libvirt.DOMAIN_BLOCK_RESIZE_BYTES)
+		} else {
+			err = growDisk(v.getCopyDiskFile(name), size.Disk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	t.Cpu, t.Memory, t.Disk = size.Cpu, size.Memory, size.Disk
+	v.templates.set(name, t)
+	return nil
+}
+
+// Residue the domain and the files of the virtual machine that still exist
+func (v *VirtManager) Residue(name string) ([]string, error) {
+	var residue []string
+	d, err := v.conn.LookupDomainByName(name)
+	if err == nil {
+		freeDomain(d)
+		residue = append(residue, "domain "+name)
+	} else if lverr, ok := err.(libvirt.Error); !ok || lverr.Code != libvirt.ERR_NO_DOMAIN {
+		return nil, err
+	}
+	for _, file := range v.instanceFiles(name) {
+		if _, err = os.Stat(file); err == nil {
+			residue = append(residue, "file "+file)
+		}
+	}
+	return residue, nil
+}
+
+// ExportData write the qcow2 image of the data disk of the stopped virtual machine as a tar stream, a guest still shutting
+// down is given a moment before it is powered off
+func (v *VirtManager) ExportData(name string, w io.Writer) error {
+	d, err := v.conn.LookupDomainByName(name)
 	if err != nil {
-		fmt.Println("Execute Command failed:" + err.Error())
-		fmt.Println("===output===")
-		fmt.Println(string(output))
-		fmt.Println("============")
+		return err
+	}
+	defer freeDomain(d)
+	for deadline := time.Now().Add(shutdownTimeout); ; time.Sleep(time.Second) {
+		active, err := d.IsActive()
+		if err != nil {
+			return err
+		}
+		if !active {
+			break
+		}
+		if time.Now().After(deadline) {
+			if err = d.Destroy(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return tarFile(w, v.getDataDiskFile(name), "data.qcow2")
+}
 
+// DataFormat the export holds the data disk image as it is, the guest file system is not read by the host
+func (v *VirtManager) DataFormat() string {
+	return DataQcow2
+}
+
+// removeDisk remove the overlay, the seed and the console log of the virtual machine and wipe its data disk, the base images
+// no order uses are collected
+func (v *VirtManager) removeDisk(name string) error {
+	if err := wipeFile(v.getDataDiskFile(name)); err != nil {
+		return err
 	}
-	_ = os.Remove(publicKeyFileName)
-	return err
+	// the data disk is wiped above
+	for _, file := range v.instanceFiles(name)[1:] {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if _, err := v.images.Release(name); err != nil {
+		return err
+	}
+	v.templates.remove(name)
+	return v.collectImages()
+}
+
+// SetAuthorizedKeys replace the provider managed keys of the running virtual machine through the guest agent,
+// the keys of a new virtual machine are written by its cloud-init seed
+func (v *VirtManager) SetAuthorizedKeys(name string, keys []string) error {
+	d, err := v.conn.LookupDomainByName(name)
+	if err == nil {
+		defer func(dom *libvirt.Domain) {
+			err := dom.Free()
+			if err != nil {
+				log.Error("free libvirt.Domain fail")
+			}
+		}(d)
+		if active, _ := d.IsActive(); active {
+			return setAuthorizedKeysByAgent(d, v.templates.get(name).User, keys)
+		}
+	}
+	return errors.New("the virtual machine is not running, start it to apply the keys")
 }
 
 // Status View status
@@ -373,7 +598,35 @@ func (v *VirtManager) GetIp(name string) (string, error) {
 
 // GetAccessPort get runtime port
 func (v *VirtManager) GetAccessPort(name string) int {
-	return v.accessPort
+	return v.templates.get(name).AccessPort
+}
+
+// List list the order domains managed by libvirt
+func (v *VirtManager) List() ([]string, error) {
+	domains, err := v.conn.ListAllDomains(0)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, d := range domains {
+		name, err := d.GetName()
+		if err == nil {
+			if _, ok := ParseInstanceName(name); ok {
+				names = append(names, name)
+			}
+		}
+		_ = d.Free()
+	}
+	return names, nil
+}
+
+// ConsoleLog the last tail lines of the serial console log
+func (v *VirtManager) ConsoleLog(name string, tail int) (string, error) {
+	data, err := os.ReadFile(v.getConsoleLogFile(name))
+	if err != nil {
+		return "", err
+	}
+	return utils.TailLines(string(data), tail), nil
 }
 
 func helpUint(x uint) *uint { return &x }
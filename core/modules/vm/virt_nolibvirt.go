@@ -0,0 +1,20 @@
+//go:build (!libvirt && linux) || (!linux && !windows)
+
+package vm
+
+import (
+	"errors"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
+)
+
+// ErrNoLibvirt the binary was built without the libvirt backend, which needs linux, cgo and libvirt-dev
+var ErrNoLibvirt = errors.New("the kvm virtualization is not built in, rebuild with `go build -tags libvirt`")
+
+// VirtManager the libvirt backend left out of the build
+type VirtManager struct {
+	Manager
+}
+
+func NewVirtManager(t Template, imageCache *cache.ImageCache) (*VirtManager, error) {
+	return nil, ErrNoLibvirt
+}
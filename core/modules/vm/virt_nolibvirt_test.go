@@ -0,0 +1,13 @@
+//go:build (!libvirt && linux) || (!linux && !windows)
+
+package vm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewVirtManagerWithoutLibvirt(t *testing.T) {
+	_, err := NewVirtManager(Template{}, nil)
+	assert.ErrorIs(t, err, ErrNoLibvirt)
+}
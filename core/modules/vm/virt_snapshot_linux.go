@@ -0,0 +1,130 @@
+//go:build libvirt
+
+package vm
+
+import (
+	"encoding/xml"
+	libvirt "github.com/libvirt/libvirt-go"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// domainSnapshotXML the libvirt snapshot description, the snapshots are internal snapshots of the qcow2 overlay
+type domainSnapshotXML struct {
+	XMLName      xml.Name `xml:"domainsnapshot"`
+	Name         string   `xml:"name"`
+	Description  string   `xml:"description,omitempty"`
+	CreationTime int64    `xml:"creationTime,omitempty"`
+}
+
+// Snapshot take an internal snapshot of the disk and, when running, the memory of the virtual machine
+func (v *VirtManager) Snapshot(name, label string) (*Snapshot, error) {
+	d, err := v.conn.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer freeDomain(d)
+	data, err := xml.Marshal(domainSnapshotXML{Name: newSnapshotName(), Description: label})
+	if err != nil {
+		return nil, err
+	}
+	s, err := d.CreateSnapshotXML(string(data), 0)
+	if err != nil {
+		return nil, err
+	}
+	defer freeSnapshot(s)
+	return snapshotOf(s)
+}
+
+// ListSnapshots the snapshots of the virtual machine
+func (v *VirtManager) ListSnapshots(name string) ([]Snapshot, error) {
+	d, err := v.conn.LookupDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer freeDomain(d)
+	list, err := d.ListAllSnapshots(0)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for i := range list {
+		snapshot, err := snapshotOf(&list[i])
+		freeSnapshot(&list[i])
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// Restore revert the virtual machine to the snapshot, it runs again if it was running when the snapshot was taken
+func (v *VirtManager) Restore(name, snapshot string) error {
+	d, err := v.conn.LookupDomainByName(name)
+	if err != nil {
+		return err
+	}
+	defer freeDomain(d)
+	s, err := lookupSnapshot(d, snapshot)
+	if err != nil {
+		return err
+	}
+	defer freeSnapshot(s)
+	return s.RevertToSnapshot(0)
+}
+
+// DeleteSnapshot delete the snapshot from the overlay
+func (v *VirtManager) DeleteSnapshot(name, snapshot string) error {
+	d, err := v.conn.LookupDomainByName(name)
+	if err != nil {
+		return err
+	}
+	defer freeDomain(d)
+	s, err := lookupSnapshot(d, snapshot)
+	if err != nil {
+		return err
+	}
+	defer freeSnapshot(s)
+	return s.Delete(0)
+}
+
+func lookupSnapshot(d *libvirt.Domain, snapshot string) (*libvirt.DomainSnapshot, error) {
+	s, err := d.SnapshotLookupByName(snapshot, 0)
+	if lverr, ok := err.(libvirt.Error); ok && lverr.Code == libvirt.ERR_NO_DOMAIN_SNAPSHOT {
+		return nil, ErrSnapshotNotFound
+	}
+	return s, err
+}
+
+func snapshotOf(s *libvirt.DomainSnapshot) (*Snapshot, error) {
+	desc, err := s.GetXMLDesc(0)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot domainSnapshotXML
+	if err = xml.Unmarshal([]byte(desc), &snapshot); err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Name:    snapshot.Name,
+		Label:   snapshot.Description,
+		Created: time.Unix(snapshot.CreationTime, 0).UTC(),
+	}, nil
+}
+
+func freeDomain(d *libvirt.Domain) {
+	if err := d.Free(); err != nil {
+		log.Error("free libvirt.Domain fail")
+	}
+}
+
+func freeSnapshot(s *libvirt.DomainSnapshot) {
+	if err := s.Free(); err != nil {
+		log.Error("free libvirt.DomainSnapshot fail")
+	}
+}
@@ -3,55 +3,57 @@ package vm
 import (
 	"errors"
 	"fmt"
+	"github.com/hamster-shared/hamster-provider/core/modules/archive"
+	"github.com/hamster-shared/hamster-provider/core/modules/cache"
 	"github.com/hamster-shared/hamster-provider/core/modules/utils"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 type VirtManager struct {
 	home       string
 	template   *Template
 	accessPort int
+	cache      *cache.ImageCache
 }
 
-func NewVirtManager(t Template) (*VirtManager, error) {
+func NewVirtManager(t Template, imageCache *cache.ImageCache) (*VirtManager, error) {
 	homedir, err := os.UserHomeDir()
+	if imageCache == nil {
+		imageCache = cache.NewImageCache(filepath.Join(homedir, ".hamster-provider", "cache"), 0)
+	}
 	manager := &VirtManager{
 		home:       filepath.Join(homedir, ".hamster-provider"),
 		accessPort: t.AccessPort,
+		cache:      imageCache,
 	}
 	err = manager.SetTemplate(t)
 	return manager, err
 }
 
+// SetInstanceTemplate the hyper-v instances are created from the current template
+func (v *VirtManager) SetInstanceTemplate(name string, t Template) error {
+	return v.SetTemplate(t)
+}
+
 func (v *VirtManager) SetTemplate(t Template) error {
 	v.template = &t
-	baeImage := filepath.Join(v.home, filepath.Base(v.template.Image))
-	if _, err := os.Stat(baeImage); errors.Is(err, os.ErrNotExist) {
+	if _, err := os.Stat(v.getBaseImagePath()); errors.Is(err, os.ErrNotExist) {
 		log.Info("start download template")
-
-		// download file and rename
-		err = utils.Download(v.template.Image, baeImage)
+		baeImage, err := v.cache.Fetch(cache.Source{Url: v.template.Image, Sha256: v.template.Sha256})
 		if err != nil {
 			log.Error("download template fail")
 			return err
 		}
-	}
-
-	if _, err := os.Stat(v.getBaseImagePath()); errors.Is(err, os.ErrNotExist) {
-		if strings.HasSuffix(baeImage, ".tar.gz") {
-			file, err := os.Open(baeImage)
-			if err != nil {
-				log.Error("download template fail")
-				return err
-			}
-			err = utils.UnTar(file, v.getBaseImagePath())
-			if err != nil {
-				fmt.Println("untar :", err)
-				return err
-			}
+		if !archive.IsArchive(baeImage) {
+			_, err = utils.Copy(baeImage, v.getBaseImagePath())
+			return err
+		}
+		err = extractImage(baeImage, v.getBaseImageName(), v.getBaseImagePath())
+		if err != nil {
+			fmt.Println("untar :", err)
+			return err
 		}
 	}
 	return nil
@@ -66,23 +68,19 @@ func (v *VirtManager) getCopyDiskFile(name string) string {
 }
 
 func (v *VirtManager) getBaseImageName() string {
-	imageName := filepath.Base(v.template.Image)
-	if strings.HasSuffix(imageName, ".tar.gz") {
-		imageName = strings.ReplaceAll(imageName, ".tar.gz", "")
-	}
-	return imageName
+	return archive.TrimExtension(filepath.Base(v.template.Image))
 }
 
 func (v *VirtManager) getBaseImagePath() string {
 	return filepath.Join(v.home, v.getBaseImageName())
 }
 
-func (v *VirtManager) Create(name string) error {
+func (v *VirtManager) Create(name string) (string, error) {
 
 	switchName, err := utils.GetDefaultVirtualSwitch()
 
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	err = utils.CreateVirtualMachine(
@@ -96,22 +94,22 @@ func (v *VirtManager) Create(name string) error {
 		1,
 		false,
 	)
-	return err
+	return name, err
 }
 
 func (v *VirtManager) Start(name string) error {
 	return utils.StartVirtualMachine(name)
 }
 
-func (v *VirtManager) CreateAndStart(name string) error {
-	err := v.Create(name)
+func (v *VirtManager) CreateAndStart(name string) (string, error) {
+	id, err := v.Create(name)
 	if err != nil {
-		return v.Start(name)
+		return "", err
 	}
-	return err
+	return id, v.Start(name)
 }
 
-func (v *VirtManager) CreateAndStartAndInjectionPublicKey(name, publicKey string) error {
+func (v *VirtManager) CreateAndStartAndInjectionPublicKey(name, publicKey string) (string, error) {
 	return v.CreateAndStart(name)
 }
 
@@ -131,7 +129,7 @@ func (v *VirtManager) Destroy(name string) error {
 	return utils.DeleteVirtualMachine(name)
 }
 
-func (v *VirtManager) InjectionPublicKey(name, publicKey string) error {
+func (v *VirtManager) SetAuthorizedKeys(name string, keys []string) error {
 	return errors.New("not support now")
 }
 
@@ -161,3 +159,27 @@ func (v *VirtManager) GetIp(name string) (string, error) {
 func (v *VirtManager) GetAccessPort(name string) int {
 	return v.accessPort
 }
+
+func (v *VirtManager) List() ([]string, error) {
+	return nil, errors.New("not support now")
+}
+
+func (v *VirtManager) ConsoleLog(name string, tail int) (string, error) {
+	return "", errors.New("not support now")
+}
+
+func (v *VirtManager) Snapshot(name, label string) (*Snapshot, error) {
+	return nil, errors.New("not support now")
+}
+
+func (v *VirtManager) ListSnapshots(name string) ([]Snapshot, error) {
+	return nil, errors.New("not support now")
+}
+
+func (v *VirtManager) Restore(name, snapshot string) error {
+	return errors.New("not support now")
+}
+
+func (v *VirtManager) DeleteSnapshot(name, snapshot string) error {
+	return errors.New("not support now")
+}
@@ -15,7 +15,7 @@ func getVmManager() (*VirtManager, error) {
 		Image:      "https://s3.ttchain.tntlinking.com/compute/ubuntu.vhdx.tar.gz",
 		AccessPort: 22,
 	}
-	return NewVirtManager(template)
+	return NewVirtManager(template, nil)
 }
 
 func TestCreate(t *testing.T) {
@@ -28,12 +28,12 @@ func TestCreate(t *testing.T) {
 		Image:      "https://s3.ttchain.tntlinking.com/compute/windows10.vhdx.tar.gz",
 		AccessPort: 22,
 	}
-	vmManager, err := NewVirtManager(template)
+	vmManager, err := NewVirtManager(template, nil)
 	assert.NoError(t, err)
 
 	vmName := "test_win2"
 
-	err = vmManager.Create(vmName)
+	_, err = vmManager.Create(vmName)
 
 	assert.NoError(t, err)
 
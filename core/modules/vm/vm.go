@@ -2,9 +2,14 @@ package vm
 
 import (
 	log "github.com/sirupsen/logrus"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 )
 
+const instanceNamePrefix = "order_"
+
 func init() {
 	// Log as JSON instead of the default ASCII formatter.
 	log.SetFormatter(&log.JSONFormatter{})
@@ -19,8 +24,10 @@ func init() {
 
 // Manager 虚拟化接口
 type Manager interface {
-	// SetTemplate 配置模板
+	// SetTemplate 配置默认模板
 	SetTemplate(t Template) error
+	// SetInstanceTemplate 配置实例使用的模板, 在创建实例之前调用
+	SetInstanceTemplate(name string, t Template) error
 	// Create 创建
 	Create(name string) (string, error)
 	// Start 启动虚拟机
@@ -37,8 +44,8 @@ type Manager interface {
 	Shutdown(name string) error
 	// Destroy 销毁虚拟机
 	Destroy(name string) error
-	// InjectionPublicKey 注入公玥 (vm实现和docker实现时机不同)
-	InjectionPublicKey(name string, publicKey string) error
+	// SetAuthorizedKeys 替换实例中由 provider 管理的 ssh 公钥, 实例内自行添加的公钥保持不变
+	SetAuthorizedKeys(name string, keys []string) error
 	// Status 查看状态
 	Status(name string) (*Status, error)
 
@@ -46,6 +53,72 @@ type Manager interface {
 	GetIp(name string) (string, error)
 	// GetAccessPort 获取运行时端口
 	GetAccessPort(name string) int
+
+	// List 列出本机管理的订单实例名称
+	List() ([]string, error)
+	// ConsoleLog 获取控制台日志的最后 tail 行
+	ConsoleLog(name string, tail int) (string, error)
+
+	// Snapshot 创建实例快照
+	Snapshot(name, label string) (*Snapshot, error)
+	// ListSnapshots 列出实例的快照, 按创建时间排序
+	ListSnapshots(name string) ([]Snapshot, error)
+	// Restore 将实例恢复到快照, 快照之后的修改会丢失
+	Restore(name, snapshot string) error
+	// DeleteSnapshot 删除实例快照
+	DeleteSnapshot(name, snapshot string) error
+}
+
+// ImagePreparer 可以提前下载模板镜像的虚拟化实现, 避免第一个订单等待镜像下载
+type ImagePreparer interface {
+	// PrepareImage 下载模板的镜像, 已存在时直接返回
+	PrepareImage(t Template) error
+}
+
+// DataExporter 可以导出订单数据卷的虚拟化实现, 协议到期后租户可以在宽限期内下载数据
+type DataExporter interface {
+	// ExportData 将已停止实例的数据卷以 tar 格式写入 w, 没有数据卷时返回 ErrNoData
+	ExportData(name string, w io.Writer) error
+	// DataFormat 导出内容的格式 DataFiles 或 DataQcow2, 写入通知让租户知道如何读取
+	DataFormat() string
+}
+
+// ResidueChecker 可以列出实例残留资源的虚拟化实现, 用于检查销毁是否彻底
+type ResidueChecker interface {
+	// Residue 列出实例仍然存在的资源, 销毁完成后为空
+	Residue(name string) ([]string, error)
+}
+
+// Resizer 可以调整运行中实例规格的虚拟化实现, 用于订单升级
+type Resizer interface {
+	// InstanceSize 实例当前的 cpu 核数, 内存和磁盘大小
+	InstanceSize(name string) (Size, error)
+	// Resize 调整实例的 cpu, 内存和磁盘, 磁盘只能扩大
+	Resize(name string, size Size) error
+}
+
+// ServiceResolver 实例的 ip 不能从宿主机直接访问端口的虚拟化实现, 解析实例内服务端口在宿主机上的访问地址
+type ServiceResolver interface {
+	// ServiceAddress 实例端口 port 在宿主机上可以访问的 ip 和端口
+	ServiceAddress(name string, port int) (string, int, error)
+}
+
+// InstanceName the instance name of the order
+func InstanceName(orderNo uint64) string {
+	return instanceNamePrefix + strconv.FormatUint(orderNo, 10)
+}
+
+// ParseInstanceName get the order number from the instance name
+func ParseInstanceName(name string) (uint64, bool) {
+	name = strings.TrimPrefix(name, "/")
+	if !strings.HasPrefix(name, instanceNamePrefix) {
+		return 0, false
+	}
+	orderNo, err := strconv.ParseUint(strings.TrimPrefix(name, instanceNamePrefix), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return orderNo, true
 }
 
 type Status struct {
@@ -59,10 +132,54 @@ func (s *Status) IsRunning() bool {
 	return s.status == 1
 }
 
+// String 状态描述
+func (s *Status) String() string {
+	switch s.status {
+	case 0:
+		return "stopped"
+	case 1:
+		return "running"
+	case 2:
+		return "paused"
+	default:
+		return "unknown"
+	}
+}
+
+// InstanceInfo instance information of an order
+type InstanceInfo struct {
+	OrderNo    uint64 `json:"orderNo"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Ip         string `json:"ip"`
+	AccessPort int    `json:"accessPort"`
+	User       string `json:"user"` // login user of the tenant
+}
+
 type Template struct {
+	Name              string // catalog template name
 	Cpu, Memory, Disk uint64
+	MaxCpu, MaxMemory uint64 // the size the instance can be upgraded to without a restart, no headroom when 0, kvm only
 	System            string
 	PublicKey         string
 	Image             string
+	Sha256            string // hex sha256 of the kvm image file, or the digest the docker image is pinned to
 	AccessPort        int
+	User              TenantUser
+	Packages          []string
+	CpuSet            []uint   // host cpus the vcpus are pinned to, kvm only
+	DataPath          string   // mount path of the data volume kept for the whole agreement, none when empty
+	DataSize          uint64   // GB, size of the kvm data disk
+	Runtime           string   // oci runtime of the container, like runsc or kata-runtime, docker only
+	Seccomp           string   // seccomp profile file of the container or unconfined, docker only
+	AppArmor          string   // apparmor profile loaded on the host, docker only
+	CapDrop           []string // capabilities dropped from the container, docker only
+}
+
+// withAccessPort the ssh port inside the instance defaults to 22
+func withAccessPort(t Template) Template {
+	if t.AccessPort == 0 {
+		t.AccessPort = 22
+	}
+	return t
 }
@@ -0,0 +1,46 @@
+package vm
+
+import (
+	"errors"
+	"os"
+)
+
+// wipeBlock the size of the zero blocks written over the files
+const wipeBlock = 1 << 20
+
+// wipeFile overwrite the file with zeros, flush it to the disk and remove it, on copy-on-write file systems
+// and ssds the old blocks may survive, the data disks should be on an encrypted device there
+func wipeFile(file string) error {
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	zeros := make([]byte, wipeBlock)
+	for left := info.Size(); left > 0; {
+		n := int64(len(zeros))
+		if left < n {
+			n = left
+		}
+		if _, err = f.Write(zeros[:n]); err != nil {
+			f.Close()
+			return err
+		}
+		left -= n
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
@@ -0,0 +1,19 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWipeFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "data.qcow2")
+	assert.NoError(t, os.WriteFile(file, bytes.Repeat([]byte("secret"), wipeBlock), 0600))
+	assert.NoError(t, wipeFile(file))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	// a missing file is already wiped
+	assert.NoError(t, wipeFile(file))
+}
@@ -14,6 +14,8 @@ func TestDestroyVm(t *testing.T) {
 		TimerService: context.TimerService,
 		Cm:           context.Cm,
 		P2pClient:    context.P2pClient,
+		Expiry:       context.Expiry,
+		Destruction:  context.Destruction,
 	}
 	eventService := event.NewEventService(eventContex)
 	cfg := context.GetConfig()